@@ -9,7 +9,12 @@ import (
 	"github.com/fmcato/octave-mcp/internal/server"
 )
 
-var httpAddr = flag.String("http", "", "HTTP address to listen on (empty for stdio)")
+var (
+	httpAddr    = flag.String("http", "", "HTTP address to listen on (empty for stdio)")
+	tlsCert     = flag.String("tls-cert", "", "PEM certificate to serve HTTPS with, reloaded when it changes")
+	tlsKey      = flag.String("tls-key", "", "PEM private key of -tls-cert")
+	tlsClientCA = flag.String("tls-client-ca", "", "PEM CA bundle client certificates must chain to, enables mutual TLS")
+)
 
 func main() {
 	// Setup structured logging
@@ -38,10 +43,12 @@ func main() {
 	flag.Parse()
 
 	srv := server.New()
+	defer srv.Close()
 	srv.RegisterHandlers()
 
 	if *httpAddr != "" {
-		if err := srv.RunHTTP(*httpAddr); err != nil {
+		tlsFiles := server.TLSConfig{CertFile: *tlsCert, KeyFile: *tlsKey, ClientCAFile: *tlsClientCA}
+		if err := srv.RunHTTP(*httpAddr, tlsFiles); err != nil {
 			slog.Error("HTTP server failed", "error", err)
 			log.Fatal(err)
 		}
@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxAnimationFrames caps how many frames animate mode captures
+	maxAnimationFrames = 100
+	// maxAnimationPixels caps the pixels of all frames of an animation,
+	// later frames are omitted
+	maxAnimationPixels = 40_000_000
+	// Bounds and default of PlotOptions.FrameDelay, in milliseconds
+	minFrameDelay     = 20
+	maxFrameDelay     = 5000
+	defaultFrameDelay = 100
+)
+
+// animationScript wraps script so that every drawnow call exports the current
+// figure to dir as frame-<n>.png, and writes the number of drawnow calls to
+// frames.txt. A script that never calls drawnow gets its final state as the
+// only frame.
+//
+// The drawnow replacement is a command-line function, which takes precedence
+// over the builtin. It is removed once the script is done, and falls back to
+// the builtin if a failed script left it behind in a session.
+func animationScript(script, dir string, opts PlotOptions) string {
+	path := octaveString(dir)
+	return fmt.Sprintf(`
+graphics_toolkit("gnuplot");
+set(0, "defaultfigurevisible", "off");
+global __octave_mcp_frames__;
+__octave_mcp_frames__ = 0;
+function drawnow(varargin)
+  global __octave_mcp_frames__;
+  if !exist(%s, "dir")
+    builtin("drawnow", varargin{:});
+    return;
+  end
+  __octave_mcp_frames__++;
+  if __octave_mcp_frames__ > %d
+    return;
+  end
+  __octave_mcp_h__ = gcf();
+%s  print(__octave_mcp_h__, sprintf("%%s/frame-%%d.png", %s, __octave_mcp_frames__)%s);
+endfunction
+%s
+if __octave_mcp_frames__ == 0
+  drawnow();
+end
+__octave_mcp_fid__ = fopen([%s "/frames.txt"], "w");
+fprintf(__octave_mcp_fid__, "%%d\n", __octave_mcp_frames__);
+fclose(__octave_mcp_fid__);
+clear drawnow;
+clear -global __octave_mcp_frames__;
+`, path, maxAnimationFrames, opts.styleScript(), path, opts.printArgs(PlotFormatGIF), script, path)
+}
+
+// readAnimation assembles the frames written by animationScript into an
+// animated GIF. Frames are mapped to the Plan 9 palette without dithering,
+// which suits the flat colors of plots, and cropped or padded to the size of
+// the first one. Frame sizes are checked before decoding: frames larger than
+// the largest plot fail the animation, frames beyond maxAnimationPixels are
+// omitted.
+func readAnimation(dir *os.Root, opts PlotOptions) (*PlotResult, error) {
+	delay := opts.FrameDelay
+	if delay == 0 {
+		delay = defaultFrameDelay
+	}
+
+	anim := &gif.GIF{}
+	var bounds image.Rectangle
+	pixels := 0
+	for i := 1; i <= maxAnimationFrames; i++ {
+		data, err := readExchangeFile(dir, fmt.Sprintf("frame-%d.png", i))
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read animation frame: %w", err)
+		}
+		config, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode animation frame %d: %w", i, err)
+		}
+		if config.Width > maxPlotSize || config.Height > maxPlotSize {
+			return nil, fmt.Errorf("animation frame %d is %dx%d pixels, larger than %dx%d", i, config.Width, config.Height, maxPlotSize, maxPlotSize)
+		}
+		if i == 1 {
+			bounds = image.Rect(0, 0, config.Width, config.Height)
+		}
+		// Every frame is cropped or padded to the first one
+		if pixels += bounds.Dx() * bounds.Dy(); pixels > maxAnimationPixels {
+			break
+		}
+		frame, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode animation frame %d: %w", i, err)
+		}
+		paletted := image.NewPaletted(bounds, palette.Plan9)
+		draw.Draw(paletted, bounds, frame, frame.Bounds().Min, draw.Src)
+		anim.Image = append(anim.Image, paletted)
+		// GIF delays are in hundredths of a second
+		anim.Delay = append(anim.Delay, delay/10)
+	}
+	if len(anim.Image) == 0 {
+		return nil, fmt.Errorf("failed to read animation frame: no frame was captured")
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, fmt.Errorf("failed to encode animation: %w", err)
+	}
+
+	result := &PlotResult{
+		Format:  PlotFormatGIF,
+		Figures: []Figure{{Image: buf.Bytes()}},
+		Frames:  len(anim.Image),
+	}
+	if data, err := readExchangeFile(dir, "frames.txt"); err == nil {
+		if total, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && total > result.Frames {
+			result.Omitted = total - result.Frames
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFrame writes a solid PNG frame of the given size
+func writeFrame(t *testing.T, dir string, n, w, h int, c color.Color) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("frame-%d.png", n)), buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadAnimation(t *testing.T) {
+	dir := t.TempDir()
+	writeFrame(t, dir, 1, 40, 30, color.White)
+	writeFrame(t, dir, 2, 40, 30, color.Black)
+	writeFrame(t, dir, 3, 50, 20, color.RGBA{R: 255, A: 255})
+	if err := os.WriteFile(filepath.Join(dir, "frames.txt"), []byte("5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := readAnimation(openRoot(t, dir), PlotOptions{FrameDelay: 250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Format != PlotFormatGIF || result.Frames != 3 || result.Omitted != 2 {
+		t.Errorf("Unexpected result: format %s, %d frames, %d omitted", result.Format, result.Frames, result.Omitted)
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(result.Figures[0].Image))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(anim.Image))
+	}
+	for i, frame := range anim.Image {
+		if frame.Bounds() != image.Rect(0, 0, 40, 30) {
+			t.Errorf("Frame %d has bounds %v, expected the size of the first frame", i+1, frame.Bounds())
+		}
+		if anim.Delay[i] != 25 {
+			t.Errorf("Frame %d has delay %d, expected 25", i+1, anim.Delay[i])
+		}
+	}
+	if r, _, _, _ := anim.Image[1].At(0, 0).RGBA(); r != 0 {
+		t.Errorf("Expected the second frame to be black, got red %d", r)
+	}
+
+	if _, err := readAnimation(openRoot(t, t.TempDir()), PlotOptions{}); err == nil || !strings.Contains(err.Error(), "no frame") {
+		t.Errorf("Expected missing frame error, got: %v", err)
+	}
+
+	// The size is checked before the frame is decoded
+	large := t.TempDir()
+	writeFrame(t, large, 1, 40, 30, color.White)
+	writeFrame(t, large, 2, maxPlotSize+1, 1, color.White)
+	if _, err := readAnimation(openRoot(t, large), PlotOptions{}); err == nil || !strings.Contains(err.Error(), "animation frame 2 is 4001x1 pixels") {
+		t.Errorf("Expected oversized frame error, got: %v", err)
+	}
+}
+
+func TestAnimationScript(t *testing.T) {
+	script := animationScript("for k = 1:3\n  plot(1:k);\n  drawnow;\nend", "/tmp/octave-plot-1", PlotOptions{Width: 320, Height: 240})
+	for _, want := range []string{
+		"function drawnow(varargin)",
+		`builtin("drawnow", varargin{:});`,
+		`sprintf("%s/frame-%d.png", ` + octaveString("/tmp/octave-plot-1") + `, __octave_mcp_frames__), "-dpng", "-S320,240");`,
+		"if __octave_mcp_frames__ > 100",
+		"clear drawnow;",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected wrapper to contain %q:\n%s", want, script)
+		}
+	}
+}
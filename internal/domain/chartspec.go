@@ -0,0 +1,464 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Chart spec formats convert the figure object tree into a JSON chart
+// specification clients render natively, instead of exporting an image
+const (
+	PlotFormatVegaLite = "vegalite"
+	PlotFormatPlotly   = "plotly"
+)
+
+const vegaLiteSchema = "https://vega.github.io/schema/vega-lite/v5.json"
+
+// isSpecFormat reports whether format is a chart spec format
+func isSpecFormat(format string) bool {
+	return format == PlotFormatVegaLite || format == PlotFormatPlotly
+}
+
+// chartSpec converts the data of figure n into a chart spec in format. What
+// cannot be represented is skipped and reported as warnings.
+func chartSpec(format string, n int, data *FigureData, opts PlotOptions) ([]byte, []string) {
+	var spec map[string]any
+	var warnings []string
+	if format == PlotFormatPlotly {
+		spec, warnings = plotlySpec(data, opts)
+	} else {
+		spec, warnings = vegaLiteSpec(data, opts)
+	}
+	for i, ax := range data.Axes {
+		if skipped := uniqueTypes(ax.Unsupported); len(skipped) > 0 {
+			warnings = append(warnings, fmt.Sprintf("axes %d: unsupported objects skipped: %s", i+1, strings.Join(skipped, ", ")))
+		}
+	}
+	for i := range warnings {
+		warnings[i] = fmt.Sprintf("figure %d, %s", n, warnings[i])
+	}
+
+	out, err := json.Marshal(spec)
+	if err != nil {
+		return nil, append(warnings, fmt.Sprintf("figure %d: failed to encode chart spec: %v", n, err))
+	}
+	return out, warnings
+}
+
+// uniqueTypes returns the object types without repetitions, in order
+func uniqueTypes(types []string) []string {
+	var unique []string
+	for _, t := range types {
+		if !slices.Contains(unique, t) {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// vegaLiteSpec lays out one view per axes, side by side when they share a
+// row and stacked otherwise
+func vegaLiteSpec(data *FigureData, opts PlotOptions) (map[string]any, []string) {
+	var warnings []string
+	var views []map[string]any
+	for i, ax := range data.Axes {
+		view, w := vegaLiteView(ax)
+		for _, warning := range w {
+			warnings = append(warnings, fmt.Sprintf("axes %d: %s", i+1, warning))
+		}
+		views = append(views, view)
+	}
+
+	spec := map[string]any{"$schema": vegaLiteSchema}
+	switch len(views) {
+	case 0:
+		spec["data"] = map[string]any{"values": []any{}}
+		spec["mark"] = "point"
+		views = []map[string]any{spec}
+	case 1:
+		for k, v := range views[0] {
+			spec[k] = v
+		}
+		views = []map[string]any{spec}
+	default:
+		concat := "vconcat"
+		if sameRow(data.Axes) {
+			concat = "hconcat"
+		}
+		list := make([]any, len(views))
+		for i, view := range views {
+			list[i] = view
+		}
+		spec[concat] = list
+	}
+
+	if opts.Width > 0 {
+		width, height := opts.Width, opts.Height
+		if _, ok := spec["hconcat"]; ok {
+			width /= len(views)
+		} else if _, ok := spec["vconcat"]; ok {
+			height /= len(views)
+		}
+		for _, view := range views {
+			view["width"] = width
+			view["height"] = height
+		}
+	}
+	return spec, warnings
+}
+
+// sameRow reports whether every axes sits at the same height of the figure
+func sameRow(axes []AxesData) bool {
+	for _, ax := range axes {
+		if len(ax.Position) != 4 || len(axes[0].Position) != 4 || ax.Position[1] != axes[0].Position[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// vegaLiteView draws the series of one axes as layers
+func vegaLiteView(ax AxesData) (map[string]any, []string) {
+	var warnings []string
+	layers := []any{}
+	for _, s := range ax.Series {
+		var layer map[string]any
+		switch s.Type {
+		case "surface":
+			layer = vegaLiteHeatmap(ax, s)
+			warnings = append(warnings, "surface drawn as a heatmap")
+		default:
+			layer = vegaLiteSeries(ax, s)
+			if len(s.ZData) > 0 {
+				warnings = append(warnings, fmt.Sprintf("3-D %s drawn in the x-y plane", s.Type))
+			}
+		}
+		layers = append(layers, layer)
+	}
+
+	view := map[string]any{"layer": layers}
+	if len(layers) == 0 {
+		delete(view, "layer")
+		view["data"] = map[string]any{"values": []any{}}
+		view["mark"] = "point"
+	}
+	if ax.Title != "" {
+		view["title"] = ax.Title
+	}
+	return view, warnings
+}
+
+// vegaLiteSeries draws a line, scatter or bar series
+func vegaLiteSeries(ax AxesData, s SeriesData) map[string]any {
+	x, y := numbers(s.XData), numbers(s.YData)
+	values := make([]any, 0, min(len(x), len(y)))
+	for i := 0; i < len(x) && i < len(y); i++ {
+		values = append(values, map[string]any{"x": x[i], "y": y[i]})
+	}
+
+	var mark map[string]any
+	switch s.Type {
+	case "bar":
+		mark = map[string]any{"type": "bar"}
+	case "scatter":
+		mark = map[string]any{"type": "point"}
+	default:
+		switch {
+		case s.LineStyle == "none":
+			mark = map[string]any{"type": "point"}
+		case s.Marker != "" && s.Marker != "none":
+			mark = map[string]any{"type": "line", "point": true}
+		default:
+			mark = map[string]any{"type": "line"}
+		}
+	}
+
+	encoding := map[string]any{
+		"x": vegaLiteAxis("x", "quantitative", ax.XLabel, ax.XScale, ax.XLim),
+		"y": vegaLiteAxis("y", "quantitative", ax.YLabel, ax.YScale, ax.YLim),
+	}
+	if s.Label != "" {
+		encoding["color"] = map[string]any{"datum": s.Label}
+	}
+	return map[string]any{
+		"data":     map[string]any{"values": values},
+		"mark":     mark,
+		"encoding": encoding,
+	}
+}
+
+// vegaLiteHeatmap draws a surface seen from above, colored by height
+func vegaLiteHeatmap(ax AxesData, s SeriesData) map[string]any {
+	z := rows(s.ZData)
+	x, y := rows(s.XData), rows(s.YData)
+	values := []any{}
+	for i, row := range z {
+		for j, v := range row {
+			values = append(values, map[string]any{"x": gridAt(x, i, j, false), "y": gridAt(y, i, j, true), "z": v})
+		}
+	}
+
+	color := map[string]any{"field": "z", "type": "quantitative"}
+	if ax.ZLabel != "" {
+		color["title"] = ax.ZLabel
+	}
+	if ax.ZScale == "log" {
+		color["scale"] = map[string]any{"type": "log"}
+	}
+	return map[string]any{
+		"data": map[string]any{"values": values},
+		"mark": "rect",
+		"encoding": map[string]any{
+			"x":     vegaLiteAxis("x", "ordinal", ax.XLabel, "", nil),
+			"y":     vegaLiteAxis("y", "ordinal", ax.YLabel, "", nil),
+			"color": color,
+		},
+	}
+}
+
+// gridAt returns the coordinate of grid point (i, j). Coordinates are a
+// full matrix, or a vector indexed by the column, or by the row for the y
+// coordinates of a surface.
+func gridAt(grid [][]any, i, j int, byRow bool) any {
+	switch {
+	case len(grid) == 1:
+		k := j
+		if byRow {
+			k = i
+		}
+		if k < len(grid[0]) {
+			return grid[0][k]
+		}
+	case i < len(grid) && len(grid[i]) == 1:
+		return grid[i][0]
+	case i < len(grid) && j < len(grid[i]):
+		return grid[i][j]
+	}
+	return nil
+}
+
+// vegaLiteAxis returns the encoding of a positional channel
+func vegaLiteAxis(field, kind, label, scale string, lim json.RawMessage) map[string]any {
+	channel := map[string]any{"field": field, "type": kind}
+	if label != "" {
+		channel["title"] = label
+	} else {
+		channel["title"] = nil
+	}
+	sc := map[string]any{}
+	if scale == "log" {
+		sc["type"] = "log"
+	}
+	if lo, hi, ok := limits(lim); ok {
+		sc["domain"] = []float64{lo, hi}
+	}
+	if len(sc) > 0 {
+		channel["scale"] = sc
+	}
+	return channel
+}
+
+// plotlySpec places one subplot per axes at its position in the figure. Axes
+// holding surfaces or 3-D series become 3-D scenes.
+func plotlySpec(data *FigureData, opts PlotOptions) (map[string]any, []string) {
+	var warnings []string
+	traces := []any{}
+	layout := map[string]any{}
+	var annotations []any
+	for i, ax := range data.Axes {
+		suffix := ""
+		if i > 0 {
+			suffix = strconv.Itoa(i + 1)
+		}
+		x, y := plotlyDomain(ax.Position)
+
+		scene := ""
+		for _, s := range ax.Series {
+			if s.Type == "surface" || len(s.ZData) > 0 {
+				scene = "scene" + suffix
+			}
+		}
+		if scene != "" {
+			layout[scene] = map[string]any{
+				"domain": map[string]any{"x": x, "y": y},
+				"xaxis":  plotlyAxis(ax.XLabel, ax.XScale, ax.XLim),
+				"yaxis":  plotlyAxis(ax.YLabel, ax.YScale, ax.YLim),
+				"zaxis":  plotlyAxis(ax.ZLabel, ax.ZScale, ax.ZLim),
+			}
+		} else {
+			xaxis := plotlyAxis(ax.XLabel, ax.XScale, ax.XLim)
+			xaxis["domain"] = x
+			xaxis["anchor"] = "y" + suffix
+			yaxis := plotlyAxis(ax.YLabel, ax.YScale, ax.YLim)
+			yaxis["domain"] = y
+			yaxis["anchor"] = "x" + suffix
+			layout["xaxis"+suffix] = xaxis
+			layout["yaxis"+suffix] = yaxis
+		}
+
+		for _, s := range ax.Series {
+			trace := plotlyTrace(s, scene != "")
+			if trace == nil {
+				warnings = append(warnings, fmt.Sprintf("axes %d: %s series in a 3-D axes skipped", i+1, s.Type))
+				continue
+			}
+			if scene != "" {
+				trace["scene"] = scene
+			} else {
+				trace["xaxis"] = "x" + suffix
+				trace["yaxis"] = "y" + suffix
+			}
+			traces = append(traces, trace)
+		}
+
+		if ax.Title == "" {
+			continue
+		}
+		if len(data.Axes) == 1 {
+			layout["title"] = map[string]any{"text": ax.Title}
+			continue
+		}
+		annotations = append(annotations, map[string]any{
+			"text":      ax.Title,
+			"x":         (x[0] + x[1]) / 2,
+			"y":         y[1],
+			"xref":      "paper",
+			"yref":      "paper",
+			"xanchor":   "center",
+			"yanchor":   "bottom",
+			"showarrow": false,
+		})
+	}
+	if annotations != nil {
+		layout["annotations"] = annotations
+	}
+	if opts.Width > 0 {
+		layout["width"] = opts.Width
+		layout["height"] = opts.Height
+	}
+	return map[string]any{"data": traces, "layout": layout}, warnings
+}
+
+// plotlyTrace converts a series, or returns nil when it cannot be drawn in
+// the axes
+func plotlyTrace(s SeriesData, scene bool) map[string]any {
+	trace := map[string]any{"x": s.XData, "y": s.YData}
+	switch s.Type {
+	case "surface":
+		trace["type"] = "surface"
+		trace["z"] = s.ZData
+	case "bar":
+		if scene {
+			return nil
+		}
+		trace["type"] = "bar"
+	default:
+		mode := "lines"
+		switch {
+		case s.Type == "scatter" || s.LineStyle == "none":
+			mode = "markers"
+		case s.Marker != "" && s.Marker != "none":
+			mode = "lines+markers"
+		}
+		trace["type"] = "scatter"
+		trace["mode"] = mode
+		if scene {
+			trace["type"] = "scatter3d"
+			if len(s.ZData) > 0 {
+				trace["z"] = s.ZData
+			} else {
+				trace["z"] = make([]float64, len(numbers(s.XData)))
+			}
+		}
+	}
+	if s.Label != "" {
+		trace["name"] = s.Label
+	}
+	trace["showlegend"] = s.Label != ""
+	return trace
+}
+
+// plotlyDomain converts the normalized position of an axes into the x and y
+// domains of its subplot
+func plotlyDomain(position []float64) ([]float64, []float64) {
+	if len(position) != 4 {
+		return []float64{0, 1}, []float64{0, 1}
+	}
+	clamp := func(v float64) float64 {
+		return math.Max(0, math.Min(1, v))
+	}
+	return []float64{clamp(position[0]), clamp(position[0] + position[2])},
+		[]float64{clamp(position[1]), clamp(position[1] + position[3])}
+}
+
+// plotlyAxis returns the layout of an axis. The range of log axes is given in
+// powers of ten.
+func plotlyAxis(label, scale string, lim json.RawMessage) map[string]any {
+	axis := map[string]any{}
+	if label != "" {
+		axis["title"] = map[string]any{"text": label}
+	}
+	lo, hi, ok := limits(lim)
+	if scale == "log" {
+		axis["type"] = "log"
+		if ok && lo > 0 && hi > 0 {
+			axis["range"] = []float64{math.Log10(lo), math.Log10(hi)}
+		}
+	} else if ok {
+		axis["range"] = []float64{lo, hi}
+	}
+	return axis
+}
+
+// limits decodes finite [lo hi] axis limits
+func limits(lim json.RawMessage) (float64, float64, bool) {
+	values := numbers(lim)
+	if len(values) != 2 {
+		return 0, 0, false
+	}
+	lo, ok1 := values[0].(float64)
+	hi, ok2 := values[1].(float64)
+	return lo, hi, ok1 && ok2
+}
+
+// numbers decodes numeric data into a flat list, matrices row by row. NaN and
+// Inf values are nil.
+func numbers(raw json.RawMessage) []any {
+	var flat []any
+	for _, row := range rows(raw) {
+		flat = append(flat, row...)
+	}
+	return flat
+}
+
+// rows decodes numeric data into the rows of a matrix, a scalar or a vector
+// being a single row
+func rows(raw json.RawMessage) [][]any {
+	if len(raw) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return [][]any{{v}}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	if _, nested := list[0].([]any); !nested {
+		return [][]any{list}
+	}
+	out := make([][]any, 0, len(list))
+	for _, row := range list {
+		r, _ := row.([]any)
+		out = append(out, r)
+	}
+	return out
+}
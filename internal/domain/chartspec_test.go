@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const chartSpecData = `{"axes":[` +
+	`{"title":"Decay","xlabel":"t","ylabel":"v","xlim":[0,4],"ylim":[1,100],"xscale":"linear","yscale":"log","zscale":"linear",` +
+	`"position":[0.1,0.1,0.35,0.8],"unsupported":["patch","text","patch"],"series":[` +
+	`{"type":"line","line_style":"-","marker":"none","label":"exp","xdata":[0,2,4],"ydata":[100,10,1],"size":[1,3],"stride":1},` +
+	`{"type":"line","line_style":"none","marker":"o","xdata":[1,3],"ydata":[50,5],"size":[1,2],"stride":1},` +
+	`{"type":"bar","xdata":[1,2],"ydata":[3,4],"size":[1,2],"stride":1}]},` +
+	`{"title":"Peak","xlim":[1,2],"ylim":[1,2],"zlim":[0,1],"xscale":"linear","yscale":"linear","zscale":"linear",` +
+	`"position":[0.55,0.1,0.35,0.8],"series":[` +
+	`{"type":"surface","xdata":[1,2],"ydata":[1,2],"zdata":[[0,1],[1,0]],"size":[2,2],"stride":1}]}]}`
+
+func decodeChartSpec(t *testing.T, format string, opts PlotOptions) (map[string]any, []string) {
+	t.Helper()
+	var data FigureData
+	if err := json.Unmarshal([]byte(chartSpecData), &data); err != nil {
+		t.Fatal(err)
+	}
+	out, warnings := chartSpec(format, 1, &data, opts)
+	var spec map[string]any
+	if err := json.Unmarshal(out, &spec); err != nil {
+		t.Fatalf("Invalid spec %s: %v", out, err)
+	}
+	return spec, warnings
+}
+
+func TestChartSpec_VegaLite(t *testing.T) {
+	spec, warnings := decodeChartSpec(t, PlotFormatVegaLite, PlotOptions{Width: 800, Height: 300})
+	if spec["$schema"] != vegaLiteSchema {
+		t.Errorf("Unexpected schema %v", spec["$schema"])
+	}
+	views, ok := spec["hconcat"].([]any)
+	if !ok || len(views) != 2 {
+		t.Fatalf("Expected two side by side views, got %v", spec)
+	}
+	left := views[0].(map[string]any)
+	if left["title"] != "Decay" || left["width"] != 400.0 || left["height"] != 300.0 {
+		t.Errorf("Unexpected view %v", left)
+	}
+	layers := left["layer"].([]any)
+	if len(layers) != 3 {
+		t.Fatalf("Expected 3 layers, got %d", len(layers))
+	}
+	var marks []string
+	for _, layer := range layers {
+		mark := layer.(map[string]any)["mark"].(map[string]any)
+		marks = append(marks, mark["type"].(string))
+	}
+	if strings.Join(marks, ",") != "line,point,bar" {
+		t.Errorf("Unexpected marks %v", marks)
+	}
+	line := layers[0].(map[string]any)
+	encoding := line["encoding"].(map[string]any)
+	y := encoding["y"].(map[string]any)
+	if y["title"] != "v" || y["scale"].(map[string]any)["type"] != "log" {
+		t.Errorf("Unexpected y encoding %v", y)
+	}
+	if encoding["color"].(map[string]any)["datum"] != "exp" {
+		t.Errorf("Expected legend entry, got %v", encoding["color"])
+	}
+	if values := line["data"].(map[string]any)["values"].([]any); len(values) != 3 {
+		t.Errorf("Expected 3 points, got %v", values)
+	}
+
+	heatmap := views[1].(map[string]any)["layer"].([]any)[0].(map[string]any)
+	if heatmap["mark"] != "rect" || len(heatmap["data"].(map[string]any)["values"].([]any)) != 4 {
+		t.Errorf("Unexpected heatmap %v", heatmap)
+	}
+
+	want := []string{
+		"figure 1, axes 2: surface drawn as a heatmap",
+		"figure 1, axes 1: unsupported objects skipped: patch, text",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected warnings %q", warnings)
+	}
+}
+
+func TestChartSpec_Plotly(t *testing.T) {
+	spec, warnings := decodeChartSpec(t, PlotFormatPlotly, PlotOptions{})
+	traces := spec["data"].([]any)
+	if len(traces) != 4 {
+		t.Fatalf("Expected 4 traces, got %d", len(traces))
+	}
+	var kinds []string
+	for _, trace := range traces {
+		tr := trace.(map[string]any)
+		kind := tr["type"].(string)
+		if mode, ok := tr["mode"]; ok {
+			kind += ":" + mode.(string)
+		}
+		kinds = append(kinds, kind)
+	}
+	if strings.Join(kinds, ",") != "scatter:lines,scatter:markers,bar,surface" {
+		t.Errorf("Unexpected traces %v", kinds)
+	}
+	if first := traces[0].(map[string]any); first["name"] != "exp" || first["xaxis"] != "x" {
+		t.Errorf("Unexpected first trace %v", first)
+	}
+	if traces[3].(map[string]any)["scene"] != "scene2" {
+		t.Errorf("Expected the surface in a scene, got %v", traces[3])
+	}
+
+	layout := spec["layout"].(map[string]any)
+	yaxis := layout["yaxis"].(map[string]any)
+	if yaxis["type"] != "log" || yaxis["range"].([]any)[1] != 2.0 {
+		t.Errorf("Unexpected log axis %v", yaxis)
+	}
+	if _, ok := layout["scene2"]; !ok {
+		t.Errorf("Expected a 3-D scene, got %v", layout)
+	}
+	if annotations := layout["annotations"].([]any); len(annotations) != 2 {
+		t.Errorf("Expected subplot titles, got %v", annotations)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "unsupported objects skipped: patch, text") {
+		t.Errorf("Unexpected warnings %q", warnings)
+	}
+}
+
+func TestReadFigures_Spec(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"figures.txt":   "2\n",
+		"figure-1.txt":  "Decay\n",
+		"figure-1.json": chartSpecData,
+		"figure-2.txt":  "",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := readFigures(openRoot(t, dir), PlotFormatPlotly, PlotOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Figures) != 2 {
+		t.Fatalf("Expected 2 figures, got %d", len(result.Figures))
+	}
+	if !json.Valid(result.Figures[0].Image) || result.Figures[0].Data != nil {
+		t.Errorf("Expected a spec without data, got %+v", result.Figures[0])
+	}
+	if result.Figures[1].Image != nil {
+		t.Errorf("Expected no spec without data, got %s", result.Figures[1].Image)
+	}
+	if !strings.Contains(strings.Join(result.Warnings, "\n"), "figure 2: chart spec omitted") {
+		t.Errorf("Unexpected warnings %q", result.Warnings)
+	}
+}
@@ -0,0 +1,206 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// docLookupTimeout bounds a help or lookfor call, lookfor reads the
+	// documentation of every function on the path
+	docLookupTimeout = 60 * time.Second
+	// maxLookforMatches caps the functions returned by a keyword search
+	maxLookforMatches = 100
+	// maxDocCacheEntries caps the cached lookups
+	maxDocCacheEntries = 1000
+)
+
+var (
+	// functionNameRe matches function names, including package-scoped ones
+	// such as pkg.fn
+	functionNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)*$`)
+	// lookforKeywordRe matches the keywords accepted by lookfor
+	lookforKeywordRe = regexp.MustCompile(`^[A-Za-z0-9_. -]{1,64}$`)
+)
+
+// HelpResult is the documentation of a function in the detected Octave version
+type HelpResult struct {
+	Name    string
+	Version string
+	// Found reports whether the function can be called as is
+	Found bool
+	// Package names the installed package providing the function when it is
+	// not loaded
+	Package string
+	// Text is the help text, empty for undocumented functions
+	Text string
+}
+
+// LookforResult lists the functions whose help mentions a keyword
+type LookforResult struct {
+	Keyword string
+	Version string
+	Matches []LookforMatch
+	// Omitted counts the matches beyond maxLookforMatches
+	Omitted int
+}
+
+// LookforMatch is a function found by lookfor with the first sentence of its
+// help text
+type LookforMatch struct {
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+}
+
+// docCache keeps documentation lookups in memory. Keys include the Octave
+// version, so results never outlive the interpreter they came from.
+type docCache struct {
+	mu      sync.Mutex
+	entries map[string]any
+}
+
+func (c *docCache) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[key]
+	return v, ok
+}
+
+func (c *docCache) put(key string, v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]any)
+	}
+	if len(c.entries) >= maxDocCacheEntries {
+		// Lookups are cheap to redo, drop an arbitrary entry
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = v
+}
+
+// helpScript writes the help text of a function to dir/help.txt, preceded by
+// a line holding its format as returned by get_help_text. Functions that are
+// not found are looked up in the installed packages that are not loaded, the
+// format line then reads "package <name>".
+const helpScript = `
+__octave_mcp_name__ = "%[2]s";
+[__octave_mcp_text__, __octave_mcp_fmt__] = get_help_text(__octave_mcp_name__);
+switch __octave_mcp_fmt__
+  case "texinfo"
+    __octave_mcp_text__ = __makeinfo__(__octave_mcp_text__, "plain text");
+  case "html"
+    __octave_mcp_text__ = regexprep(__octave_mcp_text__, "<[^>]*>", "");
+  case "Not found"
+    try
+      __octave_mcp_pkgs__ = pkg("list");
+      for __octave_mcp_k__ = 1:numel(__octave_mcp_pkgs__)
+        __octave_mcp_p__ = __octave_mcp_pkgs__{__octave_mcp_k__};
+        if __octave_mcp_p__.loaded
+          continue;
+        end
+        __octave_mcp_d__ = pkg("describe", __octave_mcp_p__.name);
+        __octave_mcp_prov__ = __octave_mcp_d__{1}.provides;
+        for __octave_mcp_j__ = 1:numel(__octave_mcp_prov__)
+          if any(strcmp(__octave_mcp_prov__{__octave_mcp_j__}.functions, __octave_mcp_name__))
+            __octave_mcp_fmt__ = ["package " __octave_mcp_p__.name];
+          end
+        end
+      end
+    catch
+    end
+end
+__octave_mcp_fid__ = fopen([%[1]s "/help.txt"], "w");
+fprintf(__octave_mcp_fid__, "%%s\n", __octave_mcp_fmt__);
+fputs(__octave_mcp_fid__, __octave_mcp_text__);
+fclose(__octave_mcp_fid__);
+`
+
+// lookforScript writes the number of functions whose help mentions a keyword
+// to dir/lookfor.txt, followed by the first maxLookforMatches of them, one per
+// line with the first sentence of their help after a tab
+const lookforScript = `
+[__octave_mcp_fcns__, __octave_mcp_help__] = lookfor("%[2]s");
+__octave_mcp_fid__ = fopen([%[1]s "/lookfor.txt"], "w");
+fprintf(__octave_mcp_fid__, "%%d\n", numel(__octave_mcp_fcns__));
+for __octave_mcp_k__ = 1:min(numel(__octave_mcp_fcns__), %[3]d)
+  fprintf(__octave_mcp_fid__, "%%s\t%%s\n", __octave_mcp_fcns__{__octave_mcp_k__}, regexprep(__octave_mcp_help__{__octave_mcp_k__}, "\\s+", " "));
+end
+fclose(__octave_mcp_fid__);
+`
+
+// Help returns the help text of a function as documented by the running
+// Octave version. Results are cached.
+func (r *Runner) Help(ctx context.Context, name string, opts ExecOptions) (*HelpResult, error) {
+	if !functionNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid function name: %q", name)
+	}
+	key := r.version + "\x00help\x00" + name
+	if cached, ok := r.docs.get(key); ok {
+		return cached.(*HelpResult), nil
+	}
+
+	out, err := r.runWrapper(ctx, "help.txt", func(dir string) string {
+		return fmt.Sprintf(helpScript, octaveString(dir), name)
+	}, docLookupTimeout, opts)
+	if err != nil {
+		return nil, fmt.Errorf("help lookup failed: %w", err)
+	}
+	format, text, _ := strings.Cut(out, "\n")
+	result := &HelpResult{Name: name, Version: r.version}
+	switch {
+	case format == "Not found":
+	case strings.HasPrefix(format, "package "):
+		result.Package = strings.TrimPrefix(format, "package ")
+	case format == "Not documented":
+		result.Found = true
+	default:
+		result.Found = true
+		result.Text = strings.TrimSpace(text)
+	}
+
+	r.docs.put(key, result)
+	return result, nil
+}
+
+// Lookfor searches the help of every function on the path for a keyword.
+// Results are cached.
+func (r *Runner) Lookfor(ctx context.Context, keyword string, opts ExecOptions) (*LookforResult, error) {
+	keyword = strings.TrimSpace(keyword)
+	if !lookforKeywordRe.MatchString(keyword) {
+		return nil, fmt.Errorf("invalid keyword: %q (letters, digits, spaces, '_', '-' and '.', up to 64 characters)", keyword)
+	}
+	key := r.version + "\x00lookfor\x00" + strings.ToLower(keyword)
+	if cached, ok := r.docs.get(key); ok {
+		return cached.(*LookforResult), nil
+	}
+
+	out, err := r.runWrapper(ctx, "lookfor.txt", func(dir string) string {
+		return fmt.Sprintf(lookforScript, octaveString(dir), keyword, maxLookforMatches)
+	}, docLookupTimeout, opts)
+	if err != nil {
+		return nil, fmt.Errorf("lookfor failed: %w", err)
+	}
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	total, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return nil, fmt.Errorf("lookfor failed: unexpected output %q", lines[0])
+	}
+	result := &LookforResult{Keyword: keyword, Version: r.version}
+	for _, line := range lines[1:] {
+		name, summary, _ := strings.Cut(line, "\t")
+		result.Matches = append(result.Matches, LookforMatch{Name: name, Summary: strings.TrimSpace(summary)})
+	}
+	result.Omitted = total - len(result.Matches)
+
+	r.docs.put(key, result)
+	return result, nil
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDocCache(t *testing.T) {
+	var c docCache
+	if _, ok := c.get("missing"); ok {
+		t.Error("Expected a miss on an empty cache")
+	}
+	for i := range maxDocCacheEntries + 10 {
+		c.put(fmt.Sprint(i), i)
+	}
+	if len(c.entries) != maxDocCacheEntries {
+		t.Errorf("Expected %d entries, got %d", maxDocCacheEntries, len(c.entries))
+	}
+	if v, ok := c.get(fmt.Sprint(maxDocCacheEntries + 9)); !ok || v != maxDocCacheEntries+9 {
+		t.Errorf("Expected the last entry to be kept, got %v", v)
+	}
+}
+
+func TestDocNames(t *testing.T) {
+	for _, name := range []string{"sin", "ode45", "containers.Map", "a_b"} {
+		if !functionNameRe.MatchString(name) {
+			t.Errorf("Expected %q to be a valid function name", name)
+		}
+	}
+	for _, name := range []string{"", "1abc", `sin"); system("ls`, "a b", "a..b"} {
+		if functionNameRe.MatchString(name) {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+	for _, keyword := range []string{"fourier transform", "ode-45", "x.y"} {
+		if !lookforKeywordRe.MatchString(keyword) {
+			t.Errorf("Expected %q to be a valid keyword", keyword)
+		}
+	}
+	for _, keyword := range []string{"", `a"b`, "a\nb"} {
+		if lookforKeywordRe.MatchString(keyword) {
+			t.Errorf("Expected %q to be rejected", keyword)
+		}
+	}
+}
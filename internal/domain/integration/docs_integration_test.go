@@ -0,0 +1,59 @@
+package integration_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestDocs_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	t.Run("Help", func(t *testing.T) {
+		help, err := runner.Help(ctx, "linspace", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !help.Found || !strings.Contains(help.Text, "linspace") || help.Version != runner.GetVersion() {
+			t.Errorf("Unexpected help: %+v", help)
+		}
+		cached, err := runner.Help(ctx, "linspace", domain.ExecOptions{})
+		if err != nil || cached != help {
+			t.Errorf("Expected the cached result, got %p (%v)", cached, err)
+		}
+	})
+
+	t.Run("MATLAB only", func(t *testing.T) {
+		help, err := runner.Help(ctx, "no_such_function_anywhere", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if help.Found || help.Package != "" || help.Text != "" {
+			t.Errorf("Expected the function to be missing, got: %+v", help)
+		}
+	})
+
+	t.Run("Invalid name", func(t *testing.T) {
+		if _, err := runner.Help(ctx, `sin"); system("ls`, domain.ExecOptions{}); err == nil {
+			t.Error("Expected an invalid name to be rejected")
+		}
+	})
+
+	t.Run("Lookfor", func(t *testing.T) {
+		result, err := runner.Lookfor(ctx, "cosine", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, m := range result.Matches {
+			found = found || m.Name == "cos"
+		}
+		if !found {
+			t.Errorf("Expected cos among the matches, got: %+v", result.Matches)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package integration_test
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+// waitForJob polls a job until it reaches a final state
+func waitForJob(t *testing.T, q *domain.JobQueue, id string) domain.Job {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status.Finished() {
+			return job
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish in time", id)
+	return domain.Job{}
+}
+
+func TestJobQueue_Integration(t *testing.T) {
+	t.Setenv("OCTAVE_JOB_TIMEOUT", "2")
+	runner := domain.NewRunner()
+	defer runner.Close()
+	q := domain.NewJobQueue(runner, slog.Default())
+	defer q.Shutdown()
+
+	t.Run("Run job", func(t *testing.T) {
+		job, err := q.Submit(domain.JobRequest{Script: "x = 6 * 7; disp(x)", ReturnVars: []string{"x"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job = waitForJob(t, q, job.ID)
+		if job.Status != domain.JobSucceeded {
+			t.Fatalf("Expected job to succeed, got: %s %s", job.Status, job.Error)
+		}
+		job, err = q.Result(job.ID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Result.Output != "42" {
+			t.Errorf("Expected '42', got: %q", job.Result.Output)
+		}
+		if job.Result.Vars["x"] != float64(42) {
+			t.Errorf("Expected x = 42, got: %v", job.Result.Vars["x"])
+		}
+	})
+
+	t.Run("Plot job", func(t *testing.T) {
+		job, err := q.Submit(domain.JobRequest{Kind: domain.JobKindPlot, Script: "plot(1:10);", Format: "png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job = waitForJob(t, q, job.ID)
+		if job.Status != domain.JobSucceeded {
+			t.Fatalf("Expected job to succeed, got: %s %s", job.Status, job.Error)
+		}
+		validateImgData(t, job.Plot.Figures[0].Image, "png")
+	})
+
+	t.Run("Script error", func(t *testing.T) {
+		job, err := q.Submit(domain.JobRequest{Script: "undefined_function_xyz()"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job = waitForJob(t, q, job.ID)
+		if job.Status != domain.JobFailed {
+			t.Fatalf("Expected job to fail, got: %s", job.Status)
+		}
+		if !strings.Contains(job.Result.Output, "undefined") {
+			t.Errorf("Expected error output, got: %q", job.Result.Output)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		job, err := q.Submit(domain.JobRequest{Script: "pause(10)"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job = waitForJob(t, q, job.ID)
+		if job.Status != domain.JobFailed || !strings.Contains(job.Error, "timed out") {
+			t.Errorf("Expected timeout, got: %s %s", job.Status, job.Error)
+		}
+	})
+
+	t.Run("Cancel running job", func(t *testing.T) {
+		job, err := q.Submit(domain.JobRequest{Script: "pause(10)"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for job.Status == domain.JobQueued {
+			time.Sleep(10 * time.Millisecond)
+			if job, err = q.Get(job.ID, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+		job, err = q.Cancel(job.ID, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != domain.JobCancelled {
+			t.Errorf("Expected cancelled job, got: %s", job.Status)
+		}
+	})
+
+	t.Run("Unknown job", func(t *testing.T) {
+		if _, err := q.Result("missing", ""); !errors.Is(err, domain.ErrJobNotFound) {
+			t.Errorf("Expected ErrJobNotFound, got: %v", err)
+		}
+	})
+}
@@ -1,8 +1,13 @@
 package integration_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"image/gif"
+	"image/png"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -22,11 +27,11 @@ func TestGeneratePlot_Integration(t *testing.T) {
 	})
 
 	t.Run("Invalid format", func(t *testing.T) {
-		_, err := runner.GeneratePlot(ctx, "plot([1,2,3]);", "jpg")
+		_, err := runner.GeneratePlot(ctx, "plot([1,2,3]);", "bmp")
 		if err == nil {
 			t.Fatal("Expected error for invalid format")
 		}
-		expected := "unsupported format: jpg (must be png or svg)"
+		expected := "unsupported format: bmp (must be png, svg, jpg, pdf, eps, gif, vegalite or plotly)"
 		if err.Error() != expected {
 			t.Errorf("Expected error: %s, got: %s", expected, err.Error())
 		}
@@ -77,6 +82,201 @@ grid on;`
 
 		validateImgData(t, imgData, "png")
 	})
+
+	t.Run("Multiple figures", func(t *testing.T) {
+		script := `figure(1); plot(1:3); title('First');
+figure(2); subplot(2, 1, 1); plot(1:4); title('Top'); subplot(2, 1, 2); plot(4:-1:1); title('Bottom');
+figure(3); plot(1:5);`
+		result, err := runner.Plot(ctx, script, "png", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Figures) != 3 {
+			t.Fatalf("Expected 3 figures, got %d", len(result.Figures))
+		}
+		for _, fig := range result.Figures {
+			validateImgData(t, fig.Image, "png")
+		}
+		expected := [][]string{{"First"}, {"Top", "Bottom"}, nil}
+		for i, titles := range expected {
+			if !slices.Equal(result.Figures[i].Titles, titles) {
+				t.Errorf("Expected figure %d titles %q, got %q", i+1, titles, result.Figures[i].Titles)
+			}
+		}
+	})
+}
+
+func TestGeneratePlot_Formats_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	headers := map[string]string{
+		"jpg": "\xff\xd8\xff",
+		"pdf": "%PDF",
+		"eps": "%!PS",
+	}
+	for format, header := range headers {
+		t.Run(format, func(t *testing.T) {
+			result, err := runner.Plot(ctx, "plot(1:10);", format, domain.ExecOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img := result.Figures[0].Image; !bytes.HasPrefix(img, []byte(header)) {
+				t.Errorf("Expected %s data, got header %q", format, img[:min(len(img), 8)])
+			}
+		})
+	}
+
+	t.Run("Animation", func(t *testing.T) {
+		script := `x = linspace(0, 2*pi, 50);
+for k = 1:4
+  plot(x, sin(x + k));
+  drawnow;
+end`
+		result, err := runner.Plot(ctx, script, "gif", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Frames != 4 {
+			t.Errorf("Expected 4 frames, got %d", result.Frames)
+		}
+		anim, err := gif.DecodeAll(bytes.NewReader(result.Figures[0].Image))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(anim.Image) != 4 {
+			t.Errorf("Expected 4 GIF frames, got %d", len(anim.Image))
+		}
+
+		// drawnow is back to the builtin afterwards
+		if _, err := runner.Plot(ctx, "plot(1:3); drawnow;", "png", domain.ExecOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Animation without drawnow", func(t *testing.T) {
+		result, err := runner.Plot(ctx, "plot(1:3);", "gif", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Frames != 1 {
+			t.Errorf("Expected a single frame, got %d", result.Frames)
+		}
+	})
+}
+
+func TestGeneratePlot_Data_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	script := `subplot(1, 2, 1);
+plot(1:3, [2 4 8]);
+hold on;
+bar([1 2 3]);
+title('Growth');
+xlabel('n');
+legend('doubling', 'bars');
+subplot(1, 2, 2);
+surf(peaks(200));`
+	result, err := runner.Plot(ctx, script, "png", domain.ExecOptions{Plot: domain.PlotOptions{Data: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := result.Figures[0].Data
+	if data == nil || len(data.Axes) != 2 {
+		t.Fatalf("Expected data of 2 axes, got: %+v (warnings %q)", data, result.Warnings)
+	}
+
+	left := data.Axes[0]
+	if left.Title != "Growth" || left.XLabel != "n" {
+		t.Errorf("Unexpected labels: %+v", left)
+	}
+	if len(left.Series) != 2 || left.Series[0].Type != "line" || left.Series[1].Type != "bar" {
+		t.Fatalf("Expected a line and a bar series, got: %+v", left.Series)
+	}
+	if string(left.Series[0].YData) != "[2,4,8]" || left.Series[0].Label != "doubling" {
+		t.Errorf("Unexpected line series: %s %q", left.Series[0].YData, left.Series[0].Label)
+	}
+
+	surface := data.Axes[1].Series[0]
+	if surface.Type != "surface" || surface.Stride != 2 {
+		t.Errorf("Expected a surface sampled with stride 2, got: %s stride %d", surface.Type, surface.Stride)
+	}
+	var z [][]any
+	if err := json.Unmarshal(surface.ZData, &z); err != nil {
+		t.Fatal(err)
+	}
+	if len(z) != 100 || len(z[0]) != 100 {
+		t.Errorf("Expected 100x100 sampled data, got %dx%d", len(z), len(z[0]))
+	}
+}
+
+func TestGeneratePlot_ChartSpec_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	script := `semilogy(1:3, [10 100 1000]);
+hold on;
+patch([1 2 2], [10 10 100], 'r');
+title('Log');
+legend('growth');`
+	for _, format := range []string{domain.PlotFormatVegaLite, domain.PlotFormatPlotly} {
+		t.Run(format, func(t *testing.T) {
+			result, err := runner.Plot(ctx, script, format, domain.ExecOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Figures) != 1 || result.Figures[0].Data != nil {
+				t.Fatalf("Expected one figure without data, got: %+v", result.Figures)
+			}
+			var spec map[string]any
+			if err := json.Unmarshal(result.Figures[0].Image, &spec); err != nil {
+				t.Fatalf("Invalid spec %s: %v", result.Figures[0].Image, err)
+			}
+			text := string(result.Figures[0].Image)
+			for _, want := range []string{`"Log"`, `"growth"`, `"log"`} {
+				if !strings.Contains(text, want) {
+					t.Errorf("Expected spec to contain %s: %s", want, text)
+				}
+			}
+			if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "unsupported objects skipped: patch") {
+				t.Errorf("Unexpected warnings: %q", result.Warnings)
+			}
+		})
+	}
+}
+
+func TestGeneratePlot_Options_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	t.Run("Size", func(t *testing.T) {
+		opts := domain.ExecOptions{Plot: domain.PlotOptions{Width: 640, Height: 320, FontSize: 14, Theme: domain.PlotThemeDark}}
+		result, err := runner.Plot(ctx, "plot(1:10); title('Sized');", "png", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := result.Figures[0].Image
+		validateImgData(t, img, "png")
+		cfg, err := png.DecodeConfig(bytes.NewReader(img))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Width != 640 || cfg.Height != 320 {
+			t.Errorf("Expected a 640x320 image, got %dx%d", cfg.Width, cfg.Height)
+		}
+	})
+
+	t.Run("Out of bounds", func(t *testing.T) {
+		opts := domain.ExecOptions{Plot: domain.PlotOptions{Width: 50000, Height: 50000}}
+		if _, err := runner.Plot(ctx, "plot(1:10);", "png", opts); err == nil {
+			t.Fatal("Expected error for oversized image")
+		}
+	})
 }
 
 func testPlotGeneration(t *testing.T, runner domain.RunnerInterface, ctx context.Context, format string) {
@@ -0,0 +1,67 @@
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestOutputCaps_Integration(t *testing.T) {
+	t.Setenv("OCTAVE_OUTPUT_MAX_BYTES", "1000")
+	t.Setenv("OCTAVE_OUTPUT_MAX_LINES", "100")
+	t.Setenv("OCTAVE_SCRIPT_TIMEOUT", "30")
+
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	t.Run("Output over the cap keeps head and tail", func(t *testing.T) {
+		result, err := runner.Execute(ctx, `for i = 1:200, printf("line %d\n", i); end`, domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Truncated {
+			t.Error("Expected output to be truncated")
+		}
+		if !strings.HasPrefix(result.Output, "line 1\n") || !strings.HasSuffix(result.Output, "line 200") {
+			t.Errorf("Expected head and tail to be kept, got: %q", result.Output)
+		}
+		if !regexp.MustCompile(`\[\.\.\. \d+ bytes truncated \.\.\.\]`).MatchString(result.Output) {
+			t.Errorf("Expected truncation marker, got: %q", result.Output)
+		}
+		// "line 1\n" to "line 200\n"
+		if result.OutputBytes != 1892 {
+			t.Errorf("Expected 1892 bytes produced, got: %d", result.OutputBytes)
+		}
+	})
+
+	t.Run("Flooding scripts are killed early", func(t *testing.T) {
+		start := time.Now()
+		result, err := runner.Execute(ctx, "while true, disp(1); end", domain.ExecOptions{})
+		if !errors.Is(err, domain.ErrOutputLimit) {
+			t.Fatalf("Expected output limit error, got: %v", err)
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Errorf("Expected the script to be killed before the timeout, took %v", time.Since(start))
+		}
+		if !strings.HasPrefix(result.Output, "output limit exceeded") {
+			t.Errorf("Expected output to start with the limit, got: %q", result.Output)
+		}
+	})
+
+	t.Run("Return vars are not truncated", func(t *testing.T) {
+		result, err := runner.Execute(ctx, "x = 1:500;", domain.ExecOptions{ReturnVars: []string{"x"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		values, ok := result.Vars["x"].([]any)
+		if !ok || len(values) != 1 || len(values[0].([]any)) != 500 {
+			t.Errorf("Expected 1x500 matrix, got: %v", result.Vars["x"])
+		}
+	})
+}
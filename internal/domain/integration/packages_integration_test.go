@@ -0,0 +1,42 @@
+package integration_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestListPackages_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	packages, err := runner.ListPackages(ctx, domain.ExecOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range packages {
+		if p.Name == "" || p.Version == "" {
+			t.Errorf("Expected a name and a version, got: %+v", p)
+		}
+		if p.Allowed {
+			t.Errorf("Expected no package to be allowed by the default policy, got: %+v", p)
+		}
+	}
+
+	t.Run("Disallowed load", func(t *testing.T) {
+		_, err := runner.Execute(ctx, "x = 1;", domain.ExecOptions{Packages: []string{"signal"}})
+		if err == nil || !strings.Contains(err.Error(), "package signal is not allowed") {
+			t.Errorf("Expected the package to be rejected, got: %v", err)
+		}
+	})
+
+	t.Run("Install blocked", func(t *testing.T) {
+		_, err := runner.Execute(ctx, "pkg install -forge signal", domain.ExecOptions{})
+		if err == nil || !strings.Contains(err.Error(), "pkg install is not allowed") {
+			t.Errorf("Expected pkg install to be rejected, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestWorkerPool_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	t.Run("Workspace is cleared between executions", func(t *testing.T) {
+		if _, err := runner.ExecuteScript(ctx, "leaked_var = 1;"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			result, err := runner.ExecuteScript(ctx, `disp(exist("leaked_var"))`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != "0" {
+				t.Errorf("Expected variable to be cleared, exist() returned %q", result)
+			}
+		}
+	})
+
+	t.Run("Failed execution does not affect the next one", func(t *testing.T) {
+		if _, err := runner.ExecuteScript(ctx, "error('boom')"); err == nil {
+			t.Fatal("Expected error")
+		}
+		result, err := runner.ExecuteScript(ctx, "disp(1 + 1)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != "2" {
+			t.Errorf("Expected '2', got: %q", result)
+		}
+	})
+
+	t.Run("Sequential executions", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			result, err := runner.ExecuteScript(ctx, fmt.Sprintf("disp(%d)", i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != fmt.Sprint(i) {
+				t.Errorf("Expected %d, got: %q", i, result)
+			}
+		}
+	})
+}
+
+func TestWorkerPool_Recycling(t *testing.T) {
+	t.Setenv("OCTAVE_CONCURRENCY_LIMIT", "1")
+	t.Setenv("OCTAVE_WORKER_MAX_EXECUTIONS", "3")
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	t.Run("Workers serve several executions", func(t *testing.T) {
+		served := map[string]int{}
+		for i := 0; i < 9; i++ {
+			// Leave time for the reset so the worker is back in the pool
+			time.Sleep(500 * time.Millisecond)
+			pid, err := runner.ExecuteScript(ctx, "disp(getpid())")
+			if err != nil {
+				t.Fatal(err)
+			}
+			served[pid]++
+		}
+		reused := false
+		for pid, n := range served {
+			if n > 3 {
+				t.Errorf("Expected worker %s to be recycled after 3 executions, it served %d", pid, n)
+			}
+			reused = reused || n > 1
+		}
+		if !reused || len(served) < 2 {
+			t.Errorf("Expected workers to be reused, then recycled: %v", served)
+		}
+	})
+
+	t.Run("Reset clears the interpreter state", func(t *testing.T) {
+		time.Sleep(500 * time.Millisecond)
+		if _, err := runner.ExecuteScript(ctx, "global leaked_global = 1; function leaked_fn()\nend\nformat long"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(500 * time.Millisecond)
+		result, err := runner.ExecuteScript(ctx, `printf("%d %d ", exist("leaked_global"), exist("leaked_fn")); disp(pi)`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != "0 0 3.1416" {
+			t.Errorf("Expected a clean interpreter, got: %q", result)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestResourceLimits_Integration(t *testing.T) {
+	t.Setenv("OCTAVE_RLIMIT_AS", "2048")
+	t.Setenv("OCTAVE_RLIMIT_CPU", "1")
+	t.Setenv("OCTAVE_SCRIPT_TIMEOUT", "30")
+	t.Setenv("OCTAVE_CONCURRENCY_LIMIT", "1")
+
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	t.Run("Memory limit", func(t *testing.T) {
+		result, err := runner.ExecuteScript(ctx, "x = zeros(1e5);")
+		if !errors.Is(err, domain.ErrMemoryLimit) {
+			t.Fatalf("Expected memory limit error, got: %v", err)
+		}
+		if !strings.HasPrefix(result, "memory limit exceeded") {
+			t.Errorf("Expected output to start with the limit, got: %q", result)
+		}
+	})
+
+	t.Run("CPU limit", func(t *testing.T) {
+		_, err := runner.ExecuteScript(ctx, "while true; end")
+		if !errors.Is(err, domain.ErrCPULimit) {
+			t.Fatalf("Expected cpu limit error, got: %v", err)
+		}
+	})
+
+	t.Run("Limits are per execution", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if _, err := runner.ExecuteScript(ctx, "x = sum(rand(1, 1e5));"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestCPUUsage_Integration(t *testing.T) {
+	t.Setenv("OCTAVE_RLIMIT_CPU", "1")
+	t.Setenv("OCTAVE_SCRIPT_TIMEOUT", "30")
+
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	var usage []time.Duration
+	opts := domain.ExecOptions{OnUsage: func(cpu time.Duration) { usage = append(usage, cpu) }}
+
+	if _, err := runner.Execute(ctx, "tic; while toc < 0.5; end", opts); err != nil {
+		t.Fatal(err)
+	}
+	// A killed interpreter is charged as well
+	if _, err := runner.Execute(ctx, "while true; end", opts); !errors.Is(err, domain.ErrCPULimit) {
+		t.Fatalf("Expected cpu limit error, got: %v", err)
+	}
+
+	if len(usage) != 2 {
+		t.Fatalf("Expected 2 usage reports, got %v", usage)
+	}
+	if usage[0] < 300*time.Millisecond || usage[0] > 5*time.Second {
+		t.Errorf("Expected about 0.5 s of CPU for the busy loop, got %v", usage[0])
+	}
+	if usage[1] < 900*time.Millisecond {
+		t.Errorf("Expected at least the 1 s limit for the killed loop, got %v", usage[1])
+	}
+}
+
+func TestCPUBudget_Integration(t *testing.T) {
+	t.Setenv("OCTAVE_SCRIPT_TIMEOUT", "30")
+
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	budget := time.Second
+	opts := domain.ExecOptions{CPUBudget: func() time.Duration { return budget }}
+
+	start := time.Now()
+	if _, err := runner.Execute(ctx, "while true; end", opts); err == nil {
+		t.Fatal("Expected the execution to stop at the budget")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the timeout to be capped at the 1 s budget, took %v", elapsed)
+	}
+
+	budget = 0
+	if _, err := runner.Execute(ctx, "x = 1;", opts); !errors.Is(err, domain.ErrCPUBudget) {
+		t.Errorf("Expected cpu budget error, got: %v", err)
+	}
+}
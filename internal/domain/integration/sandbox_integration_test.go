@@ -0,0 +1,96 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestSandbox_Integration(t *testing.T) {
+	// Allow the network and file functions so only the sandbox stands in the way
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyFile, []byte(`{"deny": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OCTAVE_POLICY_FILE", policyFile)
+	t.Setenv("OCTAVE_SANDBOX", domain.SandboxNamespaces)
+	t.Setenv("OCTAVE_CONCURRENCY_LIMIT", "2")
+
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	t.Run("Writes outside the sandbox are denied", func(t *testing.T) {
+		hostDir := t.TempDir()
+		for _, path := range []string{filepath.Join(hostDir, "escaped.txt"), "/etc/octave-mcp-sandbox.txt"} {
+			script := fmt.Sprintf(`fid = fopen("%s", "w"); disp(fid)`, path)
+			result, err := runner.ExecuteScript(ctx, script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != "-1" {
+				t.Errorf("Expected fopen of %s to fail, got: %q", path, result)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(hostDir, "escaped.txt")); !os.IsNotExist(err) {
+			t.Error("Expected no file to be created on the host")
+		}
+	})
+
+	t.Run("Writes inside the sandbox home work", func(t *testing.T) {
+		script := `fid = fopen("inside.txt", "w"); fprintf(fid, "ok"); fclose(fid); disp(fileread("inside.txt")); disp(strcmp(getenv("HOME"), pwd()))`
+		result, err := runner.ExecuteScript(ctx, script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != "ok\n1" {
+			t.Errorf("Expected 'ok\\n1', got: %q", result)
+		}
+	})
+
+	t.Run("Network access is denied", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			fmt.Fprint(w, "leaked")
+		}))
+		defer server.Close()
+
+		script := fmt.Sprintf(`[s, ok] = urlread("%s"); disp(ok)`, server.URL)
+		result, err := runner.ExecuteScript(ctx, script)
+		if err == nil && result != "0" {
+			t.Errorf("Expected urlread to fail, got: %q", result)
+		}
+		if strings.Contains(result, "leaked") || requests.Load() != 0 {
+			t.Error("Expected no request to reach the host")
+		}
+	})
+
+	t.Run("Interpreter runs in its own PID namespace", func(t *testing.T) {
+		result, err := runner.ExecuteScript(ctx, "disp(getpid())")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != "1" {
+			t.Errorf("Expected pid 1, got: %q", result)
+		}
+	})
+
+	t.Run("Plots are returned from the sandbox", func(t *testing.T) {
+		imgData, err := runner.GeneratePlot(ctx, "plot([1 2 3], [4 5 6]);", "png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(imgData) == 0 {
+			t.Error("Expected image data")
+		}
+	})
+}
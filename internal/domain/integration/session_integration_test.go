@@ -0,0 +1,84 @@
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestSession_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	created, err := runner.CreateSession(ctx, "test-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("Expected a new session to be created")
+	}
+
+	t.Run("Create is idempotent", func(t *testing.T) {
+		created, err := runner.CreateSession(ctx, "test-session")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created {
+			t.Error("Expected existing session to be reused")
+		}
+	})
+
+	t.Run("Variables persist", func(t *testing.T) {
+		opts := domain.ExecOptions{SessionID: "test-session"}
+		if _, err := runner.Execute(ctx, "x = 21;", opts); err != nil {
+			t.Fatal(err)
+		}
+		result, err := runner.Execute(ctx, "disp(x * 2)", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Output != "42" {
+			t.Errorf("Expected '42', got: %q", result.Output)
+		}
+	})
+
+	t.Run("Errors keep the session alive", func(t *testing.T) {
+		opts := domain.ExecOptions{SessionID: "test-session"}
+		result, err := runner.Execute(ctx, "undefined_function_xyz()", opts)
+		if err == nil {
+			t.Fatal("Expected error for undefined function")
+		}
+		if !strings.Contains(result.Output, "undefined") {
+			t.Errorf("Expected error output, got: %q", result.Output)
+		}
+		result, err = runner.Execute(ctx, "disp(x)", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Output != "21" {
+			t.Errorf("Expected '21', got: %q", result.Output)
+		}
+	})
+
+	t.Run("Plot in session", func(t *testing.T) {
+		result, err := runner.Plot(ctx, "plot(1:x);", "png", domain.ExecOptions{SessionID: "test-session"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		validateImgData(t, result.Figures[0].Image, "png")
+	})
+
+	t.Run("Closed session", func(t *testing.T) {
+		if err := runner.CloseSession("test-session"); err != nil {
+			t.Fatal(err)
+		}
+		_, err := runner.Execute(ctx, "disp(x)", domain.ExecOptions{SessionID: "test-session"})
+		if !errors.Is(err, domain.ErrSessionNotFound) {
+			t.Errorf("Expected ErrSessionNotFound, got: %v", err)
+		}
+	})
+}
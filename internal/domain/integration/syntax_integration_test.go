@@ -0,0 +1,58 @@
+package integration_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestCheckSyntax_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	t.Run("Valid", func(t *testing.T) {
+		// Parsing must not evaluate, the error would otherwise stop the check
+		check, err := runner.CheckSyntax(ctx, "x = 1;\nerror('evaluated');\nfunction y = f(x)\n  y = 2 * x;\nend", "", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !check.Valid() {
+			t.Errorf("Expected a valid script, got: %+v", check)
+		}
+	})
+
+	t.Run("Parse error", func(t *testing.T) {
+		check, err := runner.CheckSyntax(ctx, "x = 1;\nif x > 0\n  y = x +* 2;\nend", "", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(check.SyntaxErrors) != 1 || check.SyntaxErrors[0].Line != 3 {
+			t.Errorf("Expected a syntax error on line 3, got: %+v", check.SyntaxErrors)
+		}
+	})
+
+	t.Run("Syntax error and violation", func(t *testing.T) {
+		check, err := runner.CheckSyntax(ctx, "system('ls');\nfor i = 1:3\n  disp(i)", domain.ToolGeneratePlot, domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(check.SyntaxErrors) != 1 {
+			t.Errorf("Expected a syntax error for the missing end, got: %+v", check.SyntaxErrors)
+		}
+		if len(check.Violations) != 1 || check.Violations[0].Function != "system" || check.Violations[0].Line != 1 {
+			t.Errorf("Expected the system call to be reported, got: %+v", check.Violations)
+		}
+	})
+
+	t.Run("Tokenizer error", func(t *testing.T) {
+		check, err := runner.CheckSyntax(ctx, "x = 'unterminated", "", domain.ExecOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(check.SyntaxErrors) != 1 || check.SyntaxErrors[0].Message != "unterminated string" {
+			t.Errorf("Expected an unterminated string error, got: %+v", check.SyntaxErrors)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package integration_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestReturnVars_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	script := `A = [1 2 3; 4 5 6];
+b = [1; 2];
+z = 1 + 2i;
+n = [NaN Inf -Inf];
+s.name = "octave";
+s.value = 42;
+c = {1, "two"};
+disp("done")`
+
+	result, err := runner.Execute(ctx, script, domain.ExecOptions{
+		ReturnVars: []string{"A", "b", "z", "n", "s", "c", "undefined_var"},
+	})
+	if err != nil {
+		t.Fatalf("%v: %s", err, result.Output)
+	}
+	if result.Output != "done" {
+		t.Errorf("Expected script output 'done', got: %q", result.Output)
+	}
+
+	want := map[string]string{
+		"A":             `[[1,2,3],[4,5,6]]`,
+		"b":             `[[1],[2]]`,
+		"z":             `{"im":2,"re":1}`,
+		"n":             `[["NaN","Infinity","-Infinity"]]`,
+		"s":             `{"name":"octave","value":42}`,
+		"c":             `[[1,"two"]]`,
+		"undefined_var": `null`,
+	}
+	for name, expected := range want {
+		got, err := json.Marshal(result.Vars[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Errorf("%s: expected %s, got: %s", name, expected, got)
+		}
+	}
+
+	// return skips the code printing the variables
+	result, err = runner.Execute(ctx, "x = 1;\ndisp(\"early\")\nreturn", domain.ExecOptions{ReturnVars: []string{"x"}})
+	if err == nil || !strings.Contains(err.Error(), "return_vars could not be collected") {
+		t.Fatalf("Expected return_vars to be reported as not collected, got: %v", err)
+	}
+	if !strings.Contains(result.Output, "early") {
+		t.Errorf("Expected the script output to be kept, got: %q", result.Output)
+	}
+}
+
+func TestVariables_Integration(t *testing.T) {
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	if _, err := runner.CreateSession(ctx, "vars"); err != nil {
+		t.Fatal(err)
+	}
+	opts := domain.ExecOptions{SessionID: "vars"}
+
+	if _, err := runner.Execute(ctx, "A = [1 2; 3 4];\nname = \"octave\";\nbig = zeros(1, 20000);", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := runner.Variables(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]domain.VariableInfo{}
+	for _, v := range vars {
+		byName[v.Name] = v
+	}
+	if len(byName) != 3 {
+		t.Fatalf("Expected 3 variables, got %+v", vars)
+	}
+
+	a := byName["A"]
+	if a.Class != "double" || len(a.Size) != 2 || a.Size[0] != 2 || a.Size[1] != 2 {
+		t.Errorf("Unexpected A: %+v", a)
+	}
+	got, err := json.Marshal(a.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `[[1,2],[3,4]]` {
+		t.Errorf("Expected A value [[1,2],[3,4]], got %s", got)
+	}
+	if byName["name"].Class != "char" || byName["name"].Value != "octave" {
+		t.Errorf("Unexpected name: %+v", byName["name"])
+	}
+	if big := byName["big"]; !big.Omitted || big.Value != nil {
+		t.Errorf("Expected the value of big to be omitted, got %+v", big)
+	}
+
+	// The snapshot leaves the session as it was
+	result, err := runner.Execute(ctx, "disp(numel(who()))", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "3" {
+		t.Errorf("Expected 3 variables after the snapshot, got %q", result.Output)
+	}
+
+	if _, err := runner.Variables(ctx, domain.ExecOptions{}); err == nil {
+		t.Error("Expected an error without a session")
+	}
+}
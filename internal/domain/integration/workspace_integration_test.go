@@ -0,0 +1,66 @@
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+)
+
+func TestSessionWorkspace_Integration(t *testing.T) {
+	t.Setenv("OCTAVE_WORKSPACE_MAX_BYTES", "100000")
+	runner := domain.NewRunner()
+	defer runner.Close()
+	ctx := context.Background()
+
+	if _, err := runner.CreateSession(ctx, "files"); err != nil {
+		t.Fatal(err)
+	}
+	opts := domain.ExecOptions{SessionID: "files"}
+
+	if _, err := runner.UploadFile("files", "in.csv", []byte("1,2\n3,4\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Read and write", func(t *testing.T) {
+		result, err := runner.Execute(ctx, "m = csvread('in.csv');\nsave -text out.txt m\ndisp(sum(m(:)))", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Output != "10" {
+			t.Errorf("Expected 10, got %q", result.Output)
+		}
+		data, err := runner.ReadFile("files", "out.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "# name: m") {
+			t.Errorf("Unexpected saved file %q", data)
+		}
+	})
+
+	t.Run("Outside the workspace", func(t *testing.T) {
+		_, err := runner.Execute(ctx, "x = load('/etc/hostname');", opts)
+		if err == nil || !strings.Contains(err.Error(), "rule workspace") {
+			t.Errorf("Expected the path to be rejected, got: %v", err)
+		}
+	})
+
+	t.Run("Quota", func(t *testing.T) {
+		_, err := runner.Execute(ctx, "x = rand(200); save('big.mat', 'x');", opts)
+		if !errors.Is(err, domain.ErrWorkspaceQuota) {
+			t.Errorf("Expected the quota to be exceeded, got: %v", err)
+		}
+		if err := runner.DeleteFile("files", "big.mat"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Without a session", func(t *testing.T) {
+		if _, err := runner.Execute(ctx, "x = load('in.csv');", domain.ExecOptions{}); err == nil {
+			t.Error("Expected load to be denied outside a session")
+		}
+	})
+}
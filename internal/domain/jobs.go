@@ -0,0 +1,445 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultJobConcurrency      = 2
+	defaultJobTimeoutSeconds   = 600
+	defaultJobRetentionSeconds = 3600
+	defaultMaxJobs             = 100
+	defaultMaxJobsPerOwner     = 20
+)
+
+var (
+	// ErrJobNotFound is returned for unknown or expired job IDs
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotFinished is returned when asking for the result of a job that
+	// is still queued or running
+	ErrJobNotFinished = errors.New("job has not finished")
+	// ErrTooManyJobs is returned when the job cap has been reached
+	ErrTooManyJobs = errors.New("maximum number of jobs reached")
+)
+
+// JobKind selects what a job runs
+type JobKind string
+
+const (
+	// JobKindRun runs a script like run_octave
+	JobKindRun JobKind = "run"
+	// JobKindPlot renders a plot like generate_plot
+	JobKindPlot JobKind = "plot"
+)
+
+// JobStatus is the lifecycle state of a job
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Finished reports whether the job reached a final state
+func (s JobStatus) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// JobRequest describes the work submitted as a job
+type JobRequest struct {
+	// Owner identifies the submitter, only the same owner can see, fetch or
+	// cancel the job
+	Owner  string
+	Kind   JobKind
+	Script string
+	// Format is the image format of plot jobs
+	Format string
+	// Plot sets the size and style of the figures of plot jobs
+	Plot PlotOptions
+	// ReturnVars lists the variables returned by run jobs
+	ReturnVars []string
+	// Packages lists the Octave packages loaded before the script runs
+	Packages []string
+	// OnUsage, when set, receives the CPU time of the job, see ExecOptions
+	OnUsage func(cpu time.Duration)
+	// CPUBudget, when set, caps the timeout of the job, see ExecOptions
+	CPUBudget func() time.Duration
+}
+
+// Job is a snapshot of a submitted job
+type Job struct {
+	ID          string
+	Kind        JobKind
+	Status      JobStatus
+	SubmittedAt time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	// ExpiresAt is when a finished job is discarded
+	ExpiresAt time.Time
+	// Error describes why a failed job failed
+	Error string
+	// Result holds the output of run jobs, and the script output of failed
+	// plot jobs
+	Result *ExecResult
+	// Plot holds the figures of plot jobs
+	Plot   *PlotResult
+	Format string
+}
+
+type job struct {
+	Job
+	request JobRequest
+	cancel  context.CancelFunc
+	// done is closed once the job reached a final state
+	done chan struct{}
+}
+
+// JobQueue runs scripts in the background so that computations can outlive a
+// single tool call. It has its own concurrency limit and timeout, separate
+// from interactive executions, and keeps finished jobs for a retention period.
+type JobQueue struct {
+	logger    *slog.Logger
+	runner    *Runner
+	semaphore chan struct{}
+	timeout   time.Duration
+	retention time.Duration
+	maxJobs   int
+	// maxPerOwner caps the jobs of a single owner, retained ones included
+	maxPerOwner int
+
+	mu       sync.Mutex
+	jobs     map[string]*job
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewJobQueue(runner *Runner, logger *slog.Logger) *JobQueue {
+	// Configure job concurrency (default: 2)
+	concurrency := defaultJobConcurrency
+	if limitStr := os.Getenv("OCTAVE_JOB_CONCURRENCY"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
+			concurrency = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_JOB_CONCURRENCY, using default", "value", limitStr)
+		}
+	}
+
+	// Configure per-job timeout (default: 600 seconds)
+	timeout := defaultJobTimeoutSeconds
+	if timeoutStr := os.Getenv("OCTAVE_JOB_TIMEOUT"); timeoutStr != "" {
+		if t, err := strconv.Atoi(timeoutStr); err == nil && t > 0 {
+			timeout = t
+		} else {
+			logger.Warn("Invalid OCTAVE_JOB_TIMEOUT, using default", "value", timeoutStr)
+		}
+	}
+
+	// Configure retention of finished jobs (default: 3600 seconds)
+	retention := defaultJobRetentionSeconds
+	if retentionStr := os.Getenv("OCTAVE_JOB_RETENTION"); retentionStr != "" {
+		if r, err := strconv.Atoi(retentionStr); err == nil && r > 0 {
+			retention = r
+		} else {
+			logger.Warn("Invalid OCTAVE_JOB_RETENTION, using default", "value", retentionStr)
+		}
+	}
+
+	// Configure job cap, queued, running and retained jobs count (default: 100)
+	maxJobs := defaultMaxJobs
+	if limitStr := os.Getenv("OCTAVE_MAX_JOBS"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit >= 0 {
+			maxJobs = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_MAX_JOBS, using default", "value", limitStr)
+		}
+	}
+
+	// Configure job cap per owner (default: 20)
+	maxPerOwner := defaultMaxJobsPerOwner
+	if limitStr := os.Getenv("OCTAVE_MAX_JOBS_PER_OWNER"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit >= 0 {
+			maxPerOwner = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_MAX_JOBS_PER_OWNER, using default", "value", limitStr)
+		}
+	}
+
+	q := &JobQueue{
+		logger:      logger,
+		runner:      runner,
+		semaphore:   make(chan struct{}, concurrency),
+		timeout:     time.Duration(timeout) * time.Second,
+		retention:   time.Duration(retention) * time.Second,
+		maxJobs:     maxJobs,
+		maxPerOwner: maxPerOwner,
+		jobs:        make(map[string]*job),
+		stop:        make(chan struct{}),
+	}
+	go q.reapLoop()
+	return q
+}
+
+// Timeout returns the per-job timeout
+func (q *JobQueue) Timeout() time.Duration {
+	return q.timeout
+}
+
+// Submit validates the request and queues it. Invalid scripts are rejected
+// right away instead of producing a failed job.
+func (q *JobQueue) Submit(req JobRequest) (Job, error) {
+	if err := q.validate(&req); err != nil {
+		return Job{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case <-q.stop:
+		return Job{}, errors.New("job queue is shut down")
+	default:
+	}
+	if len(q.jobs) >= q.maxJobs || q.ownedLocked(req.Owner) >= q.maxPerOwner {
+		q.reapLocked(time.Now())
+		if len(q.jobs) >= q.maxJobs {
+			return Job{}, fmt.Errorf("%w (%d)", ErrTooManyJobs, q.maxJobs)
+		}
+		if q.ownedLocked(req.Owner) >= q.maxPerOwner {
+			return Job{}, fmt.Errorf("%w for this caller (%d)", ErrTooManyJobs, q.maxPerOwner)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		Job: Job{
+			ID:          uuid.NewString(),
+			Kind:        req.Kind,
+			Status:      JobQueued,
+			SubmittedAt: time.Now(),
+			Format:      req.Format,
+		},
+		request: req,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	q.jobs[j.ID] = j
+	q.wg.Add(1)
+	go q.run(ctx, j)
+
+	q.logger.Info("Job submitted", "job_id", j.ID, "kind", j.Kind)
+	return j.Job, nil
+}
+
+// ownedLocked counts the jobs of owner, q.mu must be held
+func (q *JobQueue) ownedLocked(owner string) int {
+	n := 0
+	for _, j := range q.jobs {
+		if j.request.Owner == owner {
+			n++
+		}
+	}
+	return n
+}
+
+// validate applies the same checks as the synchronous tools
+func (q *JobQueue) validate(req *JobRequest) error {
+	if req.Script == "" {
+		return fmt.Errorf("script cannot be empty")
+	}
+	if err := q.runner.policy.CheckPackages(req.Packages); err != nil {
+		return err
+	}
+	switch req.Kind {
+	case "", JobKindRun:
+		req.Kind = JobKindRun
+		if err := q.runner.policy.Validate(ToolRunOctave, req.Script); err != nil {
+			return fmt.Errorf("invalid script: %w", err)
+		}
+		return validateReturnVars(req.ReturnVars)
+	case JobKindPlot:
+		req.Format = strings.ToLower(req.Format)
+		if err := validatePlotFormat(req.Format); err != nil {
+			return err
+		}
+		if err := req.Plot.validate(req.Format); err != nil {
+			return err
+		}
+		if err := q.runner.policy.Validate(ToolGeneratePlot, req.Script); err != nil {
+			return fmt.Errorf("invalid script: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported job kind: %s (must be %s or %s)", req.Kind, JobKindRun, JobKindPlot)
+	}
+}
+
+// run waits for a slot, executes the job and records its outcome
+func (q *JobQueue) run(ctx context.Context, j *job) {
+	defer q.wg.Done()
+	defer j.cancel()
+
+	select {
+	case q.semaphore <- struct{}{}:
+	case <-ctx.Done():
+		q.finish(j, nil, nil, ctx.Err())
+		return
+	}
+	defer func() {
+		<-q.semaphore
+	}()
+
+	q.mu.Lock()
+	j.Status = JobRunning
+	j.StartedAt = time.Now()
+	q.mu.Unlock()
+	q.logger.Debug("Job started", "job_id", j.ID)
+
+	opts := ExecOptions{
+		ReturnVars: j.request.ReturnVars,
+		Plot:       j.request.Plot,
+		Packages:   j.request.Packages,
+		Timeout:    q.timeout,
+		OnUsage:    j.request.OnUsage,
+		CPUBudget:  j.request.CPUBudget,
+	}
+	switch j.request.Kind {
+	case JobKindPlot:
+		plot, err := q.runner.plot(ctx, j.request.Script, j.request.Format, opts)
+		q.finish(j, nil, plot, err)
+	default:
+		result, err := q.runner.execute(ctx, j.request.Script, opts)
+		q.finish(j, result, nil, err)
+	}
+}
+
+// finish records the outcome of a job and starts its retention period
+func (q *JobQueue) finish(j *job, result *ExecResult, plot *PlotResult, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	j.FinishedAt = now
+	j.ExpiresAt = now.Add(q.retention)
+	j.Result = result
+	j.Plot = plot
+	switch {
+	case err == nil:
+		j.Status = JobSucceeded
+	case errors.Is(err, context.Canceled):
+		j.Status = JobCancelled
+		j.Error = "job was cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		j.Status = JobFailed
+		j.Error = fmt.Sprintf("job timed out after %s", q.timeout)
+	default:
+		j.Status = JobFailed
+		j.Error = err.Error()
+	}
+	close(j.done)
+	q.logger.Info("Job finished", "job_id", j.ID, "status", j.Status)
+}
+
+// Get returns a snapshot of the job. Jobs of other owners are reported as
+// not found.
+func (q *JobQueue) Get(id, owner string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, err := q.lookupLocked(id, owner)
+	if err != nil {
+		return Job{}, err
+	}
+	return j.Job, nil
+}
+
+// lookupLocked finds a job of owner, q.mu must be held
+func (q *JobQueue) lookupLocked(id, owner string) (*job, error) {
+	j, ok := q.jobs[id]
+	if !ok || j.request.Owner != owner {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return j, nil
+}
+
+// Result returns the finished job, or ErrJobNotFinished while it is pending
+func (q *JobQueue) Result(id, owner string) (Job, error) {
+	j, err := q.Get(id, owner)
+	if err != nil {
+		return Job{}, err
+	}
+	if !j.Status.Finished() {
+		return j, fmt.Errorf("%w: %s is %s", ErrJobNotFinished, id, j.Status)
+	}
+	return j, nil
+}
+
+// Cancel stops a queued or running job. Cancelling a finished job is a no-op.
+func (q *JobQueue) Cancel(id, owner string) (Job, error) {
+	q.mu.Lock()
+	j, err := q.lookupLocked(id, owner)
+	q.mu.Unlock()
+	if err != nil {
+		return Job{}, err
+	}
+
+	// The running script is killed with its interpreter, wait for the
+	// outcome so the caller sees the final state
+	j.cancel()
+	<-j.done
+	return q.Get(id, owner)
+}
+
+func (q *JobQueue) reapLoop() {
+	interval := q.retention / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			q.mu.Lock()
+			q.reapLocked(now)
+			q.mu.Unlock()
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// reapLocked discards finished jobs whose retention period is over
+func (q *JobQueue) reapLocked(now time.Time) {
+	for id, j := range q.jobs {
+		if j.Status.Finished() && now.After(j.ExpiresAt) {
+			delete(q.jobs, id)
+			q.logger.Debug("Job expired", "job_id", id)
+		}
+	}
+}
+
+// Shutdown cancels every pending job and waits for them to stop
+func (q *JobQueue) Shutdown() {
+	q.stopOnce.Do(func() {
+		close(q.stop)
+	})
+
+	q.mu.Lock()
+	for _, j := range q.jobs {
+		j.cancel()
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestJobQueue returns a queue whose slots are all taken, so submitted
+// jobs stay queued and never reach an interpreter
+func newTestJobQueue(t *testing.T) *JobQueue {
+	t.Helper()
+	t.Setenv("OCTAVE_JOB_CONCURRENCY", "1")
+	t.Setenv("OCTAVE_MAX_JOBS", "2")
+	q := NewJobQueue(&Runner{policy: DefaultPolicy()}, slog.Default())
+	q.semaphore <- struct{}{}
+	t.Cleanup(q.Shutdown)
+	return q
+}
+
+func TestJobQueue_Submit(t *testing.T) {
+	q := newTestJobQueue(t)
+
+	tests := []struct {
+		name string
+		req  JobRequest
+		err  string
+	}{
+		{"empty script", JobRequest{}, "script cannot be empty"},
+		{"unknown kind", JobRequest{Kind: "eval", Script: "x = 1;"}, "unsupported job kind"},
+		{"plot format", JobRequest{Kind: JobKindPlot, Script: "plot(1:3);", Format: "bmp"}, "unsupported format"},
+		{"policy", JobRequest{Script: "system('ls')"}, "invalid script"},
+		{"return_vars", JobRequest{Script: "x = 1;", ReturnVars: []string{"1x"}}, "invalid variable name"},
+		{"packages", JobRequest{Script: "x = 1;", Packages: []string{"signal"}}, "package signal is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := q.Submit(tt.req)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got: %v", tt.err, err)
+			}
+		})
+	}
+
+	job, err := q.Submit(JobRequest{Script: "x = 1;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Kind != JobKindRun || job.Status != JobQueued {
+		t.Errorf("Expected queued run job, got: %s %s", job.Kind, job.Status)
+	}
+	if _, err := q.Result(job.ID, ""); !errors.Is(err, ErrJobNotFinished) {
+		t.Errorf("Expected ErrJobNotFinished, got: %v", err)
+	}
+
+	if _, err := q.Submit(JobRequest{Kind: JobKindPlot, Script: "plot(1:3);", Format: "PNG"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Submit(JobRequest{Script: "x = 1;"}); !errors.Is(err, ErrTooManyJobs) {
+		t.Errorf("Expected ErrTooManyJobs, got: %v", err)
+	}
+}
+
+func TestJobQueue_Cancel(t *testing.T) {
+	q := newTestJobQueue(t)
+
+	if _, err := q.Cancel("missing", ""); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got: %v", err)
+	}
+
+	job, err := q.Submit(JobRequest{Script: "x = 1;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = q.Cancel(job.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobCancelled || job.FinishedAt.IsZero() {
+		t.Errorf("Expected cancelled job, got: %+v", job)
+	}
+
+	// Cancelling again is a no-op
+	if again, err := q.Cancel(job.ID, ""); err != nil || again.Status != JobCancelled {
+		t.Errorf("Expected cancelled job, got: %+v, %v", again, err)
+	}
+	if _, err := q.Result(job.ID, ""); err != nil {
+		t.Errorf("Expected the result of a cancelled job, got: %v", err)
+	}
+}
+
+func TestJobQueue_Reap(t *testing.T) {
+	q := newTestJobQueue(t)
+
+	job, err := q.Submit(JobRequest{Script: "x = 1;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := q.Submit(JobRequest{Script: "x = 2;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err = q.Cancel(job.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	q.mu.Lock()
+	q.reapLocked(job.ExpiresAt.Add(time.Second))
+	q.mu.Unlock()
+
+	if _, err := q.Get(job.ID, ""); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected expired job to be gone, got: %v", err)
+	}
+	if _, err := q.Get(pending.ID, ""); err != nil {
+		t.Errorf("Expected pending job to be kept, got: %v", err)
+	}
+}
+
+func TestJobQueue_Owner(t *testing.T) {
+	t.Setenv("OCTAVE_MAX_JOBS_PER_OWNER", "1")
+	q := newTestJobQueue(t)
+
+	job, err := q.Submit(JobRequest{Owner: "apikey:alice", Script: "x = 1;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(job.ID, "apikey:alice"); err != nil {
+		t.Errorf("Expected the owner to see the job, got: %v", err)
+	}
+	if _, err := q.Get(job.ID, "apikey:bob"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound for another owner, got: %v", err)
+	}
+	if _, err := q.Result(job.ID, "apikey:bob"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound for another owner, got: %v", err)
+	}
+	if _, err := q.Cancel(job.ID, "apikey:bob"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound for another owner, got: %v", err)
+	}
+	if job, err := q.Get(job.ID, "apikey:alice"); err != nil || job.Status != JobQueued {
+		t.Errorf("Expected the job to stay queued, got: %+v, %v", job, err)
+	}
+
+	if _, err := q.Submit(JobRequest{Owner: "apikey:alice", Script: "x = 2;"}); !errors.Is(err, ErrTooManyJobs) {
+		t.Errorf("Expected ErrTooManyJobs for the owner, got: %v", err)
+	}
+	if _, err := q.Submit(JobRequest{Owner: "apikey:bob", Script: "x = 2;"}); err != nil {
+		t.Errorf("Expected other owners to submit, got: %v", err)
+	}
+}
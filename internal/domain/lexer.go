@@ -0,0 +1,769 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenKind classifies the tokens produced by the Octave lexer
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenKeyword
+	tokenNumber
+	tokenString
+	// tokenCommandArg is a word passed to a function called with command
+	// syntax, e.g. "ls" in `system ls`
+	tokenCommandArg
+	tokenOperator
+	tokenTranspose
+	tokenComment
+	tokenNewline
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenIdent:
+		return "identifier"
+	case tokenKeyword:
+		return "keyword"
+	case tokenNumber:
+		return "number"
+	case tokenString:
+		return "string"
+	case tokenCommandArg:
+		return "command argument"
+	case tokenOperator:
+		return "operator"
+	case tokenTranspose:
+		return "transpose"
+	case tokenComment:
+		return "comment"
+	case tokenNewline:
+		return "newline"
+	default:
+		return "unknown"
+	}
+}
+
+// token is a lexical element of an Octave script. Line and Column are
+// 1-based, columns count characters rather than bytes.
+type token struct {
+	Kind tokenKind
+	// Text is the source text of the token
+	Text string
+	// Value is the unquoted content of string and command argument tokens
+	Value  string
+	Line   int
+	Column int
+	// SpaceBefore is set when the token is preceded by whitespace
+	SpaceBefore bool
+}
+
+// SyntaxError describes a script that could not be tokenized
+type SyntaxError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+var octaveKeywords = map[string]bool{
+	"if": true, "elseif": true, "else": true, "end": true, "endif": true,
+	"for": true, "endfor": true, "parfor": true, "endparfor": true,
+	"while": true, "endwhile": true, "do": true, "until": true,
+	"switch": true, "case": true, "otherwise": true, "endswitch": true,
+	"function": true, "endfunction": true, "return": true,
+	"break": true, "continue": true,
+	"try": true, "catch": true, "end_try_catch": true,
+	"unwind_protect": true, "unwind_protect_cleanup": true, "end_unwind_protect": true,
+	"global": true, "persistent": true,
+	"classdef": true, "endclassdef": true, "methods": true, "endmethods": true,
+	"properties": true, "endproperties": true, "events": true, "endevents": true,
+	"enumeration": true, "endenumeration": true,
+}
+
+// octaveOperators is ordered so that longer operators match first
+var octaveOperators = []string{
+	"...",
+	"==", "~=", "!=", "<=", ">=", "&&", "||",
+	".*", "./", ".\\", ".^", "++", "--", "+=", "-=", "*=", "/=", "^=", "**",
+	"+", "-", "*", "/", "\\", "^", "<", ">", "=", "&", "|", "!", "~",
+	":", ",", ";", "(", ")", "[", "]", "{", "}", ".", "@",
+}
+
+// lexer turns Octave source into tokens. It understands comments (including
+// block comments), both string delimiters, the transpose operators, line
+// continuations and command syntax.
+type lexer struct {
+	src    string
+	pos    int
+	line   int
+	column int
+	tokens []token
+	// brackets is the stack of open (, [ and { delimiters
+	brackets []byte
+	// statementStart is set when the next token begins a new statement
+	statementStart bool
+	spaceBefore    bool
+	// stmtStart is the index in tokens of the first token of the statement
+	stmtStart int
+	// variables holds the names assigned so far. Like Octave, the lexer never
+	// treats a variable as a command.
+	variables map[string]bool
+	// keepsVariables is set when the script runs in a workspace holding
+	// variables from earlier calls, so any name may be a variable
+	keepsVariables bool
+}
+
+// neverCommands are the constants Octave never treats as commands, so that
+// `pi +1` is an addition
+var neverCommands = map[string]bool{
+	"e": true, "pi": true, "I": true, "i": true, "J": true, "j": true,
+	"Inf": true, "inf": true, "NaN": true, "nan": true,
+}
+
+// computedAssignments are the operators Octave treats as the start of command
+// syntax arguments whenever whitespace precedes them
+var computedAssignments = map[string]bool{
+	"+=": true, "-=": true, "*=": true, "/=": true, "^=": true,
+}
+
+// tokenize splits an Octave script into tokens
+func tokenize(src string) ([]token, error) {
+	return tokenizeScript(src, false)
+}
+
+// tokenizeScript splits an Octave script into tokens. keepsVariables is set
+// for scripts running in a session, whose workspace keeps the variables of
+// earlier calls: an identifier followed by an operator is then read as an
+// expression rather than as command syntax, as Octave does for variables.
+func tokenizeScript(src string, keepsVariables bool) ([]token, error) {
+	l := &lexer{
+		src:            src,
+		line:           1,
+		column:         1,
+		statementStart: true,
+		variables:      make(map[string]bool),
+		keepsVariables: keepsVariables,
+	}
+	if err := l.run(); err != nil {
+		return l.tokens, err
+	}
+	return l.tokens, nil
+}
+
+func (l *lexer) errorf(line, column int, format string, args ...any) *SyntaxError {
+	return &SyntaxError{Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset < len(l.src) {
+		return l.src[l.pos+offset]
+	}
+	return 0
+}
+
+// advance consumes n bytes, keeping track of line and column
+func (l *lexer) advance(n int) {
+	end := l.pos + n
+	for l.pos < end {
+		r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		l.pos += size
+		if r == '\n' {
+			l.line++
+			l.column = 1
+		} else {
+			l.column++
+		}
+	}
+}
+
+// consumeRune appends the current character to value and advances past it
+func (l *lexer) consumeRune(value *strings.Builder) {
+	_, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	value.WriteString(l.src[l.pos : l.pos+size])
+	l.advance(size)
+}
+
+func (l *lexer) emit(kind tokenKind, text, value string, line, column int) {
+	if l.statementStart {
+		l.stmtStart = len(l.tokens)
+	}
+	l.tokens = append(l.tokens, token{
+		Kind:        kind,
+		Text:        text,
+		Value:       value,
+		Line:        line,
+		Column:      column,
+		SpaceBefore: l.spaceBefore,
+	})
+	l.spaceBefore = false
+}
+
+// inMatrix reports whether the lexer is directly inside [] or {}, where
+// whitespace separates elements
+func (l *lexer) inMatrix() bool {
+	if len(l.brackets) == 0 {
+		return false
+	}
+	top := l.brackets[len(l.brackets)-1]
+	return top == '[' || top == '{'
+}
+
+// prevSignificant returns the last token that is not a comment
+func (l *lexer) prevSignificant() *token {
+	for i := len(l.tokens) - 1; i >= 0; i-- {
+		if l.tokens[i].Kind != tokenComment {
+			return &l.tokens[i]
+		}
+	}
+	return nil
+}
+
+// quoteIsTranspose decides whether a single quote is a transpose operator
+func (l *lexer) quoteIsTranspose() bool {
+	prev := l.prevSignificant()
+	if prev == nil || (l.spaceBefore && l.inMatrix()) {
+		return false
+	}
+	switch prev.Kind {
+	case tokenIdent, tokenNumber, tokenTranspose:
+		return true
+	case tokenKeyword:
+		return prev.Text == "end" && len(l.brackets) > 0
+	case tokenOperator:
+		return prev.Text == ")" || prev.Text == "]" || prev.Text == "}"
+	}
+	return false
+}
+
+func (l *lexer) run() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		line, column := l.line, l.column
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.advance(1)
+			l.spaceBefore = true
+
+		case c == '\n':
+			l.advance(1)
+			l.emit(tokenNewline, "\n", "", line, column)
+			if len(l.brackets) == 0 {
+				l.statementStart = true
+			}
+
+		case c == '%' || c == '#':
+			if l.atBlockCommentStart() {
+				if err := l.lexBlockComment(); err != nil {
+					return err
+				}
+				continue
+			}
+			l.lexLineComment()
+
+		case c == '.' && strings.HasPrefix(l.src[l.pos:], "..."):
+			// Continuation, the rest of the line is a comment
+			l.lexLineComment()
+			if l.pos < len(l.src) {
+				l.advance(1)
+			}
+			l.spaceBefore = true
+
+		case isIdentStart(c):
+			l.lexIdentifier()
+
+		case isDigit(c) || (c == '.' && isDigit(l.peek(1))):
+			l.lexNumber()
+			l.statementStart = false
+
+		case c == '"':
+			if err := l.lexDoubleQuoted(); err != nil {
+				return err
+			}
+			l.statementStart = false
+
+		case c == '\'':
+			if l.quoteIsTranspose() {
+				l.advance(1)
+				l.emit(tokenTranspose, "'", "", line, column)
+				continue
+			}
+			if err := l.lexSingleQuoted(); err != nil {
+				return err
+			}
+			l.statementStart = false
+
+		case c == '.' && l.peek(1) == '\'':
+			l.advance(2)
+			l.emit(tokenTranspose, ".'", "", line, column)
+
+		default:
+			if err := l.lexOperator(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(l.brackets) > 0 {
+		return l.errorf(l.line, l.column, "unbalanced '%c'", l.brackets[len(l.brackets)-1])
+	}
+	return nil
+}
+
+// atBlockCommentStart reports whether the current line is exactly %{ or #{
+func (l *lexer) atBlockCommentStart() bool {
+	if l.peek(1) != '{' {
+		return false
+	}
+	return l.lineIsOnly(l.pos, 2)
+}
+
+// lineIsOnly reports whether the line holding src[start:start+n] contains
+// nothing else but whitespace
+func (l *lexer) lineIsOnly(start, n int) bool {
+	lineStart := strings.LastIndexByte(l.src[:start], '\n') + 1
+	if strings.TrimSpace(l.src[lineStart:start]) != "" {
+		return false
+	}
+	rest := l.src[start+n:]
+	if end := strings.IndexByte(rest, '\n'); end >= 0 {
+		rest = rest[:end]
+	}
+	return strings.TrimSpace(rest) == ""
+}
+
+func (l *lexer) lexLineComment() {
+	line, column := l.line, l.column
+	end := strings.IndexByte(l.src[l.pos:], '\n')
+	if end < 0 {
+		end = len(l.src) - l.pos
+	}
+	text := l.src[l.pos : l.pos+end]
+	l.advance(end)
+	l.emit(tokenComment, text, "", line, column)
+}
+
+// lexBlockComment consumes a possibly nested %{ ... %} block
+func (l *lexer) lexBlockComment() error {
+	line, column := l.line, l.column
+	start := l.pos
+	depth := 0
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if (c == '%' || c == '#') && (l.peek(1) == '{' || l.peek(1) == '}') && l.lineIsOnly(l.pos, 2) {
+			if l.peek(1) == '{' {
+				depth++
+			} else {
+				depth--
+			}
+			l.advance(2)
+			if depth == 0 {
+				l.emit(tokenComment, l.src[start:l.pos], "", line, column)
+				return nil
+			}
+			continue
+		}
+		l.advance(1)
+	}
+	return l.errorf(line, column, "unterminated block comment")
+}
+
+func (l *lexer) lexIdentifier() {
+	line, column := l.line, l.column
+	end := l.pos
+	for end < len(l.src) && isIdentChar(l.src[end]) {
+		end++
+	}
+	name := l.src[l.pos:end]
+	l.advance(end - l.pos)
+
+	if octaveKeywords[name] {
+		l.emit(tokenKeyword, name, "", line, column)
+		// Keywords such as "if" and "else" are followed by a new statement
+		l.statementStart = name != "function" && name != "global" && name != "persistent" &&
+			name != "for" && name != "parfor" && name != "while" && name != "if" &&
+			name != "elseif" && name != "switch" && name != "case" && name != "until"
+		return
+	}
+
+	startsStatement := l.statementStart
+	declared := l.declaresVariable()
+	l.emit(tokenIdent, name, "", line, column)
+	l.statementStart = false
+	if declared {
+		l.variables[name] = true
+		return
+	}
+	if startsStatement && l.isCommandSyntax(name) {
+		l.lexCommandArgs()
+	}
+}
+
+// declaresVariable reports whether the identifier about to be emitted is
+// declared a variable by the keyword it follows, as in `global x y` or
+// `catch err`
+func (l *lexer) declaresVariable() bool {
+	if l.stmtStart < len(l.tokens) && !l.statementStart {
+		if first := l.tokens[l.stmtStart]; first.Kind == tokenKeyword && (first.Text == "global" || first.Text == "persistent") {
+			return true
+		}
+	}
+	prev := l.prevSignificant()
+	return prev != nil && prev.Kind == tokenKeyword && prev.Text == "catch"
+}
+
+// markAssigned records the variables assigned by the statement whose "=" was
+// just lexed: a name, possibly indexed, or the names in [a, b] = ...
+func (l *lexer) markAssigned() {
+	var target []token
+	for _, tok := range l.tokens[l.stmtStart : len(l.tokens)-1] {
+		if tok.Kind != tokenComment && tok.Kind != tokenNewline {
+			target = append(target, tok)
+		}
+	}
+	// Keywords such as for, and the parenthesis of for (i = 1:n)
+	loop := false
+	for len(target) > 0 && target[0].Kind == tokenKeyword {
+		loop = loop || target[0].Text == "for" || target[0].Text == "parfor"
+		target = target[1:]
+	}
+	switch {
+	case len(l.brackets) == 0:
+	case len(l.brackets) == 1 && l.brackets[0] == '(' && loop && len(target) > 0 && target[0].Text == "(":
+		target = target[1:]
+	default:
+		// A keyword argument such as f(a = 1) is not an assignment
+		return
+	}
+	if len(target) == 0 {
+		return
+	}
+	if target[0].Kind == tokenIdent {
+		l.variables[target[0].Text] = true
+		return
+	}
+	depth := 0
+	for i, tok := range target {
+		switch {
+		case tok.Kind == tokenOperator && (tok.Text == "(" || tok.Text == "[" || tok.Text == "{"):
+			depth++
+		case tok.Kind == tokenOperator && (tok.Text == ")" || tok.Text == "]" || tok.Text == "}"):
+			depth--
+		case tok.Kind == tokenIdent && depth == 1 && (i == 0 || target[i-1].Text != "."):
+			l.variables[tok.Text] = true
+		}
+	}
+}
+
+// markParameters records the parameters of a function definition whose
+// parameter list was just closed
+func (l *lexer) markParameters() {
+	if l.stmtStart >= len(l.tokens) || l.tokens[l.stmtStart].Kind != tokenKeyword || l.tokens[l.stmtStart].Text != "function" {
+		return
+	}
+	for i := len(l.tokens) - 2; i > l.stmtStart; i-- {
+		tok := l.tokens[i]
+		if tok.Kind == tokenOperator && tok.Text == "(" {
+			return
+		}
+		if tok.Kind == tokenIdent {
+			l.variables[tok.Text] = true
+		}
+	}
+}
+
+// isCommandSyntax reports whether the identifier just lexed at the start of a
+// statement is followed by command syntax arguments, as in `hold on` or
+// `system ls`, rather than by an expression. As in Octave, variables and
+// constants such as pi are never commands.
+func (l *lexer) isCommandSyntax(name string) bool {
+	if len(l.brackets) > 0 || l.variables[name] || neverCommands[name] {
+		return false
+	}
+	if l.peek(0) != ' ' && l.peek(0) != '\t' {
+		return false
+	}
+	i := l.pos
+	for i < len(l.src) && (l.src[i] == ' ' || l.src[i] == '\t') {
+		i++
+	}
+	if i >= len(l.src) {
+		return false
+	}
+	switch l.src[i] {
+	case '\n', '\r', ';', ',', '(', '%', '#':
+		return false
+	case '=':
+		// Assignment, while == is an operator like the others
+		if i+1 >= len(l.src) || l.src[i+1] != '=' {
+			return false
+		}
+	}
+	for _, op := range octaveOperators {
+		if !strings.HasPrefix(l.src[i:], op) {
+			continue
+		}
+		switch {
+		case op == "[" || op == "{" || op == "@":
+			return true
+		case computedAssignments[op]:
+			return !l.keepsVariables
+		case l.keepsVariables:
+			// The name may be a variable of an earlier call, read an
+			// expression so every call in it is checked
+			return false
+		}
+		// A binary operator surrounded by whitespace starts an expression
+		return !isSpaceOrEnd(l.src, i+len(op))
+	}
+	return true
+}
+
+// lexCommandArgs consumes the whitespace separated words of a command syntax call
+func (l *lexer) lexCommandArgs() {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.advance(1)
+			l.spaceBefore = true
+		case c == '\n' || c == ';' || c == ',':
+			return
+		case (c == '%' || c == '#') && l.spaceBefore:
+			l.lexLineComment()
+		default:
+			l.lexCommandWord()
+		}
+	}
+}
+
+// lexCommandWord reads a single command syntax word, where quoted parts are unquoted
+func (l *lexer) lexCommandWord() {
+	line, column := l.line, l.column
+	start := l.pos
+	var value strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ';' || c == ',' {
+			break
+		}
+		if c == '\'' || c == '"' {
+			quote := c
+			l.advance(1)
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				if l.src[l.pos] == quote {
+					if l.peek(1) == quote {
+						value.WriteByte(quote)
+						l.advance(2)
+						continue
+					}
+					break
+				}
+				l.consumeRune(&value)
+			}
+			if l.pos < len(l.src) && l.src[l.pos] == quote {
+				l.advance(1)
+			}
+			continue
+		}
+		l.consumeRune(&value)
+	}
+	l.emit(tokenCommandArg, l.src[start:l.pos], value.String(), line, column)
+}
+
+func (l *lexer) lexNumber() {
+	line, column := l.line, l.column
+	start := l.pos
+	if l.peek(0) == '0' && (l.peek(1) == 'x' || l.peek(1) == 'X') {
+		l.advance(2)
+		for isHexDigit(l.peek(0)) {
+			l.advance(1)
+		}
+	} else {
+		for isDigit(l.peek(0)) {
+			l.advance(1)
+		}
+		// A dot followed by an operator belongs to the operator, as in 1./x
+		if l.peek(0) == '.' && !strings.ContainsRune("*/\\^'", rune(l.peek(1))) {
+			l.advance(1)
+			for isDigit(l.peek(0)) {
+				l.advance(1)
+			}
+		}
+		if c := l.peek(0); c == 'e' || c == 'E' || c == 'd' || c == 'D' {
+			next := l.peek(1)
+			if isDigit(next) || ((next == '+' || next == '-') && isDigit(l.peek(2))) {
+				l.advance(2)
+				for isDigit(l.peek(0)) {
+					l.advance(1)
+				}
+			}
+		}
+	}
+	// Imaginary unit suffix
+	if c := l.peek(0); (c == 'i' || c == 'j' || c == 'I' || c == 'J') && !isIdentChar(l.peek(1)) {
+		l.advance(1)
+	}
+	l.emit(tokenNumber, l.src[start:l.pos], "", line, column)
+}
+
+// lexDoubleQuoted reads a "..." string, which supports backslash escapes
+func (l *lexer) lexDoubleQuoted() error {
+	line, column := l.line, l.column
+	start := l.pos
+	l.advance(1)
+	var value strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			return l.errorf(line, column, "unterminated string")
+		case c == '\\' && l.pos+1 < len(l.src) && l.src[l.pos+1] != '\n':
+			b, n, ok := unescape(l.src[l.pos+1:])
+			if !ok {
+				return l.errorf(l.line, l.column, "invalid octal escape sequence in string")
+			}
+			value.WriteByte(b)
+			l.advance(1 + n)
+		case c == '"' && l.peek(1) == '"':
+			value.WriteByte('"')
+			l.advance(2)
+		case c == '"':
+			l.advance(1)
+			l.emit(tokenString, l.src[start:l.pos], value.String(), line, column)
+			return nil
+		default:
+			l.consumeRune(&value)
+		}
+	}
+	return l.errorf(line, column, "unterminated string")
+}
+
+// lexSingleQuoted reads a '...' string, where the only escape is a doubled quote
+func (l *lexer) lexSingleQuoted() error {
+	line, column := l.line, l.column
+	start := l.pos
+	l.advance(1)
+	var value strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			return l.errorf(line, column, "unterminated string")
+		case c == '\'' && l.peek(1) == '\'':
+			value.WriteByte('\'')
+			l.advance(2)
+		case c == '\'':
+			l.advance(1)
+			l.emit(tokenString, l.src[start:l.pos], value.String(), line, column)
+			return nil
+		default:
+			l.consumeRune(&value)
+		}
+	}
+	return l.errorf(line, column, "unterminated string")
+}
+
+func (l *lexer) lexOperator() error {
+	line, column := l.line, l.column
+	for _, op := range octaveOperators {
+		if !strings.HasPrefix(l.src[l.pos:], op) {
+			continue
+		}
+		switch op {
+		case "(", "[", "{":
+			l.brackets = append(l.brackets, op[0])
+		case ")", "]", "}":
+			open := map[string]byte{")": '(', "]": '[', "}": '{'}[op]
+			if len(l.brackets) == 0 || l.brackets[len(l.brackets)-1] != open {
+				return l.errorf(line, column, "unexpected '%s'", op)
+			}
+			l.brackets = l.brackets[:len(l.brackets)-1]
+		}
+		l.advance(len(op))
+		l.emit(tokenOperator, op, "", line, column)
+		switch {
+		case op == "=":
+			l.markAssigned()
+		case op == ")" && len(l.brackets) == 0:
+			l.markParameters()
+		}
+		l.statementStart = len(l.brackets) == 0 && (op == ";" || op == ",")
+		return nil
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return l.errorf(line, column, "invalid character %q", r)
+}
+
+// unescape decodes the escape sequence following a backslash in a double
+// quoted string the way Octave does, returning the byte and the length of the
+// sequence. Octal escapes above \377 are refused, hex escapes take every hex
+// digit and keep the low byte, unknown escapes stand for the character.
+func unescape(s string) (byte, int, bool) {
+	switch c := s[0]; {
+	case c >= '0' && c <= '7':
+		value, n := 0, 0
+		for n < 3 && n < len(s) && s[n] >= '0' && s[n] <= '7' {
+			value = value*8 + int(s[n]-'0')
+			n++
+		}
+		return byte(value), n, value <= 0xff
+	case c == 'x' && len(s) > 1 && isHexDigit(s[1]):
+		var value byte
+		n := 1
+		for n < len(s) && isHexDigit(s[n]) {
+			value = value<<4 | hexValue(s[n])
+			n++
+		}
+		return value, n, true
+	default:
+		if decoded, ok := simpleEscapes[c]; ok {
+			return decoded, 1, true
+		}
+		return c, 1, true
+	}
+}
+
+// simpleEscapes are the single character escapes of double quoted strings
+var simpleEscapes = map[byte]byte{
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v',
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isSpaceOrEnd(s string, i int) bool {
+	return i >= len(s) || s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\n'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,243 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	type tok struct {
+		kind tokenKind
+		text string
+	}
+	tests := []struct {
+		name   string
+		script string
+		want   []tok
+	}{
+		{
+			name:   "transpose after identifier",
+			script: "b = a';",
+			want:   []tok{{tokenIdent, "b"}, {tokenOperator, "="}, {tokenIdent, "a"}, {tokenTranspose, "'"}, {tokenOperator, ";"}},
+		},
+		{
+			name:   "string after operator",
+			script: "s = 'it''s';",
+			want:   []tok{{tokenIdent, "s"}, {tokenOperator, "="}, {tokenString, "'it''s'"}, {tokenOperator, ";"}},
+		},
+		{
+			name:   "string separated by whitespace in matrix",
+			script: "[a 'b']",
+			want:   []tok{{tokenOperator, "["}, {tokenIdent, "a"}, {tokenString, "'b'"}, {tokenOperator, "]"}},
+		},
+		{
+			name:   "transpose inside matrix",
+			script: "[a' b.']",
+			want:   []tok{{tokenOperator, "["}, {tokenIdent, "a"}, {tokenTranspose, "'"}, {tokenIdent, "b"}, {tokenTranspose, ".'"}, {tokenOperator, "]"}},
+		},
+		{
+			name:   "transpose after closing paren",
+			script: "x = f(1)'",
+			want:   []tok{{tokenIdent, "x"}, {tokenOperator, "="}, {tokenIdent, "f"}, {tokenOperator, "("}, {tokenNumber, "1"}, {tokenOperator, ")"}, {tokenTranspose, "'"}},
+		},
+		{
+			name:   "double quoted string with escapes",
+			script: `x = "a\"b";`,
+			want:   []tok{{tokenIdent, "x"}, {tokenOperator, "="}, {tokenString, `"a\"b"`}, {tokenOperator, ";"}},
+		},
+		{
+			name:   "comments",
+			script: "x = 1; % note\n# other",
+			want:   []tok{{tokenIdent, "x"}, {tokenOperator, "="}, {tokenNumber, "1"}, {tokenOperator, ";"}, {tokenComment, "% note"}, {tokenNewline, "\n"}, {tokenComment, "# other"}},
+		},
+		{
+			name:   "block comment",
+			script: "%{\nsystem('ls')\n%}\nx",
+			want:   []tok{{tokenComment, "%{\nsystem('ls')\n%}"}, {tokenNewline, "\n"}, {tokenIdent, "x"}},
+		},
+		{
+			name:   "command syntax",
+			script: "hold on",
+			want:   []tok{{tokenIdent, "hold"}, {tokenCommandArg, "on"}},
+		},
+		{
+			name:   "command syntax with quoted argument",
+			script: "disp 'hello world'",
+			want:   []tok{{tokenIdent, "disp"}, {tokenCommandArg, "'hello world'"}},
+		},
+		{
+			name:   "binary operator is not command syntax",
+			script: "a - b",
+			want:   []tok{{tokenIdent, "a"}, {tokenOperator, "-"}, {tokenIdent, "b"}},
+		},
+		{
+			name:   "operator word is command syntax",
+			script: "clear -all",
+			want:   []tok{{tokenIdent, "clear"}, {tokenCommandArg, "-all"}},
+		},
+		{
+			name:   "variable followed by operator word",
+			script: "a = 1;\na -system(\"id\")",
+			want: []tok{
+				{tokenIdent, "a"}, {tokenOperator, "="}, {tokenNumber, "1"}, {tokenOperator, ";"}, {tokenNewline, "\n"},
+				{tokenIdent, "a"}, {tokenOperator, "-"}, {tokenIdent, "system"}, {tokenOperator, "("}, {tokenString, `"id"`}, {tokenOperator, ")"},
+			},
+		},
+		{
+			name:   "variable followed by comparison word",
+			script: "a = 1; a ==system(\"id\")",
+			want: []tok{
+				{tokenIdent, "a"}, {tokenOperator, "="}, {tokenNumber, "1"}, {tokenOperator, ";"},
+				{tokenIdent, "a"}, {tokenOperator, "=="}, {tokenIdent, "system"}, {tokenOperator, "("}, {tokenString, `"id"`}, {tokenOperator, ")"},
+			},
+		},
+		{
+			name:   "output of multiple assignment",
+			script: "[a, b] = size(x);\nb -1",
+			want: []tok{
+				{tokenOperator, "["}, {tokenIdent, "a"}, {tokenOperator, ","}, {tokenIdent, "b"}, {tokenOperator, "]"}, {tokenOperator, "="},
+				{tokenIdent, "size"}, {tokenOperator, "("}, {tokenIdent, "x"}, {tokenOperator, ")"}, {tokenOperator, ";"}, {tokenNewline, "\n"},
+				{tokenIdent, "b"}, {tokenOperator, "-"}, {tokenNumber, "1"},
+			},
+		},
+		{
+			name:   "function parameter",
+			script: "function f(x)\nx -1\nend",
+			want: []tok{
+				{tokenKeyword, "function"}, {tokenIdent, "f"}, {tokenOperator, "("}, {tokenIdent, "x"}, {tokenOperator, ")"}, {tokenNewline, "\n"},
+				{tokenIdent, "x"}, {tokenOperator, "-"}, {tokenNumber, "1"}, {tokenNewline, "\n"}, {tokenKeyword, "end"},
+			},
+		},
+		{
+			name:   "constant followed by operator word",
+			script: "pi +1",
+			want:   []tok{{tokenIdent, "pi"}, {tokenOperator, "+"}, {tokenNumber, "1"}},
+		},
+		{
+			name:   "assignment is not command syntax",
+			script: "a = b",
+			want:   []tok{{tokenIdent, "a"}, {tokenOperator, "="}, {tokenIdent, "b"}},
+		},
+		{
+			name:   "call with space before parenthesis",
+			script: "f (1)",
+			want:   []tok{{tokenIdent, "f"}, {tokenOperator, "("}, {tokenNumber, "1"}, {tokenOperator, ")"}},
+		},
+		{
+			name:   "continuation",
+			script: "x = 1 + ...\n 2",
+			want:   []tok{{tokenIdent, "x"}, {tokenOperator, "="}, {tokenNumber, "1"}, {tokenOperator, "+"}, {tokenComment, "..."}, {tokenNumber, "2"}},
+		},
+		{
+			name:   "numbers",
+			script: "[1.5e-3 0x1F 2i .5 1./x]",
+			want: []tok{
+				{tokenOperator, "["}, {tokenNumber, "1.5e-3"}, {tokenNumber, "0x1F"}, {tokenNumber, "2i"}, {tokenNumber, ".5"},
+				{tokenNumber, "1"}, {tokenOperator, "./"}, {tokenIdent, "x"}, {tokenOperator, "]"},
+			},
+		},
+		{
+			name:   "keywords",
+			script: "if x\nend",
+			want:   []tok{{tokenKeyword, "if"}, {tokenIdent, "x"}, {tokenNewline, "\n"}, {tokenKeyword, "end"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenize(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tokens) != len(tt.want) {
+				t.Fatalf("Expected %d tokens, got %d: %+v", len(tt.want), len(tokens), tokens)
+			}
+			for i, want := range tt.want {
+				if tokens[i].Kind != want.kind || tokens[i].Text != want.text {
+					t.Errorf("Token %d: expected %s %q, got %s %q", i, want.kind, want.text, tokens[i].Kind, tokens[i].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenize_Positions(t *testing.T) {
+	tokens, err := tokenize("x = 1;\n  y = 'é' + z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := tokens[len(tokens)-1]
+	if last.Text != "z" || last.Line != 2 || last.Column != 13 {
+		t.Errorf("Expected z at 2:13, got %q at %d:%d", last.Text, last.Line, last.Column)
+	}
+}
+
+func TestTokenize_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		line   int
+		column int
+	}{
+		{name: "unterminated string", script: "x = 1;\ny = 'abc", line: 2, column: 5},
+		{name: "unbalanced bracket", script: "x = (1", line: 1, column: 7},
+		{name: "unexpected closing bracket", script: "x = 1)", line: 1, column: 6},
+		{name: "invalid character", script: "x = `ls`", line: 1, column: 5},
+		{name: "unterminated block comment", script: "%{\nx", line: 1, column: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tokenize(tt.script)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Expected SyntaxError, got: %v", err)
+			}
+			if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+				t.Errorf("Expected error at %d:%d, got %d:%d (%s)", tt.line, tt.column, syntaxErr.Line, syntaxErr.Column, syntaxErr.Message)
+			}
+		})
+	}
+}
+
+func TestTokenize_Session(t *testing.T) {
+	// A session may hold a variable a from an earlier call
+	tokens, err := tokenizeScript("a -system(\"id\")", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 6 || tokens[1].Kind != tokenOperator || tokens[2].Text != "system" {
+		t.Errorf("Expected an expression, got %+v", tokens)
+	}
+}
+
+func TestTokenize_Escapes(t *testing.T) {
+	tests := []struct {
+		script string
+		value  string
+	}{
+		{script: `"\x73ystem"`, value: "system"},
+		{script: `"\163ystem"`, value: "system"},
+		{script: `"\0"`, value: "\x00"},
+		{script: `"evil\x2em"`, value: "evil.m"},
+		{script: `"\x2F..\x2f"`, value: "/../"},
+		{script: `"\x0173"`, value: "s"},
+		{script: `"a\tb\n\v\f\b\a\r"`, value: "a\tb\n\v\f\b\a\r"},
+		{script: `"\\ \" \'"`, value: `\ " '`},
+		{script: `"\q\x"`, value: "qx"},
+		{script: `'\x73'`, value: `\x73`},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenize(tt.script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 1 || tokens[0].Value != tt.value {
+			t.Errorf("Expected %s to decode to %q, got %+v", tt.script, tt.value, tokens)
+		}
+	}
+
+	if _, err := tokenize(`"\777"`); err == nil {
+		t.Error("Expected an octal escape above \\377 to be refused")
+	}
+}
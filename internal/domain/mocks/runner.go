@@ -2,15 +2,26 @@ package mocks
 
 import (
 	"context"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
 )
 
 // MockRunner implements domain.RunnerInterface for testing
 type MockRunner struct {
 	ExecuteScriptFunc func(ctx context.Context, script string) (string, error)
+	ExecuteFunc       func(ctx context.Context, script string, opts domain.ExecOptions) (*domain.ExecResult, error)
 	GeneratePlotFunc  func(ctx context.Context, script string, format string) ([]byte, error)
+	PlotFunc          func(ctx context.Context, script string, format string, opts domain.ExecOptions) (*domain.PlotResult, error)
+	CheckSyntaxFunc   func(ctx context.Context, script string, tool string, opts domain.ExecOptions) (*domain.SyntaxCheck, error)
+	HelpFunc          func(ctx context.Context, name string, opts domain.ExecOptions) (*domain.HelpResult, error)
+	LookforFunc       func(ctx context.Context, keyword string, opts domain.ExecOptions) (*domain.LookforResult, error)
+	ListPackagesFunc  func(ctx context.Context, opts domain.ExecOptions) ([]domain.PackageInfo, error)
 	Version           string
 }
 
+// Ensure MockRunner implements domain.RunnerInterface
+var _ domain.RunnerInterface = (*MockRunner)(nil)
+
 // ExecuteScript calls the mock function if set, otherwise returns empty string and nil error
 func (m *MockRunner) ExecuteScript(ctx context.Context, script string) (string, error) {
 	if m.ExecuteScriptFunc != nil {
@@ -19,6 +30,15 @@ func (m *MockRunner) ExecuteScript(ctx context.Context, script string) (string,
 	return "", nil
 }
 
+// Execute calls the mock function if set, otherwise falls back to ExecuteScript
+func (m *MockRunner) Execute(ctx context.Context, script string, opts domain.ExecOptions) (*domain.ExecResult, error) {
+	if m.ExecuteFunc != nil {
+		return m.ExecuteFunc(ctx, script, opts)
+	}
+	output, err := m.ExecuteScript(ctx, script)
+	return &domain.ExecResult{Output: output}, err
+}
+
 // GeneratePlot calls the mock function if set, otherwise returns empty byte slice and nil error
 func (m *MockRunner) GeneratePlot(ctx context.Context, script string, format string) ([]byte, error) {
 	if m.GeneratePlotFunc != nil {
@@ -27,6 +47,52 @@ func (m *MockRunner) GeneratePlot(ctx context.Context, script string, format str
 	return []byte{}, nil
 }
 
+// Plot calls the mock function if set, otherwise falls back to GeneratePlot
+// for a single figure
+func (m *MockRunner) Plot(ctx context.Context, script string, format string, opts domain.ExecOptions) (*domain.PlotResult, error) {
+	if m.PlotFunc != nil {
+		return m.PlotFunc(ctx, script, format, opts)
+	}
+	img, err := m.GeneratePlot(ctx, script, format)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.PlotResult{Format: format, Figures: []domain.Figure{{Image: img}}}, nil
+}
+
+// CheckSyntax calls the mock function if set, otherwise reports a valid script
+func (m *MockRunner) CheckSyntax(ctx context.Context, script string, tool string, opts domain.ExecOptions) (*domain.SyntaxCheck, error) {
+	if m.CheckSyntaxFunc != nil {
+		return m.CheckSyntaxFunc(ctx, script, tool, opts)
+	}
+	return &domain.SyntaxCheck{}, nil
+}
+
+// Help calls the mock function if set, otherwise reports the function as
+// found without help text
+func (m *MockRunner) Help(ctx context.Context, name string, opts domain.ExecOptions) (*domain.HelpResult, error) {
+	if m.HelpFunc != nil {
+		return m.HelpFunc(ctx, name, opts)
+	}
+	return &domain.HelpResult{Name: name, Version: m.Version, Found: true}, nil
+}
+
+// Lookfor calls the mock function if set, otherwise returns no matches
+func (m *MockRunner) Lookfor(ctx context.Context, keyword string, opts domain.ExecOptions) (*domain.LookforResult, error) {
+	if m.LookforFunc != nil {
+		return m.LookforFunc(ctx, keyword, opts)
+	}
+	return &domain.LookforResult{Keyword: keyword, Version: m.Version}, nil
+}
+
+// ListPackages calls the mock function if set, otherwise returns no packages
+func (m *MockRunner) ListPackages(ctx context.Context, opts domain.ExecOptions) ([]domain.PackageInfo, error) {
+	if m.ListPackagesFunc != nil {
+		return m.ListPackagesFunc(ctx, opts)
+	}
+	return []domain.PackageInfo{}, nil
+}
+
 // GetVersion returns the mock version
 func (m *MockRunner) GetVersion() string {
 	return m.Version
@@ -1,17 +1,19 @@
 package domain
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 const (
@@ -24,7 +26,59 @@ type Runner struct {
 	logger *slog.Logger
 	// semaphore to limit concurrent executions
 	semaphore chan struct{}
-	version   string
+	// waiting lists the callers blocked on the semaphore, in order
+	waitMu   sync.Mutex
+	waiting  []*slotWaiter
+	version  string
+	pool     *workerPool
+	sessions *SessionManager
+	policy   *Policy
+	sandbox  *sandbox
+	// docs caches help and lookfor results
+	docs docCache
+}
+
+// ExecOptions customizes a single script execution
+type ExecOptions struct {
+	// SessionID runs the script inside a persistent session instead of a
+	// fresh interpreter, so variables survive between calls
+	SessionID string
+	// ReturnVars lists workspace variables to serialize into ExecResult.Vars
+	// once the script has finished
+	ReturnVars []string
+	// Timeout overrides OCTAVE_SCRIPT_TIMEOUT when positive
+	Timeout time.Duration
+	// Plot sets the size and style of the figures exported by Plot
+	Plot PlotOptions
+	// Packages lists Octave packages loaded before the script runs, each must
+	// be allowed by the policy
+	Packages []string
+	// OnQueue, when set, receives the position in line while the execution
+	// waits for a free slot, and 0 once it starts
+	OnQueue func(position int)
+	// OnOutput, when set, receives stdout lines as the script prints them,
+	// up to the output caps
+	OnOutput func(line string)
+	// OnUsage, when set, receives the CPU time the interpreter consumed for
+	// each execution, including failed ones
+	OnUsage func(cpu time.Duration)
+	// CPUBudget, when set, returns the CPU time the caller has left when an
+	// execution starts. The timeout of the execution is capped at it.
+	CPUBudget func() time.Duration
+}
+
+// ExecResult is the outcome of a script execution
+type ExecResult struct {
+	// Output is the filtered stdout, prefixed with stderr when the script failed
+	Output string
+	// Vars maps each name in ExecOptions.ReturnVars to its decoded value,
+	// see vars.go for the encoding
+	Vars map[string]any
+	// OutputBytes is the total size the script wrote to stdout and stderr,
+	// including output dropped by truncation
+	OutputBytes int64
+	// Truncated reports whether the middle of the output was dropped
+	Truncated bool
 }
 
 // Ensure Runner implements RunnerInterface
@@ -41,12 +95,59 @@ func NewRunner() *Runner {
 			slog.Warn("Invalid OCTAVE_SCRIPT_TIMEOUT, using default", "value", timeoutStr)
 		}
 	}
+
+	// Configure concurrency limit (default: 10)
+	concurrencyLimit := defaultConcurrencyLimit
+	if limitStr := os.Getenv("OCTAVE_CONCURRENCY_LIMIT"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
+			concurrencyLimit = limit
+		} else {
+			slog.Warn("Invalid OCTAVE_CONCURRENCY_LIMIT, using default", "value", limitStr)
+		}
+	}
+
+	// Configure worker recycling (default: 100 executions)
+	maxExecs := defaultWorkerMaxExecutions
+	if limitStr := os.Getenv("OCTAVE_WORKER_MAX_EXECUTIONS"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
+			maxExecs = limit
+		} else {
+			slog.Warn("Invalid OCTAVE_WORKER_MAX_EXECUTIONS, using default", "value", limitStr)
+		}
+	}
+
+	// Load the security policy (default: built-in denylist)
+	policy := DefaultPolicy()
+	if policyFile := os.Getenv("OCTAVE_POLICY_FILE"); policyFile != "" {
+		var err error
+		policy, err = LoadPolicy(policyFile)
+		if err != nil {
+			slog.Error("Could not load policy file", "path", policyFile, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Loaded policy file", "path", policyFile)
+	}
+
+	// Configure sandbox (default: none)
+	sb, err := newSandbox(slog.Default())
+	if err != nil {
+		slog.Error("Could not set up sandbox", "error", err)
+		os.Exit(1)
+	}
+
+	// The pool holds one warm interpreter per execution slot
+	pool := newWorkerPool(concurrencyLimit, maxExecs, sb, slog.Default())
+
+	// Boot the first worker synchronously and use it for the version check
+	w, err := pool.get(ctx)
+	if err != nil {
+		slog.Error("Could not run octave command", "error", err)
+		os.Exit(1)
+	}
 	ctx, cancel := context.WithTimeout(ctx, time.Duration(versionCheckTimeout)*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, "octave-cli", "--version")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	versionOut, err := w.exec(ctx, `printf("version %s\n", OCTAVE_VERSION);`, captureOptions{})
+	pool.put(w, err)
 	if err != nil {
 		slog.Error("Could not run octave command", "error", err)
 		os.Exit(1)
@@ -54,95 +155,360 @@ func NewRunner() *Runner {
 
 	// Extract version
 	versionRe := regexp.MustCompile(`version (\d+\.\d+\.\d+)`)
-	matches := versionRe.FindStringSubmatch(out.String())
+	matches := versionRe.FindStringSubmatch(versionOut.stdout)
 	if len(matches) < 2 {
-		slog.Error("Could not parse octave version", "output", out.String())
+		slog.Error("Could not parse octave version", "output", versionOut.stdout)
 		os.Exit(1)
 	}
 	version := matches[1]
 
-	// Configure concurrency limit (default: 10)
-	concurrencyLimit := defaultConcurrencyLimit
-	if limitStr := os.Getenv("OCTAVE_CONCURRENCY_LIMIT"); limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-			concurrencyLimit = limit
-		} else {
-			slog.Warn("Invalid OCTAVE_CONCURRENCY_LIMIT, using default", "value", limitStr)
-		}
-	}
+	// Warm up the remaining workers in the background
+	pool.fill()
 
 	return &Runner{
 		logger: slog.Default(),
 
 		semaphore: make(chan struct{}, concurrencyLimit),
 		version:   version,
+		pool:      pool,
+		sessions:  newSessionManager(slog.Default(), sb),
+		policy:    policy,
+		sandbox:   sb,
 	}
 }
 
+// Close shuts down the worker pool and every persistent session
+func (r *Runner) Close() {
+	r.pool.shutdown()
+	r.sessions.Shutdown()
+	if err := r.sandbox.remove(); err != nil {
+		r.logger.Warn("Failed to remove sandbox exchange dir", "error", err)
+	}
+}
+
+// CreateSession starts a persistent session with the given ID. It returns
+// false if the session already existed.
+func (r *Runner) CreateSession(ctx context.Context, id string) (bool, error) {
+	return r.sessions.Create(ctx, id)
+}
+
+// CloseSession terminates a persistent session and discards its workspace
+func (r *Runner) CloseSession(id string) error {
+	return r.sessions.Close(id)
+}
+
+// OnSessionClosed registers fn to be called with the ID of every session
+// that is closed, expires or terminates. It must be called before any session
+// is created.
+func (r *Runner) OnSessionClosed(fn func(id string)) {
+	r.sessions.onClose = fn
+}
+
+// HasSession reports whether a persistent session with the given ID is live
+func (r *Runner) HasSession(id string) bool {
+	return r.sessions.Exists(id)
+}
+
 func (r *Runner) ExecuteScript(ctx context.Context, script string) (string, error) {
+	result, err := r.Execute(ctx, script, ExecOptions{})
+	return result.Output, err
+}
+
+// Execute runs a script with the given options. The returned result is never
+// nil, on failure its output contains the filtered stderr followed by stdout.
+func (r *Runner) Execute(ctx context.Context, script string, opts ExecOptions) (*ExecResult, error) {
 	// Acquire semaphore to limit concurrent executions
-	select {
-	case r.semaphore <- struct{}{}:
-		// Acquired semaphore
-	case <-ctx.Done():
+	if err := r.acquire(ctx, opts.OnQueue); err != nil {
 		// Context cancelled while waiting for semaphore
-		return "", ctx.Err()
+		return &ExecResult{}, err
 	}
 	// Release semaphore when function returns
 	defer func() {
 		<-r.semaphore
 	}()
 
-	r.logger.Debug("ExecuteScript started", "script_length", len(script))
+	return r.execute(ctx, script, opts)
+}
+
+// execute validates and runs a script. Callers are responsible for limiting
+// concurrency.
+func (r *Runner) execute(ctx context.Context, script string, opts ExecOptions) (*ExecResult, error) {
+	r.logger.Debug("ExecuteScript started", "script_length", len(script), "session_id", opts.SessionID)
 
 	if script == "" {
 		r.logger.Warn("ExecuteScript received empty script")
-		return "", fmt.Errorf("script cannot be empty")
+		return &ExecResult{}, fmt.Errorf("script cannot be empty")
 	}
 
 	// Validate script for command injection attempts
-	if err := validateScript(script); err != nil {
+	if err := r.validate(ToolRunOctave, script, opts); err != nil {
 		r.logger.Warn("ExecuteScript received invalid script", "error", err)
-		return "", fmt.Errorf("invalid script: %w", err)
+		return &ExecResult{}, fmt.Errorf("invalid script: %w", err)
+	}
+
+	if err := validateReturnVars(opts.ReturnVars); err != nil {
+		r.logger.Warn("ExecuteScript received invalid return_vars", "error", err)
+		return &ExecResult{}, err
+	}
+
+	if err := r.policy.CheckPackages(opts.Packages); err != nil {
+		r.logger.Warn("ExecuteScript received disallowed packages", "error", err)
+		return &ExecResult{}, err
 	}
 
 	// Sanitize script
-	sanitizedScript := sanitizeScript(script)
+	sanitizedScript := packageLoadScript(opts.Packages) + sanitizeScript(script)
 
-	// Configure script execution timeout (default: 10 seconds)
-	scriptTimeout := defaultExecTimeoutSeconds
-	if timeoutStr := os.Getenv("OCTAVE_SCRIPT_TIMEOUT"); timeoutStr != "" {
-		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout > 0 {
-			scriptTimeout = timeout
-		} else {
-			r.logger.Warn("Invalid OCTAVE_SCRIPT_TIMEOUT, using default", "value", timeoutStr)
-		}
+	result, err := r.run(ctx, sanitizedScript, opts)
+	if err != nil {
+		r.logger.Error("ExecuteScript failed", "error", err, "result", result.Output)
+		return result, err
 	}
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(scriptTimeout)*time.Second)
-	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "octave-cli", "--silent", "--no-window-system", "--eval", sanitizedScript)
+	r.logger.Debug("ExecuteScript completed successfully", "result_length", len(result.Output), "vars", len(result.Vars))
+	return result, nil
+}
+
+// execFunc runs an execution in w, with suffix appended to its script
+type execFunc func(ctx context.Context, w *worker, suffix string, capture captureOptions) (execOutput, error)
+
+// run executes an already validated script, either in a pooled interpreter or
+// inside the requested session. Callers must hold the semaphore.
+func (r *Runner) run(ctx context.Context, script string, opts ExecOptions) (*ExecResult, error) {
+	return r.runWith(ctx, opts, func(ctx context.Context, w *worker, suffix string, capture captureOptions) (execOutput, error) {
+		return w.exec(ctx, script+suffix, capture)
+	})
+}
+
+// runExchange is run for a script that passes files in or out through x
+func (r *Runner) runExchange(ctx context.Context, x *exchange, opts ExecOptions) (*ExecResult, error) {
+	return r.runWith(ctx, opts, func(ctx context.Context, w *worker, suffix string, capture captureOptions) (execOutput, error) {
+		return x.exec(ctx, r.logger, w, suffix, capture)
+	})
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// runWith implements run and runExchange
+func (r *Runner) runWith(ctx context.Context, opts ExecOptions, run execFunc) (*ExecResult, error) {
+	var marker, suffix string
+	if len(opts.ReturnVars) > 0 {
+		marker = "__octave_mcp_vars_" + strings.ReplaceAll(uuid.NewString(), "-", "") + "__"
+		suffix = returnVarsScript(opts.ReturnVars, marker)
+	}
 
-	err := cmd.Run()
-	result := strings.TrimSpace(stdout.String())
+	capture := loadCaptureOptions(r.logger)
+	capture.varsMarker = marker
+	capture.onLine = opts.OnOutput
+
+	timeout := r.scriptTimeout()
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+	if opts.CPUBudget != nil {
+		budget := opts.CPUBudget()
+		if budget <= 0 {
+			return &ExecResult{}, ErrCPUBudget
+		}
+		// The interpreter runs on a single thread, it cannot use more CPU
+		// time than wall time
+		timeout = min(timeout, budget)
+	}
+
+	exec := func(ctx context.Context, w *worker) (execOutput, error) {
+		return run(ctx, w, suffix, capture)
+	}
+	var out execOutput
+	var err error
+	if opts.SessionID != "" {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		out, err = r.sessions.exec(ctx, opts.SessionID, exec)
+	} else {
+		out, err = r.runPooled(ctx, exec, timeout)
+	}
+	if opts.OnUsage != nil {
+		opts.OnUsage(out.cpu)
+	}
+	if out.truncated {
+		r.logger.Debug("Script output truncated", "stdout_bytes", out.stdoutBytes, "stderr_bytes", out.stderrBytes)
+	}
+
+	stdout := out.stdout
+	var vars map[string]any
+	if marker != "" {
+		var decodeErr error
+		stdout, vars, decodeErr = extractReturnedVars(stdout, marker)
+		if decodeErr != nil && err == nil {
+			err = decodeErr
+		}
+	}
 
 	// Filter the output to prevent data leaks
-	result = filterOutput(result)
+	result := filterOutput(strings.TrimSpace(stdout))
+	outputBytes := out.stdoutBytes + out.stderrBytes
 
 	if err != nil {
 		// Also filter stderr output
-		stderrOutput := filterOutput(stderr.String())
+		stderrOutput := filterOutput(out.stderr)
 		result = stderrOutput + "\n" + result
-		r.logger.Error("ExecuteScript failed", "error", err, "result", result)
-		return result, err
+		if isLimitError(err) || errors.Is(err, ErrOutputLimit) || errors.Is(err, errVarsNotCollected) {
+			// Lead with the error so the client can tell it from a script bug
+			result = err.Error() + "\n" + result
+		}
+		return &ExecResult{Output: result, OutputBytes: outputBytes, Truncated: out.truncated}, err
 	}
+	return &ExecResult{Output: result, Vars: vars, OutputBytes: outputBytes, Truncated: out.truncated}, nil
+}
 
-	r.logger.Debug("ExecuteScript completed successfully", "result_length", len(result))
-	return result, nil
+// runPooled executes in a worker borrowed from the pool. The timeout only
+// starts once a worker is available.
+func (r *Runner) runPooled(ctx context.Context, exec func(context.Context, *worker) (execOutput, error), timeout time.Duration) (execOutput, error) {
+	w, err := r.pool.get(ctx)
+	if err != nil {
+		return execOutput{}, fmt.Errorf("failed to start octave: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	out, err := exec(ctx, w)
+	r.pool.put(w, err)
+	return out, err
+}
+
+// validate checks a script against the policy of a tool. Scripts running in a
+// session may use files in the session workspace.
+func (r *Runner) validate(tool, script string, opts ExecOptions) error {
+	if opts.SessionID != "" {
+		return r.policy.ValidateWorkspace(tool, script)
+	}
+	return r.policy.Validate(tool, script)
+}
+
+// exchange passes files between the server and a single execution through a
+// directory created for it in the exchange dir of the interpreter, which no
+// other interpreter can reach
+type exchange struct {
+	// pattern names the directory as in os.MkdirTemp
+	pattern string
+	// prepare writes the input files and returns the script to run
+	prepare func(dir string, root *os.Root) (string, error)
+	// collect reads the results once the script succeeded
+	collect func(root *os.Root)
+}
+
+// exec creates the directory, runs the script in w followed by suffix and
+// collects the results before removing the directory
+func (x *exchange) exec(ctx context.Context, logger *slog.Logger, w *worker, suffix string, capture captureOptions) (execOutput, error) {
+	// MkdirTemp creates the directory with 0700 permissions
+	dir, err := os.MkdirTemp(w.exchangeDir, x.pattern)
+	if err != nil {
+		return execOutput{}, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Warn("Failed to clean up temp dir", "error", err, "temp_dir", dir)
+		}
+	}()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return execOutput{}, fmt.Errorf("failed to open temp dir: %w", err)
+	}
+	defer root.Close()
+
+	script, err := x.prepare(dir, root)
+	if err != nil {
+		return execOutput{}, err
+	}
+	out, err := w.exec(ctx, script+suffix, capture)
+	if err == nil {
+		x.collect(root)
+	}
+	return out, err
+}
+
+// readExchangeFile reads a file the interpreter wrote. Only regular files are
+// read: a script could link a host file into the directory or leave a FIFO
+// that blocks the server.
+func readExchangeFile(root *os.Root, name string) ([]byte, error) {
+	f, _, err := openExchangeFile(root, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// openExchangeFile opens a regular file the interpreter wrote, see
+// readExchangeFile
+func openExchangeFile(root *os.Root, name string) (*os.File, os.FileInfo, error) {
+	info, err := root.Lstat(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%s is not a regular file", name)
+	}
+	f, err := root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The file may have been replaced since Lstat
+	opened, err := f.Stat()
+	if err != nil || !os.SameFile(info, opened) {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s changed while opening it", name)
+	}
+	return f, opened, nil
+}
+
+// runWrapper runs a trusted wrapper script built for an exchange dir, in the
+// session of opts or a pooled interpreter, and returns the content of the
+// file it writes there
+func (r *Runner) runWrapper(ctx context.Context, file string, script func(dir string) string, timeout time.Duration, opts ExecOptions) (string, error) {
+	if err := r.acquire(ctx, opts.OnQueue); err != nil {
+		return "", err
+	}
+	defer func() {
+		<-r.semaphore
+	}()
+
+	noResult := errors.New("no result was written")
+	var out []byte
+	readErr := noResult
+	x := &exchange{
+		pattern: "octave-wrapper-*",
+		prepare: func(dir string, root *os.Root) (string, error) {
+			return script(dir), nil
+		},
+		collect: func(root *os.Root) {
+			out, readErr = readExchangeFile(root, file)
+			if errors.Is(readErr, os.ErrNotExist) {
+				readErr = noResult
+			} else if readErr != nil {
+				readErr = fmt.Errorf("failed to read result: %w", readErr)
+			}
+		},
+	}
+	if _, err := r.runExchange(ctx, x, ExecOptions{SessionID: opts.SessionID, Timeout: timeout, OnUsage: opts.OnUsage, CPUBudget: opts.CPUBudget}); err != nil {
+		return "", err
+	}
+	if readErr != nil {
+		return "", readErr
+	}
+	return string(out), nil
+}
+
+// scriptTimeout returns the configured script execution timeout
+func (r *Runner) scriptTimeout() time.Duration {
+	// Configure script execution timeout (default: 10 seconds)
+	scriptTimeout := defaultExecTimeoutSeconds
+	if timeoutStr := os.Getenv("OCTAVE_SCRIPT_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := strconv.Atoi(timeoutStr); err == nil && timeout > 0 {
+			scriptTimeout = timeout
+		} else {
+			r.logger.Warn("Invalid OCTAVE_SCRIPT_TIMEOUT, using default", "value", timeoutStr)
+		}
+	}
+	return time.Duration(scriptTimeout) * time.Second
 }
 
 // GetVersion returns the Octave version
@@ -154,143 +520,122 @@ func (r *Runner) GetVersion() string {
 func filterOutput(output string) string {
 	// Remove file paths that might contain sensitive information
 	// This is a simple example, in practice you might want to use more sophisticated filtering
-	output = regexp.MustCompile(`/[^:\s]*`).ReplaceAllString(output, "/[REDACTED]")
+	output = filePathRe.ReplaceAllString(output, "/[REDACTED]")
 
 	// Remove environment variable-like strings
-	output = regexp.MustCompile(`[A-Z_][A-Z0-9_]*=[^:\s]*`).ReplaceAllString(output, "[REDACTED]")
+	output = envVarRe.ReplaceAllString(output, "[REDACTED]")
 
 	// Remove IP addresses
-	output = regexp.MustCompile(`\b(?:[0-9]{1,3}\.){3}[0-9]{1,3}\b`).ReplaceAllString(output, "[IP_ADDRESS]")
+	output = ipAddressRe.ReplaceAllString(output, "[IP_ADDRESS]")
 
 	// Remove email addresses
-	output = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Z|a-z]{2,}\b`).ReplaceAllString(output, "[EMAIL]")
+	output = emailRe.ReplaceAllString(output, "[EMAIL]")
 
 	return output
 }
 
+// Patterns removed by filterOutput, compiled once as it runs on every
+// streamed line
+var (
+	filePathRe  = regexp.MustCompile(`/[^:\s]*`)
+	envVarRe    = regexp.MustCompile(`[A-Z_][A-Z0-9_]*=[^:\s]*`)
+	ipAddressRe = regexp.MustCompile(`\b(?:[0-9]{1,3}\.){3}[0-9]{1,3}\b`)
+	emailRe     = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Z|a-z]{2,}\b`)
+)
+
+// GeneratePlot runs a plotting script and returns the last exported figure,
+// which is usually the current one
 func (r *Runner) GeneratePlot(ctx context.Context, script string, format string) ([]byte, error) {
+	result, err := r.Plot(ctx, script, format, ExecOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return result.Figures[len(result.Figures)-1].Image, nil
+}
+
+// Plot runs a plotting script with the given options and returns every open
+// figure
+func (r *Runner) Plot(ctx context.Context, script string, format string, opts ExecOptions) (*PlotResult, error) {
 	// Acquire semaphore to limit concurrent executions
-	select {
-	case r.semaphore <- struct{}{}:
-		// Acquired semaphore
-	case <-ctx.Done():
+	if err := r.acquire(ctx, opts.OnQueue); err != nil {
 		// Context cancelled while waiting for semaphore
-		return nil, ctx.Err()
+		return nil, err
 	}
 	// Release semaphore when function returns
 	defer func() {
 		<-r.semaphore
 	}()
 
-	r.logger.Debug("GeneratePlot started", "script_length", len(script), "format", format)
+	return r.plot(ctx, script, format, opts)
+}
+
+// plot validates and runs a plotting script and returns the figures. Callers
+// are responsible for limiting concurrency.
+func (r *Runner) plot(ctx context.Context, script string, format string, opts ExecOptions) (*PlotResult, error) {
+	r.logger.Debug("GeneratePlot started", "script_length", len(script), "format", format, "session_id", opts.SessionID)
 
 	// Validate format
 	format = strings.ToLower(format)
-	if format != "png" && format != "svg" {
+	if err := validatePlotFormat(format); err != nil {
 		r.logger.Warn("GeneratePlot received unsupported format", "format", format)
-		return nil, fmt.Errorf("unsupported format: %s (must be png or svg)", format)
+		return nil, err
+	}
+
+	if err := opts.Plot.validate(format); err != nil {
+		r.logger.Warn("GeneratePlot received invalid plot options", "error", err)
+		return nil, err
 	}
 
 	// Validate script for command injection attempts
-	if err := validateScript(script); err != nil {
+	if err := r.validate(ToolGeneratePlot, script, opts); err != nil {
 		r.logger.Warn("GeneratePlot received invalid script", "error", err)
 		return nil, fmt.Errorf("invalid script: %w", err)
 	}
 
-	// Create temp dir
-	tempDir, err := os.MkdirTemp("", "octave-plot-*")
-	if err != nil {
-		r.logger.Error("GeneratePlot failed to create temp dir", "error", err)
-		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	if err := r.policy.CheckPackages(opts.Packages); err != nil {
+		r.logger.Warn("GeneratePlot received disallowed packages", "error", err)
+		return nil, err
 	}
-
-	// Set restrictive permissions on the temp directory
-	if err := os.Chmod(tempDir, 0700); err != nil {
-		// Clean up the temp directory before returning error
-		os.RemoveAll(tempDir)
-		r.logger.Error("GeneratePlot failed to set permissions on temp dir", "error", err)
-		return nil, fmt.Errorf("failed to set permissions on temp dir: %w", err)
+	script = packageLoadScript(opts.Packages) + sanitizeScript(script)
+
+	// Export every open figure, or every frame in animate mode, then read
+	// the files before the directory is removed
+	var result *PlotResult
+	var readErr error
+	x := &exchange{
+		pattern: "octave-plot-*",
+		prepare: func(dir string, root *os.Root) (string, error) {
+			r.logger.Debug("GeneratePlot executing script", "temp_dir", dir)
+			if format == PlotFormatGIF {
+				return animationScript(script, dir, opts.Plot), nil
+			}
+			return plotScript(script, dir, format, opts.Plot), nil
+		},
+		collect: func(root *os.Root) {
+			if format == PlotFormatGIF {
+				result, readErr = readAnimation(root, opts.Plot)
+			} else {
+				result, readErr = readFigures(root, format, opts.Plot)
+			}
+		},
 	}
 
-	defer func() {
-		if err := os.RemoveAll(tempDir); err != nil {
-			r.logger.Warn("GeneratePlot failed to clean up temp dir", "error", err, "temp_dir", tempDir)
-		}
-	}()
-
-	// Setup plot command
-	plotFile := filepath.Join(tempDir, "plot."+format)
-	wrappedScript := fmt.Sprintf(`
-graphics_toolkit("gnuplot");
-set(0, "defaultfigurevisible", "off");
-%s
-print("%s");
-`, sanitizeScript(script), plotFile)
-
-	r.logger.Debug("GeneratePlot executing script", "temp_dir", tempDir, "plot_file", plotFile)
-
 	// Execute
-	_, err = r.ExecuteScript(ctx, wrappedScript)
-	if err != nil {
+	if _, err := r.runExchange(ctx, x, opts); err != nil {
 		r.logger.Error("GeneratePlot failed to execute script", "error", err)
 		return nil, fmt.Errorf("plot generation failed: %w", err)
 	}
-
-	// Read plot file
-	imgData, err := os.ReadFile(plotFile)
-	if err != nil {
-		r.logger.Error("GeneratePlot failed to read plot file", "error", err, "plot_file", plotFile)
-		return nil, fmt.Errorf("failed to read plot file: %w", err)
+	if readErr != nil {
+		r.logger.Error("GeneratePlot failed to read plot files", "error", readErr)
+		return nil, readErr
 	}
-
-	r.logger.Debug("GeneratePlot completed successfully", "image_size", len(imgData))
-	// Note: We don't filter imgData as it's binary image data, not text output
-	return imgData, nil
-}
-
-// validateScript checks if the script contains any potentially dangerous patterns
-// that could lead to command injection or other security issues in GNU Octave
-// TODO add test cases with examples of actual malicious scripts that would work in GNU Octave
-func validateScript(script string) error {
-	// Check for command substitution patterns
-	if strings.Contains(script, "$(") || strings.Contains(script, "`") {
-		return fmt.Errorf("script contains command substitution patterns")
+	if result.Omitted > 0 {
+		r.logger.Warn("GeneratePlot dropped figures or frames beyond the limit", "omitted", result.Omitted)
 	}
 
-	// Check for shell command execution patterns in Octave
-	dangerousFunctions := []string{
-		"system(", "exec(", "popen(", // Direct system command execution
-		"eval(", "evalin(", // Code execution functions
-		"urlread(", "urlwrite(", // Network functions that could be used for data exfiltration
-		"load(", "save(", // File I/O functions that could be misused
-		"unix(", "dos(", // Platform-specific command execution
-		"waitpid(", "fork(", // Process control functions
-	}
-
-	for _, function := range dangerousFunctions {
-		if strings.Contains(script, function) {
-			return fmt.Errorf("script contains potentially dangerous function: %s", function)
-		}
-	}
-
-	// Check for dangerous shell redirection operators that could be used maliciously
-	dangerousPatterns := []string{
-		"; rm ",  // Preventing rm commands
-		"; del ", // Windows delete
-		"| sh",   // Piping to shell
-		"| bash", // Piping to bash
-		"`",      // Command substitution
-		"&&",     // Command chaining
-		"||",     // Command chaining
-	}
-
-	for _, pattern := range dangerousPatterns {
-		if strings.Contains(script, pattern) {
-			return fmt.Errorf("script contains potentially dangerous pattern: %s", pattern)
-		}
-	}
-
-	return nil
+	r.logger.Debug("GeneratePlot completed successfully", "figures", len(result.Figures))
+	// Note: We don't filter the images as they're binary data, not text output
+	return result, nil
 }
 
 // sanitizeScript removes or escapes potentially harmful content from the script
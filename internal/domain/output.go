@@ -0,0 +1,280 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOutputMaxBytes = 64 * 1024
+	defaultOutputMaxLines = 2000
+	// outputKillFactor sets how much output past the caps a script may produce
+	// before it is killed. Output in between is truncated but the script runs
+	// to completion.
+	outputKillFactor = 16
+	// maxStreamLineBytes caps each line forwarded while a script runs
+	maxStreamLineBytes = 4096
+	// maxVarsOutputBytes caps the encoded return_vars block, which is exempt
+	// from the output caps
+	maxVarsOutputBytes = 16 * 1024 * 1024
+)
+
+// ErrOutputLimit is returned when a script produced so much output that it
+// was killed
+var ErrOutputLimit = errors.New("output limit exceeded")
+
+// captureOptions bounds the output kept from a single execution. Zero caps
+// keep everything.
+type captureOptions struct {
+	maxBytes int
+	maxLines int
+	// varsMarker introduces the return_vars block on stdout, which is kept
+	// whole and not counted against the caps
+	varsMarker string
+	// onLine, when set, receives stdout lines while the script runs
+	onLine func(line string)
+}
+
+// loadCaptureOptions reads the output caps from the environment
+func loadCaptureOptions(logger *slog.Logger) captureOptions {
+	// Configure output byte cap (default: 64 KiB)
+	maxBytes := defaultOutputMaxBytes
+	if limitStr := os.Getenv("OCTAVE_OUTPUT_MAX_BYTES"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
+			maxBytes = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_OUTPUT_MAX_BYTES, using default", "value", limitStr)
+		}
+	}
+
+	// Configure output line cap (default: 2000 lines)
+	maxLines := defaultOutputMaxLines
+	if limitStr := os.Getenv("OCTAVE_OUTPUT_MAX_LINES"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
+			maxLines = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_OUTPUT_MAX_LINES, using default", "value", limitStr)
+		}
+	}
+
+	return captureOptions{maxBytes: maxBytes, maxLines: maxLines}
+}
+
+// execOutput is what a single execution wrote to its output streams
+type execOutput struct {
+	stdout string
+	stderr string
+	// stdoutBytes and stderrBytes count everything the script wrote,
+	// including truncated output
+	stdoutBytes int64
+	stderrBytes int64
+	truncated   bool
+	// cpu is the CPU time the interpreter consumed for the execution
+	cpu time.Duration
+}
+
+// outputBuffer keeps the head and the tail of a stream, each up to half of
+// the caps, and counts what was dropped in between
+type outputBuffer struct {
+	maxBytes int
+	maxLines int
+
+	head      strings.Builder
+	headLines int
+	headFull  bool
+
+	// tail holds the most recent lines, each with its newline except for a
+	// line still being written
+	tail      []string
+	tailBytes int
+	// open reports whether the last tail line is incomplete
+	open bool
+
+	totalBytes int64
+	totalLines int
+}
+
+func newOutputBuffer(opts captureOptions) *outputBuffer {
+	return &outputBuffer{maxBytes: opts.maxBytes, maxLines: opts.maxLines}
+}
+
+// write appends a chunk of a line, eol marks the end of the line
+func (b *outputBuffer) write(text string, eol bool) {
+	if eol {
+		text += "\n"
+		b.totalLines++
+	}
+	b.totalBytes += int64(len(text))
+
+	if b.maxBytes <= 0 && b.maxLines <= 0 {
+		b.head.WriteString(text)
+		return
+	}
+
+	if !b.headFull {
+		part := text
+		full := false
+		if b.maxBytes > 0 {
+			space := b.maxBytes/2 - b.head.Len()
+			if len(part) > space {
+				part = part[:space]
+			}
+		}
+		if b.maxLines > 0 {
+			for i := 0; i < len(part); i++ {
+				if part[i] != '\n' {
+					continue
+				}
+				if b.headLines++; b.headLines >= b.maxLines/2 {
+					part = part[:i+1]
+					full = true
+					break
+				}
+			}
+		}
+		b.head.WriteString(part)
+		text = text[len(part):]
+		b.headFull = full || text != ""
+		if text == "" {
+			return
+		}
+	}
+
+	b.appendTail(text)
+}
+
+// appendTail adds text to the tail and drops the oldest output beyond the caps
+func (b *outputBuffer) appendTail(text string) {
+	for text != "" {
+		line, rest, found := strings.Cut(text, "\n")
+		if found {
+			line += "\n"
+		}
+		if b.open {
+			b.tail[len(b.tail)-1] += line
+		} else {
+			b.tail = append(b.tail, line)
+		}
+		b.tailBytes += len(line)
+		b.open = !found
+		text = rest
+	}
+
+	maxBytes, maxLines := b.maxBytes/2, b.maxLines/2
+	for len(b.tail) > 0 {
+		switch {
+		case b.maxLines > 0 && len(b.tail) > maxLines:
+			b.tailBytes -= len(b.tail[0])
+			b.tail = b.tail[1:]
+		case b.maxBytes > 0 && b.tailBytes > maxBytes:
+			excess := b.tailBytes - maxBytes
+			if excess >= len(b.tail[0]) {
+				b.tailBytes -= len(b.tail[0])
+				b.tail = b.tail[1:]
+			} else {
+				b.tail[0] = b.tail[0][excess:]
+				b.tailBytes -= excess
+			}
+		default:
+			return
+		}
+	}
+}
+
+// dropped returns how many bytes are neither in the head nor in the tail
+func (b *outputBuffer) dropped() int64 {
+	return b.totalBytes - int64(b.head.Len()) - int64(b.tailBytes)
+}
+
+// exceeded reports whether the stream went so far past the caps that the
+// script should be stopped
+func (b *outputBuffer) exceeded() bool {
+	return (b.maxBytes > 0 && b.totalBytes > int64(b.maxBytes)*outputKillFactor) ||
+		(b.maxLines > 0 && b.totalLines > b.maxLines*outputKillFactor)
+}
+
+// String returns the head and the tail joined by a truncation marker
+func (b *outputBuffer) String() string {
+	tail := strings.Join(b.tail, "")
+	dropped := b.dropped()
+	if dropped == 0 {
+		return b.head.String() + tail
+	}
+	head := strings.ToValidUTF8(b.head.String(), "")
+	tail = strings.ToValidUTF8(tail, "")
+	if head != "" && !strings.HasSuffix(head, "\n") {
+		head += "\n"
+	}
+	return fmt.Sprintf("%s[... %d bytes truncated ...]\n%s", head, dropped, tail)
+}
+
+// lineStream forwards complete stdout lines to a callback while a script
+// runs, filtered like the final output, and stops once as much was forwarded
+// as the caps allow
+type lineStream struct {
+	emit     func(string)
+	maxBytes int
+	maxLines int
+
+	line strings.Builder
+	// blank counts pending empty lines, which are only forwarded once more
+	// output follows because the frame ends the output with one
+	blank int
+
+	bytes int
+	lines int
+}
+
+// newLineStream returns nil when opts has no line callback
+func newLineStream(opts captureOptions) *lineStream {
+	if opts.onLine == nil {
+		return nil
+	}
+	return &lineStream{emit: opts.onLine, maxBytes: opts.maxBytes, maxLines: opts.maxLines}
+}
+
+// write adds a chunk of a line, eol marks the end of the line
+func (s *lineStream) write(text string, eol bool) {
+	if s == nil || s.done() {
+		return
+	}
+	if room := maxStreamLineBytes - s.line.Len(); room > 0 {
+		if len(text) > room {
+			text = text[:room]
+		}
+		s.line.WriteString(text)
+	}
+	if !eol {
+		return
+	}
+
+	line := strings.ToValidUTF8(s.line.String(), "")
+	s.line.Reset()
+	if line == "" {
+		s.blank++
+		return
+	}
+	for ; s.blank > 0; s.blank-- {
+		s.send("")
+	}
+	s.send(filterOutput(line))
+}
+
+func (s *lineStream) send(line string) {
+	if s.done() {
+		return
+	}
+	s.lines++
+	s.bytes += len(line) + 1
+	s.emit(line)
+}
+
+// done reports whether the caps were reached
+func (s *lineStream) done() bool {
+	return (s.maxBytes > 0 && s.bytes >= s.maxBytes) || (s.maxLines > 0 && s.lines >= s.maxLines)
+}
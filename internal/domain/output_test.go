@@ -0,0 +1,146 @@
+package domain
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     captureOptions
+		lines    []string
+		expected string
+		dropped  int64
+	}{
+		{
+			name:     "within caps",
+			opts:     captureOptions{maxBytes: 100, maxLines: 10},
+			lines:    []string{"a", "b", "c"},
+			expected: "a\nb\nc\n",
+		},
+		{
+			name:     "byte cap keeps head and tail",
+			opts:     captureOptions{maxBytes: 8, maxLines: 100},
+			lines:    []string{"111", "222", "333", "444", "555"},
+			expected: "111\n[... 12 bytes truncated ...]\n555\n",
+			dropped:  12,
+		},
+		{
+			name:     "line cap keeps head and tail",
+			opts:     captureOptions{maxBytes: 1000, maxLines: 4},
+			lines:    []string{"1", "2", "3", "4", "5", "6", "7"},
+			expected: "1\n2\n[... 6 bytes truncated ...]\n6\n7\n",
+			dropped:  6,
+		},
+		{
+			name:     "long line is cut",
+			opts:     captureOptions{maxBytes: 10, maxLines: 100},
+			lines:    []string{strings.Repeat("x", 30)},
+			expected: "xxxxx\n[... 21 bytes truncated ...]\nxxxx\n",
+			dropped:  21,
+		},
+		{
+			name:     "no caps",
+			opts:     captureOptions{},
+			lines:    []string{strings.Repeat("x", 1000)},
+			expected: strings.Repeat("x", 1000) + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newOutputBuffer(tt.opts)
+			var total int64
+			for _, line := range tt.lines {
+				b.write(line, true)
+				total += int64(len(line) + 1)
+			}
+			if got := b.String(); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if b.dropped() != tt.dropped {
+				t.Errorf("Expected %d dropped bytes, got %d", tt.dropped, b.dropped())
+			}
+			if b.totalBytes != total {
+				t.Errorf("Expected %d total bytes, got %d", total, b.totalBytes)
+			}
+		})
+	}
+}
+
+func TestOutputBuffer_Chunks(t *testing.T) {
+	b := newOutputBuffer(captureOptions{maxBytes: 1000, maxLines: 2})
+	b.write("he", false)
+	b.write("llo", true)
+	b.write("wor", false)
+	b.write("ld", true)
+	b.write("!", true)
+	if got := b.String(); got != "hello\n[... 6 bytes truncated ...]\n!\n" {
+		t.Errorf("Unexpected output %q", got)
+	}
+	if b.totalLines != 3 {
+		t.Errorf("Expected 3 lines, got %d", b.totalLines)
+	}
+}
+
+func TestOutputBuffer_Exceeded(t *testing.T) {
+	b := newOutputBuffer(captureOptions{maxBytes: 10, maxLines: 1000})
+	for i := 0; i < 10*outputKillFactor/2; i++ {
+		b.write("x", true)
+	}
+	if b.exceeded() {
+		t.Fatal("Expected buffer not to be exceeded at the kill threshold")
+	}
+	b.write("x", true)
+	if !b.exceeded() {
+		t.Error("Expected buffer to be exceeded past the kill threshold")
+	}
+
+	lines := newOutputBuffer(captureOptions{maxBytes: 1 << 20, maxLines: 2})
+	for i := 0; i <= 2*outputKillFactor; i++ {
+		lines.write("", true)
+	}
+	if !lines.exceeded() {
+		t.Error("Expected line cap to be exceeded")
+	}
+}
+
+func TestLoadCaptureOptions(t *testing.T) {
+	t.Setenv("OCTAVE_OUTPUT_MAX_BYTES", "100")
+	t.Setenv("OCTAVE_OUTPUT_MAX_LINES", "nope")
+	opts := loadCaptureOptions(slog.Default())
+	if opts.maxBytes != 100 || opts.maxLines != defaultOutputMaxLines {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+}
+
+func TestLineStream(t *testing.T) {
+	var got []string
+	s := newLineStream(captureOptions{maxBytes: 1000, maxLines: 5, onLine: func(line string) {
+		got = append(got, line)
+	}})
+	s.write("he", false)
+	s.write("llo", true)
+	s.write("", true)
+	s.write("world", true)
+	// A trailing empty line is held back, the frame prints one
+	s.write("", true)
+	if want := []string{"hello", "", "world"}; !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	s.write("HOME=/root", true)
+	s.write("dropped", true)
+	if want := []string{"hello", "", "world", "", "[REDACTED]"}; !slices.Equal(got, want) {
+		t.Errorf("Expected streaming to stop at the line cap, got %q", got)
+	}
+
+	if newLineStream(captureOptions{}) != nil {
+		t.Error("Expected no stream without a callback")
+	}
+	var nilStream *lineStream
+	nilStream.write("ignored", true)
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// packageListTimeout bounds listing the installed packages
+const packageListTimeout = 30 * time.Second
+
+// PackageInfo describes an installed Octave package
+type PackageInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Allowed reports whether the policy lets scripts load the package
+	Allowed bool `json:"allowed"`
+}
+
+// packageListScript writes the name and version of every installed package
+// to dir/packages.txt, one per line separated by a tab
+const packageListScript = `
+__octave_mcp_pkgs__ = pkg("list");
+__octave_mcp_fid__ = fopen([%s "/packages.txt"], "w");
+for __octave_mcp_k__ = 1:numel(__octave_mcp_pkgs__)
+  fprintf(__octave_mcp_fid__, "%%s\t%%s\n", __octave_mcp_pkgs__{__octave_mcp_k__}.name, __octave_mcp_pkgs__{__octave_mcp_k__}.version);
+end
+fclose(__octave_mcp_fid__);
+`
+
+// packageLoadScript returns the statement loading packages, or an empty
+// string. It ends without a newline so that the line numbers of the script
+// that follows are unchanged.
+func packageLoadScript(packages []string) string {
+	if len(packages) == 0 {
+		return ""
+	}
+	args := make([]string, len(packages))
+	for i, name := range packages {
+		args[i] = fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("pkg(\"load\", %s); ", strings.Join(args, ", "))
+}
+
+// ListPackages returns the installed Octave packages sorted by name
+func (r *Runner) ListPackages(ctx context.Context, opts ExecOptions) ([]PackageInfo, error) {
+	out, err := r.runWrapper(ctx, "packages.txt", func(dir string) string {
+		return fmt.Sprintf(packageListScript, octaveString(dir))
+	}, packageListTimeout, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+
+	allowed := r.policy.AllowedPackages()
+	packages := []PackageInfo{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		name, version, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		packages = append(packages, PackageInfo{Name: name, Version: version, Allowed: slices.Contains(allowed, name)})
+	}
+	slices.SortFunc(packages, func(a, b PackageInfo) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return packages, nil
+}
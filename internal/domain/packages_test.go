@@ -0,0 +1,14 @@
+package domain
+
+import "testing"
+
+func TestPackageLoadScript(t *testing.T) {
+	if got := packageLoadScript(nil); got != "" {
+		t.Errorf("Expected no statement without packages, got %q", got)
+	}
+	got := packageLoadScript([]string{"signal", "statistics"})
+	want := `pkg("load", "signal", "statistics"); `
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
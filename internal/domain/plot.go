@@ -0,0 +1,287 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxPlotFigures caps how many figures a single plot exports
+	maxPlotFigures = 16
+
+	// Bounds of the plot options
+	minPlotSize     = 100
+	maxPlotSize     = 4000
+	minPlotDPI      = 50
+	maxPlotDPI      = 600
+	minPlotFontSize = 6
+	maxPlotFontSize = 48
+)
+
+// plotDevices maps the supported export formats to their print() device.
+// EPS uses the color device, plain eps is black and white.
+var plotDevices = map[string]string{
+	"png": "png",
+	"svg": "svg",
+	"jpg": "jpeg",
+	"pdf": "pdf",
+	"eps": "epsc",
+	"gif": "png",
+}
+
+// PlotFormatGIF selects animate mode, which assembles the frames captured at
+// every drawnow into an animated GIF
+const PlotFormatGIF = "gif"
+
+// validatePlotFormat checks that format, already lowercased, is supported
+func validatePlotFormat(format string) error {
+	if _, ok := plotDevices[format]; !ok && !isSpecFormat(format) {
+		return fmt.Errorf("unsupported format: %s (must be png, svg, jpg, pdf, eps, gif, vegalite or plotly)", format)
+	}
+	return nil
+}
+
+// Plot themes
+const (
+	PlotThemeLight = "light"
+	PlotThemeDark  = "dark"
+)
+
+// PlotOptions sets the size and style of exported figures, and what is
+// exported along with them. Zero values keep the gnuplot defaults.
+type PlotOptions struct {
+	// Width and Height are the image size in pixels
+	Width  int
+	Height int
+	DPI    int
+	// FontSize applies to every text of the figure, in points
+	FontSize int
+	// Theme is PlotThemeLight or PlotThemeDark
+	Theme string
+	// FrameDelay is the time each frame of an animation is shown, in
+	// milliseconds
+	FrameDelay int
+	// Data also exports the data behind each figure, see FigureData
+	Data bool
+}
+
+// validate checks the options against their bounds and the export format
+func (o PlotOptions) validate(format string) error {
+	if o.Data && format == PlotFormatGIF {
+		return fmt.Errorf("data extraction is not supported in animate mode")
+	}
+	if err := checkBounds("width", o.Width, minPlotSize, maxPlotSize); err != nil {
+		return err
+	}
+	if err := checkBounds("height", o.Height, minPlotSize, maxPlotSize); err != nil {
+		return err
+	}
+	if (o.Width == 0) != (o.Height == 0) {
+		return fmt.Errorf("width and height must be set together")
+	}
+	if err := checkBounds("dpi", o.DPI, minPlotDPI, maxPlotDPI); err != nil {
+		return err
+	}
+	if err := checkBounds("font_size", o.FontSize, minPlotFontSize, maxPlotFontSize); err != nil {
+		return err
+	}
+	if err := checkBounds("frame_delay", o.FrameDelay, minFrameDelay, maxFrameDelay); err != nil {
+		return err
+	}
+	switch o.Theme {
+	case "", PlotThemeLight, PlotThemeDark:
+		return nil
+	default:
+		return fmt.Errorf("unsupported theme: %s (must be %s or %s)", o.Theme, PlotThemeLight, PlotThemeDark)
+	}
+}
+
+// checkBounds accepts zero, meaning unset, or a value within [lo, hi]
+func checkBounds(name string, value, lo, hi int) error {
+	if value != 0 && (value < lo || value > hi) {
+		return fmt.Errorf("%s must be between %d and %d, got %d", name, lo, hi, value)
+	}
+	return nil
+}
+
+// printArgs returns the extra print() arguments selecting the device of
+// format and applying the options
+func (o PlotOptions) printArgs(format string) string {
+	var args strings.Builder
+	fmt.Fprintf(&args, `, "-d%s"`, plotDevices[format])
+	if o.DPI > 0 {
+		fmt.Fprintf(&args, `, "-r%d"`, o.DPI)
+	}
+	if o.Width > 0 {
+		fmt.Fprintf(&args, `, "-S%d,%d"`, o.Width, o.Height)
+	}
+	return args.String()
+}
+
+// darkThemeScript recolors the figure in __octave_mcp_h__. Printing normally
+// forces a white background, inverthardcopy keeps the figure colors.
+const darkThemeScript = `  set(__octave_mcp_h__, "color", [0.12 0.12 0.12], "inverthardcopy", "off");
+  __octave_mcp_objs__ = findall(__octave_mcp_h__, "type", "axes");
+  if !isempty(__octave_mcp_objs__)
+    set(__octave_mcp_objs__, "color", [0.12 0.12 0.12], "xcolor", [0.88 0.88 0.88], "ycolor", [0.88 0.88 0.88], "zcolor", [0.88 0.88 0.88]);
+  end
+  __octave_mcp_objs__ = findall(__octave_mcp_h__, "type", "text");
+  if !isempty(__octave_mcp_objs__)
+    set(__octave_mcp_objs__, "color", [0.88 0.88 0.88]);
+  end
+  __octave_mcp_objs__ = findall(__octave_mcp_h__, "type", "legend");
+  if !isempty(__octave_mcp_objs__)
+    set(__octave_mcp_objs__, "color", [0.12 0.12 0.12], "textcolor", [0.88 0.88 0.88], "edgecolor", [0.88 0.88 0.88]);
+  end
+`
+
+// styleScript returns the code applying the options to the figure in
+// __octave_mcp_h__ before it is printed
+func (o PlotOptions) styleScript() string {
+	var code strings.Builder
+	if o.FontSize > 0 {
+		fmt.Fprintf(&code, `  __octave_mcp_objs__ = findall(__octave_mcp_h__, "-property", "fontsize");
+  if !isempty(__octave_mcp_objs__)
+    set(__octave_mcp_objs__, "fontsize", %d);
+  end
+`, o.FontSize)
+	}
+	if o.Theme == PlotThemeDark {
+		code.WriteString(darkThemeScript)
+	}
+	return code.String()
+}
+
+// Figure is one exported figure of a plot
+type Figure struct {
+	// Image is the figure rendered in the requested format, the JSON document
+	// for chart spec formats
+	Image []byte
+	// Titles lists the non-empty titles of the figure's axes, in creation order
+	Titles []string
+	// Data is the data behind the figure when PlotOptions.Data is set
+	Data *FigureData
+}
+
+// PlotResult is the outcome of a plotting script
+type PlotResult struct {
+	Format string
+	// Figures holds every open figure in ascending figure number order. In
+	// animate mode it holds a single animated GIF.
+	Figures []Figure
+	// Omitted counts the figures beyond maxPlotFigures, or the frames beyond
+	// maxAnimationFrames, that were not exported
+	Omitted int
+	// Frames is the number of frames of an animation
+	Frames int
+	// Warnings lists what could not be exported in full
+	Warnings []string
+}
+
+// plotScript wraps script so that every open figure is styled according to
+// opts and exported to dir as figure-<n>.<format>, along with its axes titles
+// in figure-<n>.txt and, if requested, its data in figure-<n>.json. The number
+// of open figures is written to figures.txt. A script that opens no figure
+// exports an empty one, like print() does. Chart spec formats only need the
+// data, nothing is printed.
+func plotScript(script, dir, format string, opts PlotOptions) string {
+	path := octaveString(dir)
+	export := ""
+	if isSpecFormat(format) {
+		opts.Data = true
+	} else {
+		export = fmt.Sprintf("%s  print(__octave_mcp_h__, sprintf(\"%%s/figure-%%d.%s\", %s, __octave_mcp_i__)%s);\n",
+			opts.styleScript(), format, path, opts.printArgs(format))
+	}
+	dataInit, dataAxes, dataWrite := plotDataScripts(dir, opts)
+	return fmt.Sprintf(`
+graphics_toolkit("gnuplot");
+set(0, "defaultfigurevisible", "off");
+%s
+__octave_mcp_figs__ = sort(get(0, "children"));
+if isempty(__octave_mcp_figs__)
+  __octave_mcp_figs__ = gcf();
+end
+__octave_mcp_fid__ = fopen([%s "/figures.txt"], "w");
+fprintf(__octave_mcp_fid__, "%%d\n", numel(__octave_mcp_figs__));
+fclose(__octave_mcp_fid__);
+for __octave_mcp_i__ = 1:min(numel(__octave_mcp_figs__), %d)
+  __octave_mcp_h__ = __octave_mcp_figs__(__octave_mcp_i__);
+%s  __octave_mcp_fid__ = fopen(sprintf("%%s/figure-%%d.txt", %s, __octave_mcp_i__), "w");
+%s  __octave_mcp_axes__ = flipud(findobj(__octave_mcp_h__, "type", "axes"));
+  for __octave_mcp_j__ = 1:numel(__octave_mcp_axes__)
+    __octave_mcp_ax__ = __octave_mcp_axes__(__octave_mcp_j__);
+    if any(strcmp(get(__octave_mcp_ax__, "tag"), {"legend", "colorbar"}))
+      continue;
+    end
+    __octave_mcp_title__ = strjoin(cellstr(get(get(__octave_mcp_ax__, "title"), "string")), " ");
+    if !isempty(strtrim(__octave_mcp_title__))
+      fprintf(__octave_mcp_fid__, "%%s\n", strrep(__octave_mcp_title__, "\n", " "));
+    end
+%s  end
+  fclose(__octave_mcp_fid__);
+%send
+`, script, path, maxPlotFigures, export, path, dataInit, dataAxes, dataWrite)
+}
+
+// readFigures loads the files written by plotScript. For chart spec formats
+// the spec is built from the figure data, which is only kept when opts asks
+// for it.
+func readFigures(dir *os.Root, format string, opts PlotOptions) (*PlotResult, error) {
+	spec := isSpecFormat(format)
+	result := &PlotResult{Format: format}
+	for i := 1; i <= maxPlotFigures; i++ {
+		// Titles are written for every figure, even with nothing to print
+		name := fmt.Sprintf("figure-%d.%s", i, format)
+		if spec {
+			name = fmt.Sprintf("figure-%d.txt", i)
+		}
+		img, err := readExchangeFile(dir, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read plot file: %w", err)
+		}
+		var fig Figure
+		if !spec {
+			fig.Image = img
+		}
+		if titles, err := readExchangeFile(dir, fmt.Sprintf("figure-%d.txt", i)); err == nil {
+			for _, title := range strings.Split(string(titles), "\n") {
+				if title = strings.TrimSpace(title); title != "" {
+					fig.Titles = append(fig.Titles, title)
+				}
+			}
+		}
+		var warning string
+		if fig.Data, warning = readFigureData(dir, i); warning != "" {
+			result.Warnings = append(result.Warnings, warning)
+		}
+		if spec && fig.Data == nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("figure %d: chart spec omitted, the figure data is unavailable", i))
+		} else if spec {
+			var warnings []string
+			fig.Image, warnings = chartSpec(format, i, fig.Data, opts)
+			result.Warnings = append(result.Warnings, warnings...)
+			if !opts.Data {
+				fig.Data = nil
+			}
+		}
+		result.Figures = append(result.Figures, fig)
+	}
+	if len(result.Figures) == 0 {
+		return nil, fmt.Errorf("failed to read plot file: no figure was exported")
+	}
+
+	if data, err := readExchangeFile(dir, "figures.txt"); err == nil {
+		if total, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && total > len(result.Figures) {
+			result.Omitted = total - len(result.Figures)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,178 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadFigures(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"figures.txt":  "20\n",
+		"figure-1.png": "first",
+		"figure-1.txt": "Top\n  \nBottom\n",
+		"figure-2.png": "second",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := readFigures(openRoot(t, dir), "png", PlotOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Figures) != 2 {
+		t.Fatalf("Expected 2 figures, got %d", len(result.Figures))
+	}
+	if string(result.Figures[0].Image) != "first" || string(result.Figures[1].Image) != "second" {
+		t.Errorf("Figures out of order: %q, %q", result.Figures[0].Image, result.Figures[1].Image)
+	}
+	if !slices.Equal(result.Figures[0].Titles, []string{"Top", "Bottom"}) {
+		t.Errorf("Unexpected titles %q", result.Figures[0].Titles)
+	}
+	if result.Figures[1].Titles != nil {
+		t.Errorf("Expected no titles, got %q", result.Figures[1].Titles)
+	}
+	if result.Omitted != 18 {
+		t.Errorf("Expected 18 omitted figures, got %d", result.Omitted)
+	}
+
+	if _, err := readFigures(openRoot(t, t.TempDir()), "png", PlotOptions{}); err == nil || !strings.Contains(err.Error(), "no figure") {
+		t.Errorf("Expected missing figure error, got: %v", err)
+	}
+}
+
+// openRoot opens dir like the exchange dir of an execution
+func openRoot(t *testing.T, dir string) *os.Root {
+	t.Helper()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { root.Close() })
+	return root
+}
+
+func TestReadExchangeFile(t *testing.T) {
+	host := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(host, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "figure-1.txt"), []byte("Title"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(host, filepath.Join(dir, "figure-1.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("figure-1.txt", filepath.Join(dir, "figure-2.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "figures.txt"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	root := openRoot(t, dir)
+
+	if data, err := readExchangeFile(root, "figure-1.txt"); err != nil || string(data) != "Title" {
+		t.Errorf("Expected the regular file to be read, got %q, %v", data, err)
+	}
+	for _, name := range []string{"figure-1.png", "figure-2.png", "figures.txt"} {
+		if _, err := readExchangeFile(root, name); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+			t.Errorf("Expected %s to be refused, got: %v", name, err)
+		}
+	}
+	if _, err := readFigures(root, "png", PlotOptions{}); err == nil || !strings.Contains(err.Error(), "not a regular file") {
+		t.Errorf("Expected a linked figure to fail, got: %v", err)
+	}
+}
+
+func TestPlotScript(t *testing.T) {
+	script := plotScript("plot(1:3);", "/tmp/octave-plot-1", "svg", PlotOptions{})
+	for _, want := range []string{
+		"plot(1:3);\n",
+		`sort(get(0, "children"))`,
+		`sprintf("%s/figure-%d.svg", ` + octaveString("/tmp/octave-plot-1") + `, __octave_mcp_i__), "-dsvg");`,
+		`min(numel(__octave_mcp_figs__), 16)`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected wrapper to contain %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestPlotOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		opts   PlotOptions
+		err    string
+	}{
+		{"defaults", "png", PlotOptions{}, ""},
+		{"all set", "png", PlotOptions{Width: 800, Height: 600, DPI: 150, FontSize: 12, Theme: PlotThemeDark}, ""},
+		{"huge", "png", PlotOptions{Width: 50000, Height: 50000}, "width must be between 100 and 4000"},
+		{"tiny height", "png", PlotOptions{Width: 800, Height: 10}, "height must be between 100 and 4000"},
+		{"width only", "png", PlotOptions{Width: 800}, "width and height must be set together"},
+		{"dpi", "png", PlotOptions{DPI: 1200}, "dpi must be between 50 and 600"},
+		{"negative font", "png", PlotOptions{FontSize: -1}, "font_size must be between 6 and 48"},
+		{"theme", "png", PlotOptions{Theme: "solarized"}, "unsupported theme"},
+		{"data", "svg", PlotOptions{Data: true}, ""},
+		{"data in animate mode", "gif", PlotOptions{Data: true}, "not supported in animate mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.validate(tt.format)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestPlotScript_Options(t *testing.T) {
+	opts := PlotOptions{Width: 800, Height: 600, DPI: 150, FontSize: 14, Theme: PlotThemeDark}
+	script := plotScript("plot(1:3);", "/tmp/octave-plot-1", "png", opts)
+	for _, want := range []string{
+		`__octave_mcp_i__), "-dpng", "-r150", "-S800,600");`,
+		`set(__octave_mcp_objs__, "fontsize", 14);`,
+		`"inverthardcopy", "off"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected wrapper to contain %q:\n%s", want, script)
+		}
+	}
+
+	script = plotScript("plot(1:3);", "/tmp/octave-plot-1", "png", PlotOptions{})
+	if strings.Contains(script, "fontsize") || strings.Contains(script, "inverthardcopy") {
+		t.Errorf("Expected no styling without options:\n%s", script)
+	}
+}
+
+func TestValidatePlotFormat(t *testing.T) {
+	for _, format := range []string{"png", "svg", "jpg", "pdf", "eps", "gif", "vegalite", "plotly"} {
+		if err := validatePlotFormat(format); err != nil {
+			t.Errorf("Expected %s to be supported, got: %v", format, err)
+		}
+	}
+	err := validatePlotFormat("bmp")
+	if err == nil || err.Error() != "unsupported format: bmp (must be png, svg, jpg, pdf, eps, gif, vegalite or plotly)" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if script := plotScript("plot(1:3);", "/tmp/d", "eps", PlotOptions{}); !strings.Contains(script, `"-depsc"`) {
+		t.Errorf("Expected color EPS device:\n%s", script)
+	}
+	script := plotScript("plot(1:3);", "/tmp/d", "plotly", PlotOptions{})
+	if strings.Contains(script, "print(") || !strings.Contains(script, "jsonencode") {
+		t.Errorf("Expected a chart spec wrapper collecting data without printing:\n%s", script)
+	}
+}
@@ -0,0 +1,176 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// maxPlotDataPoints caps the points returned per series. Larger series are
+	// sampled with a constant stride, surfaces along both dimensions.
+	maxPlotDataPoints = 10000
+	// maxPlotDataBytes caps the encoded data of a single figure
+	maxPlotDataBytes = 1024 * 1024
+)
+
+// FigureData is the data behind a figure. Numeric data is kept as encoded by
+// Octave's jsonencode: vectors are flat arrays, matrices nested arrays with
+// rows first, and NaN or Inf values are null.
+type FigureData struct {
+	// Axes lists the axes of the figure in creation order, legends and
+	// colorbars excluded
+	Axes []AxesData `json:"axes"`
+	// Legends lists the entries of each legend of the figure
+	Legends [][]string `json:"legends,omitempty"`
+}
+
+// AxesData describes one axes and the series drawn in it
+type AxesData struct {
+	Title  string          `json:"title,omitempty"`
+	XLabel string          `json:"xlabel,omitempty"`
+	YLabel string          `json:"ylabel,omitempty"`
+	ZLabel string          `json:"zlabel,omitempty"`
+	XLim   json.RawMessage `json:"xlim"`
+	YLim   json.RawMessage `json:"ylim"`
+	ZLim   json.RawMessage `json:"zlim"`
+	// XScale, YScale and ZScale are linear or log
+	XScale string `json:"xscale"`
+	YScale string `json:"yscale"`
+	ZScale string `json:"zscale"`
+	// Position is the normalized [left bottom width height] of the axes in
+	// the figure
+	Position []float64    `json:"position"`
+	Series   []SeriesData `json:"series"`
+	// Unsupported lists the types of the children that were skipped
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// SeriesData holds the data of a line, scatter, surface or bar series
+type SeriesData struct {
+	// Type is line, scatter, surface or bar
+	Type string `json:"type"`
+	// LineStyle and Marker are set for lines, a line drawn with markers
+	// only has the line style none
+	LineStyle string `json:"line_style,omitempty"`
+	Marker    string `json:"marker,omitempty"`
+	// Label is the display name of the series, as shown in the legend
+	Label string          `json:"label,omitempty"`
+	XData json.RawMessage `json:"xdata"`
+	YData json.RawMessage `json:"ydata"`
+	ZData json.RawMessage `json:"zdata,omitempty"`
+	// Size is the size of the data before sampling, ZData for surfaces and
+	// YData otherwise
+	Size []int `json:"size"`
+	// Stride is the sampling step, 1 when the data is complete
+	Stride int `json:"stride"`
+}
+
+// plotDataInit starts collecting the data of the figure in __octave_mcp_h__
+const plotDataInit = `  __octave_mcp_data__ = struct();
+  __octave_mcp_data__.axes = {};
+  __octave_mcp_data__.legends = {};
+  __octave_mcp_objs__ = flipud(findall(__octave_mcp_h__, "tag", "legend"));
+  for __octave_mcp_k__ = 1:numel(__octave_mcp_objs__)
+    __octave_mcp_data__.legends{end+1} = cellstr(get(__octave_mcp_objs__(__octave_mcp_k__), "string"));
+  end
+`
+
+// plotDataAxes collects the labels, limits and series of the axes in
+// __octave_mcp_ax__. Bar and scatter series are hggroups, told apart by
+// their specific properties.
+const plotDataAxes = `    __octave_mcp_a__ = struct();
+    __octave_mcp_a__.title = __octave_mcp_title__;
+    __octave_mcp_a__.xlabel = strjoin(cellstr(get(get(__octave_mcp_ax__, "xlabel"), "string")), " ");
+    __octave_mcp_a__.ylabel = strjoin(cellstr(get(get(__octave_mcp_ax__, "ylabel"), "string")), " ");
+    __octave_mcp_a__.zlabel = strjoin(cellstr(get(get(__octave_mcp_ax__, "zlabel"), "string")), " ");
+    __octave_mcp_a__.xlim = get(__octave_mcp_ax__, "xlim");
+    __octave_mcp_a__.ylim = get(__octave_mcp_ax__, "ylim");
+    __octave_mcp_a__.zlim = get(__octave_mcp_ax__, "zlim");
+    __octave_mcp_a__.xscale = get(__octave_mcp_ax__, "xscale");
+    __octave_mcp_a__.yscale = get(__octave_mcp_ax__, "yscale");
+    __octave_mcp_a__.zscale = get(__octave_mcp_ax__, "zscale");
+    __octave_mcp_a__.position = get(__octave_mcp_ax__, "position");
+    __octave_mcp_a__.series = {};
+    __octave_mcp_a__.unsupported = {};
+    __octave_mcp_objs__ = flipud(get(__octave_mcp_ax__, "children"));
+    for __octave_mcp_k__ = 1:numel(__octave_mcp_objs__)
+      __octave_mcp_c__ = __octave_mcp_objs__(__octave_mcp_k__);
+      __octave_mcp_t__ = get(__octave_mcp_c__, "type");
+      if strcmp(__octave_mcp_t__, "hggroup") && isprop(__octave_mcp_c__, "barwidth")
+        __octave_mcp_t__ = "bar";
+      elseif strcmp(__octave_mcp_t__, "hggroup") && isprop(__octave_mcp_c__, "sizedata")
+        __octave_mcp_t__ = "scatter";
+      elseif !any(strcmp(__octave_mcp_t__, {"line", "surface"}))
+        __octave_mcp_a__.unsupported{end+1} = __octave_mcp_t__;
+        continue;
+      end
+      __octave_mcp_x__ = get(__octave_mcp_c__, "xdata");
+      __octave_mcp_y__ = get(__octave_mcp_c__, "ydata");
+      __octave_mcp_z__ = get(__octave_mcp_c__, "zdata");
+      __octave_mcp_s__ = struct();
+      __octave_mcp_s__.type = __octave_mcp_t__;
+      __octave_mcp_s__.label = get(__octave_mcp_c__, "displayname");
+      if strcmp(__octave_mcp_t__, "line")
+        __octave_mcp_s__.line_style = get(__octave_mcp_c__, "linestyle");
+        __octave_mcp_s__.marker = get(__octave_mcp_c__, "marker");
+      end
+      if strcmp(__octave_mcp_t__, "surface")
+        __octave_mcp_s__.size = size(__octave_mcp_z__);
+        __octave_mcp_st__ = max(1, ceil(sqrt(numel(__octave_mcp_z__) / %[1]d)));
+      else
+        __octave_mcp_s__.size = size(__octave_mcp_y__);
+        __octave_mcp_st__ = max(1, ceil(numel(__octave_mcp_y__) / %[1]d));
+      end
+      __octave_mcp_s__.stride = __octave_mcp_st__;
+      __octave_mcp_s__.xdata = __octave_mcp_x__(1:__octave_mcp_st__:end, 1:__octave_mcp_st__:end);
+      __octave_mcp_s__.ydata = __octave_mcp_y__(1:__octave_mcp_st__:end, 1:__octave_mcp_st__:end);
+      if !isempty(__octave_mcp_z__)
+        __octave_mcp_s__.zdata = __octave_mcp_z__(1:__octave_mcp_st__:end, 1:__octave_mcp_st__:end);
+      end
+      __octave_mcp_a__.series{end+1} = __octave_mcp_s__;
+    end
+    __octave_mcp_data__.axes{end+1} = __octave_mcp_a__;
+`
+
+// plotDataWrite saves the collected data as figure-<n>.json in the directory
+const plotDataWrite = `  __octave_mcp_fid__ = fopen(sprintf("%%s/figure-%%d.json", %s, __octave_mcp_i__), "w");
+  fputs(__octave_mcp_fid__, jsonencode(__octave_mcp_data__));
+  fclose(__octave_mcp_fid__);
+`
+
+// plotDataScripts returns the snippets plotScript inserts to collect the
+// data of each figure, or empty strings when opts does not ask for it
+func plotDataScripts(dir string, opts PlotOptions) (init, axes, write string) {
+	if !opts.Data {
+		return "", "", ""
+	}
+	return plotDataInit, fmt.Sprintf(plotDataAxes, maxPlotDataPoints), fmt.Sprintf(plotDataWrite, octaveString(dir))
+}
+
+// readFigureData loads the data written for figure n. A missing file yields
+// nil, data that is too large or malformed is reported as a warning.
+func readFigureData(dir *os.Root, n int) (*FigureData, string) {
+	name := fmt.Sprintf("figure-%d.json", n)
+	if _, err := dir.Lstat(name); err != nil {
+		return nil, ""
+	}
+	f, info, err := openExchangeFile(dir, name)
+	if err != nil {
+		return nil, fmt.Sprintf("figure %d: failed to read data: %v", n, err)
+	}
+	defer f.Close()
+	if info.Size() > maxPlotDataBytes {
+		return nil, fmt.Sprintf("figure %d: data omitted, %d bytes exceed the %d byte limit", n, info.Size(), maxPlotDataBytes)
+	}
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Sprintf("figure %d: failed to read data: %v", n, err)
+	}
+	var data FigureData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Sprintf("figure %d: failed to decode data: %v", n, err)
+	}
+	return &data, ""
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadFigureData(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"axes":[{"title":"Sine","xlabel":"t","ylabel":"","zlabel":"","xlim":[0,10],"ylim":[-1,1],"zlim":[-1,1],` +
+		`"series":[{"type":"line","label":"sin","xdata":[0,5,10],"ydata":[0,null,0],"size":[1,3],"stride":1}]}],"legends":[["sin"]]}`
+	files := map[string]string{
+		"figure-1.json": data,
+		"figure-2.json": `{"axes": 1}`,
+		"figure-3.json": strings.Repeat(" ", maxPlotDataBytes+1),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := openRoot(t, dir)
+	fig, warning := readFigureData(root, 1)
+	if warning != "" {
+		t.Fatal(warning)
+	}
+	if len(fig.Axes) != 1 || fig.Axes[0].Title != "Sine" || fig.Axes[0].XLabel != "t" {
+		t.Fatalf("Unexpected axes: %+v", fig.Axes)
+	}
+	series := fig.Axes[0].Series
+	if len(series) != 1 || series[0].Type != "line" || series[0].Label != "sin" || series[0].Stride != 1 {
+		t.Fatalf("Unexpected series: %+v", series)
+	}
+	if string(series[0].YData) != "[0,null,0]" || series[0].ZData != nil {
+		t.Errorf("Unexpected data: y %s, z %s", series[0].YData, series[0].ZData)
+	}
+	if len(fig.Legends) != 1 || fig.Legends[0][0] != "sin" {
+		t.Errorf("Unexpected legends: %q", fig.Legends)
+	}
+
+	if _, warning := readFigureData(root, 2); !strings.Contains(warning, "failed to decode data") {
+		t.Errorf("Expected decode warning, got: %q", warning)
+	}
+	if _, warning := readFigureData(root, 3); !strings.Contains(warning, "data omitted") {
+		t.Errorf("Expected size warning, got: %q", warning)
+	}
+	if fig, warning := readFigureData(root, 4); fig != nil || warning != "" {
+		t.Errorf("Expected nothing for a missing file, got: %v, %q", fig, warning)
+	}
+}
+
+func TestPlotScript_Data(t *testing.T) {
+	script := plotScript("plot(1:3);", "/tmp/octave-plot-1", "png", PlotOptions{Data: true})
+	for _, want := range []string{
+		`__octave_mcp_data__.legends = {};`,
+		`ceil(sqrt(numel(__octave_mcp_z__) / 10000))`,
+		`fopen(sprintf("%s/figure-%d.json", ` + octaveString("/tmp/octave-plot-1") + `, __octave_mcp_i__), "w");`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("Expected wrapper to contain %q:\n%s", want, script)
+		}
+	}
+
+	if script := plotScript("plot(1:3);", "/tmp/octave-plot-1", "png", PlotOptions{}); strings.Contains(script, "jsonencode") {
+		t.Errorf("Expected no data extraction by default:\n%s", script)
+	}
+}
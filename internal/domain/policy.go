@@ -0,0 +1,242 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Tool names used to select per-tool policy overrides
+const (
+	ToolRunOctave    = "run_octave"
+	ToolGeneratePlot = "generate_plot"
+)
+
+// Policy modes
+const (
+	// PolicyModeDenylist allows every function except the denied ones
+	PolicyModeDenylist = "denylist"
+	// PolicyModeAllowlist only allows the listed functions, the functions the
+	// script defines and the variables it definitely assigned before their use.
+	// Denied functions stay denied.
+	PolicyModeAllowlist = "allowlist"
+)
+
+// ruleDynamicDispatch is reported for dispatcher calls whose target cannot be
+// checked, it is built in and applies in every mode
+const ruleDynamicDispatch = "dynamic_dispatch"
+
+// rulePkg is reported for pkg actions other than loading, unloading, listing
+// and describing packages. It is built in and applies in every mode.
+const rulePkg = "pkg"
+
+// rulePrintPipe is reported for print targets that pipe the output to a shell
+// command. It is built in and applies in every mode.
+const rulePrintPipe = "print_pipe"
+
+// packageNameRe matches Octave package names
+var packageNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// Policy decides which functions scripts may call. It is loaded from the JSON
+// file named by OCTAVE_POLICY_FILE, for example:
+//
+//	{
+//	  "mode": "denylist",
+//	  "deny": ["fopen", "fwrite", "delete"],
+//	  "packages": ["signal", "statistics"],
+//	  "tools": {
+//	    "generate_plot": {"mode": "allowlist", "allow": ["plot", "linspace", "sin"]}
+//	  }
+//	}
+//
+// Deny lists add to the built-in deny list. Fields set in a tool override
+// replace the top-level value for that tool.
+type Policy struct {
+	// Mode is PolicyModeDenylist (default) or PolicyModeAllowlist
+	Mode string `json:"mode,omitempty"`
+	// Deny lists forbidden functions in addition to the built-in list
+	Deny []string `json:"deny,omitempty"`
+	// ReplaceDefaultDeny drops the built-in deny list so that only the deny
+	// lists apply
+	ReplaceDefaultDeny bool `json:"replace_default_deny,omitempty"`
+	// Allow lists the functions permitted in allowlist mode
+	Allow []string `json:"allow,omitempty"`
+	// Packages lists the installed Octave packages scripts may load, through
+	// the packages option or pkg load. No package may be loaded by default.
+	Packages []string `json:"packages,omitempty"`
+	// Tools holds overrides keyed by tool name, e.g. run_octave
+	Tools map[string]ToolPolicy `json:"tools,omitempty"`
+
+	validators map[string]*validator
+	// workspaceValidators apply to scripts running in a session, whose file
+	// I/O is confined to the session workspace
+	workspaceValidators map[string]*validator
+}
+
+// ToolPolicy overrides the top-level policy for a single tool
+type ToolPolicy struct {
+	Mode  string   `json:"mode,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+	Allow []string `json:"allow,omitempty"`
+}
+
+// DefaultPolicy returns the policy used when no policy file is configured
+func DefaultPolicy() *Policy {
+	p := &Policy{}
+	if err := p.compile(); err != nil {
+		// The built-in policy is always valid
+		panic(err)
+	}
+	return p
+}
+
+// LoadPolicy reads and validates a policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses a JSON policy. Unknown fields are rejected so that typos
+// do not silently weaken the policy.
+func ParsePolicy(data []byte) (*Policy, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	p := &Policy{}
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return p, nil
+}
+
+// compile builds one validator per known tool plus a fallback
+func (p *Policy) compile() error {
+	if err := checkMode(p.Mode, "mode"); err != nil {
+		return err
+	}
+	for _, name := range p.Packages {
+		if !packageNameRe.MatchString(name) {
+			return fmt.Errorf("invalid package name in packages: %q", name)
+		}
+	}
+	for tool, tp := range p.Tools {
+		if tool != ToolRunOctave && tool != ToolGeneratePlot {
+			return fmt.Errorf("unknown tool in tools: %s", tool)
+		}
+		if err := checkMode(tp.Mode, "tools."+tool+".mode"); err != nil {
+			return err
+		}
+	}
+
+	p.validators = map[string]*validator{"": p.validatorFor("", false)}
+	p.workspaceValidators = map[string]*validator{"": p.validatorFor("", true)}
+	for _, tool := range []string{ToolRunOctave, ToolGeneratePlot} {
+		p.validators[tool] = p.validatorFor(tool, false)
+		p.workspaceValidators[tool] = p.validatorFor(tool, true)
+	}
+	return nil
+}
+
+func checkMode(mode, field string) error {
+	switch mode {
+	case "", PolicyModeDenylist, PolicyModeAllowlist:
+		return nil
+	}
+	return fmt.Errorf("%s must be %s or %s, got %q", field, PolicyModeDenylist, PolicyModeAllowlist, mode)
+}
+
+// validatorFor resolves the effective rules for a tool. Rules are named after
+// the policy field that defines them so violations can point at it. Deny lists
+// extend the built-in one unless ReplaceDefaultDeny is set. In a session
+// workspace the built-in list lets load and save through, their paths are
+// checked instead.
+func (p *Policy) validatorFor(tool string, workspace bool) *validator {
+	mode := p.Mode
+	deny, denyRule := p.Deny, "deny"
+	allow, allowRule := p.Allow, "allow"
+
+	if tp, ok := p.Tools[tool]; ok {
+		prefix := "tools." + tool + "."
+		if tp.Mode != "" {
+			mode = tp.Mode
+		}
+		if tp.Deny != nil {
+			deny, denyRule = tp.Deny, prefix+"deny"
+		}
+		if tp.Allow != nil {
+			allow, allowRule = tp.Allow, prefix+"allow"
+		}
+	}
+
+	v := &validator{denied: make(map[string]string)}
+	if !p.ReplaceDefaultDeny {
+		for _, name := range defaultDeniedFunctions {
+			if !workspace || fileFunctions[name] == 0 {
+				v.denied[name] = "deny"
+			}
+		}
+	}
+	for _, name := range deny {
+		v.denied[name] = denyRule
+	}
+	v.workspace = workspace
+	v.packages = make(map[string]bool, len(p.Packages))
+	for _, name := range p.Packages {
+		v.packages[name] = true
+	}
+	if mode == PolicyModeAllowlist {
+		v.allowed = make(map[string]bool, len(allow))
+		for _, name := range allow {
+			v.allowed[name] = true
+		}
+		v.allowRule = allowRule
+	}
+	return v
+}
+
+// Validate checks a script against the rules that apply to the given tool
+func (p *Policy) Validate(tool, script string) error {
+	return p.validate(p.validators, tool, script)
+}
+
+// ValidateWorkspace checks a script that runs in a session, where file I/O
+// functions may only name files in the session workspace
+func (p *Policy) ValidateWorkspace(tool, script string) error {
+	return p.validate(p.workspaceValidators, tool, script)
+}
+
+func (p *Policy) validate(validators map[string]*validator, tool, script string) error {
+	v, ok := validators[tool]
+	if !ok {
+		v = validators[""]
+	}
+	return v.validate(script)
+}
+
+// AllowedPackages returns the packages scripts may load
+func (p *Policy) AllowedPackages() []string {
+	return slices.Clone(p.Packages)
+}
+
+// CheckPackages verifies that every requested package may be loaded
+func (p *Policy) CheckPackages(names []string) error {
+	for _, name := range names {
+		if slices.Contains(p.Packages, name) {
+			continue
+		}
+		if len(p.Packages) == 0 {
+			return fmt.Errorf("package %s is not allowed, no package may be loaded", name)
+		}
+		return fmt.Errorf("package %s is not allowed (allowed: %s)", name, strings.Join(p.Packages, ", "))
+	}
+	return nil
+}
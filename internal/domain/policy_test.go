@@ -0,0 +1,282 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		errMsg string
+	}{
+		{name: "malformed JSON", policy: `{"deny": [`, errMsg: "invalid policy"},
+		{name: "unknown field", policy: `{"denied": ["fopen"]}`, errMsg: `unknown field "denied"`},
+		{name: "unknown mode", policy: `{"mode": "strict"}`, errMsg: `mode must be denylist or allowlist, got "strict"`},
+		{name: "unknown tool", policy: `{"tools": {"run": {}}}`, errMsg: "unknown tool in tools: run"},
+		{name: "unknown tool mode", policy: `{"tools": {"run_octave": {"mode": "x"}}}`, errMsg: "tools.run_octave.mode must be"},
+		{name: "invalid package", policy: `{"packages": ["signal; system"]}`, errMsg: "invalid package name in packages"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(tt.policy))
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"deny": ["fopen"], "replace_default_deny": true}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Validate(ToolRunOctave, "save('f')"); err != nil {
+		t.Errorf("Expected save to be allowed, got: %v", err)
+	}
+	if err := policy.Validate(ToolRunOctave, "fopen('f')"); err == nil {
+		t.Error("Expected fopen to be denied")
+	}
+
+	if _, err := LoadPolicy(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing policy file")
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{
+		"deny": ["system", "fopen"],
+		"packages": ["signal"],
+		"tools": {
+			"run_octave": {"deny": ["fwrite"]},
+			"generate_plot": {
+				"mode": "allowlist",
+				"allow": ["plot", "linspace", "sin", "title", "feval"]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tool   string
+		script string
+		rule   string
+		fn     string
+	}{
+		{name: "deny list keeps the built-in list", tool: "other", script: "x = 1; save('out.mat', 'x');", rule: "deny", fn: "save"},
+		{name: "deny list blocks fopen", tool: "other", script: "fid = fopen('f');", rule: "deny", fn: "fopen"},
+		{name: "tool deny list keeps the built-in list", tool: ToolRunOctave, script: "popen('ls', 'r')", rule: "deny", fn: "popen"},
+		{name: "tool deny list blocks fwrite", tool: ToolRunOctave, script: "fwrite(1, 'x')", rule: "tools.run_octave.deny", fn: "fwrite"},
+		{name: "tool deny list replaces the top-level one", tool: ToolRunOctave, script: "fid = fopen('f');"},
+		{name: "dynamic dispatch is always checked", tool: ToolRunOctave, script: "feval(name)", rule: "dynamic_dispatch", fn: "feval"},
+		{name: "allowlist permits listed functions", tool: ToolGeneratePlot, script: "x = linspace(0, 1); plot(x, sin(x)); title('s');"},
+		{name: "allowlist permits script variables", tool: ToolGeneratePlot, script: "y = 2; f = @() sin(y) * y; plot(f());"},
+		{name: "allowlist permits variables shadowing functions", tool: ToolGeneratePlot, script: "cos = [1 2]; plot(cos(1));"},
+		{name: "allowlist permits script functions", tool: ToolGeneratePlot, script: "function r = twice(x)\n  r = 2;\nend\nplot(twice(1)); feval('twice', 1);"},
+		{name: "allowlist rejects parameters shadowing functions", tool: ToolGeneratePlot, script: "function r = f(cos)\n  r = cos(1);\nend\nx = cos(1);", rule: "tools.generate_plot.allow", fn: "cos"},
+		{name: "allowlist rejects parameters outside their function", tool: ToolGeneratePlot, script: "function r = f(cos)\n  r = 1;\nend\nx = cos(1);", rule: "tools.generate_plot.allow", fn: "cos"},
+		{name: "allowlist rejects conditional assignments", tool: ToolGeneratePlot, script: "if 0, cos = 0; end\nplot(cos(1));", rule: "tools.generate_plot.allow", fn: "cos"},
+		{name: "allowlist rejects uses before assignment", tool: ToolGeneratePlot, script: "plot(cos(1)); cos = 1;", rule: "tools.generate_plot.allow", fn: "cos"},
+		{name: "allowlist rejects anonymous parameters", tool: ToolGeneratePlot, script: "f = @(cos) cos(1);", rule: "tools.generate_plot.allow", fn: "cos"},
+		{name: "allowlist checks dispatched names of variables", tool: ToolGeneratePlot, script: "cos = 1; feval('cos', 1)", rule: "tools.generate_plot.allow", fn: "cos"},
+		{name: "allowlist rejects other functions", tool: ToolGeneratePlot, script: "x = linspace(0, 1);\nplot(x, cos(x));", rule: "tools.generate_plot.allow", fn: "cos"},
+		{name: "allowlist checks dispatched names", tool: ToolGeneratePlot, script: "feval('cos', 1)", rule: "tools.generate_plot.allow", fn: "cos"},
+		{name: "allowlist keeps inherited deny list", tool: ToolGeneratePlot, script: "system('ls')", rule: "deny", fn: "system"},
+		{name: "unknown tool uses top-level rules", tool: "other", script: "cos(1)"},
+		{name: "pkg loads allowed packages", tool: ToolRunOctave, script: "pkg load signal\npkg('load', 'signal'); pkg list"},
+		{name: "pkg rejects other packages", tool: ToolRunOctave, script: "pkg load signal symbolic", rule: "packages", fn: "pkg"},
+		{name: "pkg install is blocked", tool: ToolRunOctave, script: "pkg install -forge signal", rule: "pkg", fn: "pkg"},
+		{name: "pkg uninstall is blocked", tool: ToolRunOctave, script: `pkg("uninstall", "signal")`, rule: "pkg", fn: "pkg"},
+		{name: "pkg arguments must be literals", tool: ToolRunOctave, script: `action = "install"; pkg(action, "signal")`, rule: "pkg", fn: "pkg"},
+		{name: "pkg through a dispatcher", tool: ToolRunOctave, script: `feval("pkg", "install", "signal")`, rule: "pkg", fn: "pkg"},
+		{name: "pkg handle", tool: ToolRunOctave, script: "f = @pkg;", rule: "pkg", fn: "pkg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.tool, tt.script)
+			if tt.rule == "" {
+				if err != nil {
+					t.Errorf("Expected script to pass, got: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected ValidationError, got: %v", err)
+			}
+			v := validationErr.Violations[0]
+			if v.Rule != tt.rule || v.Function != tt.fn {
+				t.Errorf("Expected %s from rule %s, got %s from rule %s", tt.fn, tt.rule, v.Function, v.Rule)
+			}
+			if !strings.Contains(err.Error(), "(rule "+tt.rule+")") {
+				t.Errorf("Expected error to name rule %s, got: %v", tt.rule, err)
+			}
+		})
+	}
+}
+
+func TestPolicy_CheckPackages(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"packages": ["signal", "statistics"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.CheckPackages([]string{"statistics", "signal"}); err != nil {
+		t.Errorf("Expected allowed packages to pass, got: %v", err)
+	}
+	err = policy.CheckPackages([]string{"signal", "symbolic"})
+	if err == nil || err.Error() != "package symbolic is not allowed (allowed: signal, statistics)" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := DefaultPolicy().CheckPackages([]string{"signal"}); err == nil || !strings.Contains(err.Error(), "no package may be loaded") {
+		t.Errorf("Expected no package to be allowed by default, got: %v", err)
+	}
+}
+
+func TestPolicy_ValidateWorkspace(t *testing.T) {
+	policy := DefaultPolicy()
+
+	tests := []struct {
+		name   string
+		script string
+		fn     string
+		rule   string
+	}{
+		{name: "load and save workspace files", script: "x = load('data.mat');\nsave out.mat x\nsave('-ascii', 'out.txt', 'x');"},
+		{name: "file functions with literal names", script: `m = csvread("in.csv"); fid = fopen("log.txt", "w"); copyfile("a.csv", "b.csv");`},
+		{name: "save without file name", script: "x = 1; save"},
+		{name: "absolute path", script: "load('/etc/passwd')", fn: "load", rule: "workspace"},
+		{name: "parent directory", script: `fid = fopen("../secret.txt");`, fn: "fopen", rule: "workspace"},
+		{name: "subdirectory in command syntax", script: "save dir/out.mat x", fn: "save", rule: "workspace"},
+		{name: "second path of copyfile", script: `copyfile("a.csv", "/tmp/b.csv")`, fn: "copyfile", rule: "workspace"},
+		{name: "dynamic path", script: "name = 'x.mat'; load(name)", fn: "load", rule: "workspace"},
+		{name: "code file", script: `fid = fopen("f.m", "w");`, fn: "fopen", rule: "workspace"},
+		{name: "handle to file function", script: "f = @load;", fn: "load", rule: "workspace"},
+		{name: "file function through a dispatcher", script: `feval("save", "/tmp/x.mat")`, fn: "save", rule: "workspace"},
+		{name: "changing directory", script: "cd /tmp", fn: "cd", rule: "workspace"},
+		{name: "deny list still applies", script: "system('ls')", fn: "system", rule: "deny"},
+		{name: "source a data file", script: `source("x.txt")`, fn: "source", rule: "workspace"},
+		{name: "run a data file", script: `run x.txt`, fn: "run", rule: "workspace"},
+		{name: "autoload from a data file", script: `autoload("f", "x.txt")`, fn: "autoload", rule: "workspace"},
+		{name: "extract an archive", script: `unzip("data.zip")`, fn: "unzip", rule: "workspace"},
+		{name: "extract an archive elsewhere", script: `untar("data.tar", "/tmp")`, fn: "untar", rule: "workspace"},
+		{name: "extract through a dispatcher", script: `feval("gunzip", "f.m.gz")`, fn: "gunzip", rule: "workspace"},
+		{name: "unpack an archive", script: `unpack("upload.zip")`, fn: "unpack", rule: "workspace"},
+		{name: "escaped code file", script: `fid = fopen("evil\x2em", "w");`, fn: "fopen", rule: "workspace"},
+		{name: "escaped parent directory", script: "mkdir(\"a\");\nfid = fopen(\"a\\x2f..\\x2f..\\x2fetc\\x2fpasswd\");", fn: "fopen", rule: "workspace"},
+		{name: "directory in the workspace", script: `mkdir("results")`},
+		{name: "directory elsewhere", script: `mkdir("/tmp", "x")`, fn: "mkdir", rule: "workspace"},
+		{name: "type a host file", script: "type /etc/passwd", fn: "type", rule: "workspace"},
+		{name: "type a workspace file", script: "type notes.txt"},
+		{name: "file function read as an expression", script: "stat /etc/shadow", fn: "stat", rule: "workspace"},
+		{name: "ls", script: `ls("; id")`, fn: "ls", rule: "deny"},
+		{name: "list the workspace", script: "d = dir(); f = dir(\"*.csv\"); n = readdir(\".\"); g = glob(\"data_?.txt\");"},
+		{name: "list a host directory", script: `d = dir("/etc")`, fn: "dir", rule: "workspace"},
+		{name: "read a host directory", script: `n = readdir("..")`, fn: "readdir", rule: "workspace"},
+		{name: "glob outside the workspace", script: `g = glob("../*")`, fn: "glob", rule: "workspace"},
+		{name: "exist for a variable", script: `x = 1; e = exist("x", "var");`},
+		{name: "exist for a host file", script: `e = exist("/etc/passwd", "file");`, fn: "exist", rule: "workspace"},
+		{name: "stat a host file", script: `s = stat("/etc/shadow");`, fn: "stat", rule: "workspace"},
+		{name: "lstat a host file", script: `s = lstat("/etc/shadow");`, fn: "lstat", rule: "workspace"},
+		{name: "isfile on a host file", script: `b = isfile("/etc/passwd");`, fn: "isfile", rule: "workspace"},
+		{name: "saveas into the workspace", script: `saveas(gcf(), "out.png")`},
+		{name: "saveas elsewhere", script: `saveas(1, "/tmp/out.png")`, fn: "saveas", rule: "workspace"},
+		{name: "hgsave elsewhere", script: `hgsave("/tmp/fig.ofig")`, fn: "hgsave", rule: "workspace"},
+		{name: "hgload a host file", script: `h = hgload("/tmp/fig.ofig");`, fn: "hgload", rule: "workspace"},
+		{name: "xlsread a host file", script: `x = xlsread("/tmp/a.xlsx");`, fn: "xlsread", rule: "workspace"},
+		{name: "xlswrite elsewhere", script: `xlswrite("/tmp/a.xlsx", 1)`, fn: "xlswrite", rule: "workspace"},
+		{name: "dlmread a host file", script: `x = dlmread("/etc/hosts");`, fn: "dlmread", rule: "workspace"},
+		{name: "fdisp to a file id", script: `fid = fopen("out.txt", "w"); fdisp(fid, 1); fskipl(fid);`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.ValidateWorkspace(ToolRunOctave, tt.script)
+			if tt.rule == "" {
+				if err != nil {
+					t.Errorf("Expected script to pass, got: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected ValidationError, got: %v", err)
+			}
+			v := validationErr.Violations[0]
+			if v.Rule != tt.rule || v.Function != tt.fn {
+				t.Errorf("Expected %s from rule %s, got %s from rule %s (%s)", tt.fn, tt.rule, v.Function, v.Rule, v.Message)
+			}
+		})
+	}
+
+	// Outside a session load and save stay denied
+	if err := policy.Validate(ToolRunOctave, "load('data.mat')"); err == nil {
+		t.Error("Expected load to be denied outside a session")
+	}
+
+	// Compiling stays denied when the built-in list is replaced
+	replaced, err := ParsePolicy([]byte(`{"replace_default_deny": true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var validationErr *ValidationError
+	err = replaced.ValidateWorkspace(ToolRunOctave, `mkoctfile("upload.cc")`)
+	if !errors.As(err, &validationErr) || validationErr.Violations[0].Rule != "workspace" {
+		t.Errorf("Expected mkoctfile to be denied in a session workspace, got: %v", err)
+	}
+}
+
+func TestResolveNames(t *testing.T) {
+	script := `x = 1;
+[a, ~, b] = size(ones(2, 2, 2));
+s.field = 2;
+m(3) = 4;
+for i = 1:3
+  k = i;
+end
+k
+function out = helper(p, q)
+  out = p + q;
+endfunction
+helper(1, 2)
+global g1 g2
+f = @(u, v) u + v;
+try
+  error('x');
+catch err
+  err
+end
+if true, y = 2, end
+y`
+
+	tokens, err := tokenize(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := resolveNames(tokens)
+	var variables []string
+	for _, tok := range tokens {
+		if tok.Kind == tokenIdent && names.isVariable(tok) {
+			variables = append(variables, fmt.Sprintf("%s:%d", tok.Text, tok.Line))
+		}
+	}
+	// Uses after a loop, conditional or try body and parameter uses are calls
+	expected := "x:1 a:2 b:2 s:3 m:4 i:5 k:6 i:6 out:9 helper:9 p:9 q:9 out:10 helper:12 g1:13 g2:13 f:14 u:14 v:14 err:17 err:18 y:20"
+	if got := strings.Join(variables, " "); got != expected {
+		t.Errorf("Expected variables %s, got %s", expected, got)
+	}
+}
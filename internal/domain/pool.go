@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkerMaxExecutions = 100
+	workerResetTimeout         = 5 * time.Second
+)
+
+// workerResetScript restores a borrowed interpreter to the state it booted
+// in: variables, functions, figures, output format, loaded packages, random
+// number generators and working directory. It fails if the working directory
+// no longer holds the entries it started with, because files a script left
+// there could shadow the functions the next one calls.
+const workerResetScript = `close all; format;
+rand("state", "reset"); randn("state", "reset");
+__octave_mcp_p__ = pkg("list");
+for __octave_mcp_k__ = 1:numel(__octave_mcp_p__)
+  if __octave_mcp_p__{__octave_mcp_k__}.loaded
+    pkg("unload", __octave_mcp_p__{__octave_mcp_k__}.name);
+  end
+end
+cd(%s);
+__octave_mcp_d__ = readdir(".");
+__octave_mcp_e__ = {%s};
+if !isequal(sort(__octave_mcp_d__(:)), sort(__octave_mcp_e__(:)))
+  error("working directory modified");
+end
+clear all;`
+
+// workerPool keeps pre-started interpreters warm so executions do not pay the
+// Octave boot time. Workers are reset between executions and recycled after a
+// fixed number of them or as soon as one fails. State the reset does not
+// cover, such as the warning state, lasts until the worker is recycled.
+type workerPool struct {
+	logger   *slog.Logger
+	sandbox  *sandbox
+	size     int
+	maxExecs int
+	idle     chan *worker
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newWorkerPool(size int, maxExecs int, sb *sandbox, logger *slog.Logger) *workerPool {
+	return &workerPool{
+		logger:   logger,
+		sandbox:  sb,
+		size:     size,
+		maxExecs: maxExecs,
+		idle:     make(chan *worker, size),
+		closed:   make(chan struct{}),
+	}
+}
+
+// fill starts workers in the background until the pool is full
+func (p *workerPool) fill() {
+	for i := len(p.idle); i < p.size; i++ {
+		p.spawn()
+	}
+}
+
+// spawn starts a single worker in the background and adds it to the pool
+func (p *workerPool) spawn() {
+	select {
+	case <-p.closed:
+		return
+	default:
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultWorkerStartupSeconds*time.Second)
+		defer cancel()
+		w, err := startWorker(ctx, p.logger, p.sandbox)
+		if err != nil {
+			p.logger.Warn("Failed to start pooled octave worker", "error", err)
+			return
+		}
+		p.offer(w)
+	}()
+}
+
+// get borrows an idle worker, booting a new one if the pool is empty
+func (p *workerPool) get(ctx context.Context) (*worker, error) {
+	for {
+		select {
+		case w := <-p.idle:
+			if w.stopped() {
+				p.spawn()
+				continue
+			}
+			return w, nil
+		default:
+			p.logger.Debug("Worker pool empty, starting octave on demand")
+			ctx, cancel := context.WithTimeout(ctx, defaultWorkerStartupSeconds*time.Second)
+			defer cancel()
+			return startWorker(ctx, p.logger, p.sandbox)
+		}
+	}
+}
+
+// put returns a borrowed worker. Workers that failed, died or reached their
+// execution budget are replaced, the others get a clean workspace first.
+func (p *workerPool) put(w *worker, execErr error) {
+	w.execs++
+	if execErr != nil || w.stopped() || w.execs >= p.maxExecs {
+		w.kill()
+		p.spawn()
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), workerResetTimeout)
+		defer cancel()
+		if _, err := w.exec(ctx, resetScript(w), captureOptions{}); err != nil {
+			p.logger.Warn("Failed to reset octave worker", "error", err)
+			w.kill()
+			p.spawn()
+			return
+		}
+		p.offer(w)
+	}()
+}
+
+// resetScript returns the workerResetScript of w
+func resetScript(w *worker) string {
+	entries := make([]string, len(w.homeEntries))
+	for i, name := range w.homeEntries {
+		entries[i] = octaveString(name)
+	}
+	return fmt.Sprintf(workerResetScript, octaveString(w.home), strings.Join(entries, ", "))
+}
+
+// offer adds a worker to the idle set, closing it if the pool is full or shut down
+func (p *workerPool) offer(w *worker) {
+	select {
+	case <-p.closed:
+		w.close()
+		return
+	default:
+	}
+	select {
+	case p.idle <- w:
+	default:
+		w.close()
+	}
+}
+
+// shutdown closes every idle worker. Borrowed workers are closed when returned.
+func (p *workerPool) shutdown() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+	for {
+		select {
+		case w := <-p.idle:
+			w.close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrMemoryLimit is returned when a script exceeds OCTAVE_RLIMIT_AS
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+	// ErrCPULimit is returned when a script exceeds OCTAVE_RLIMIT_CPU
+	ErrCPULimit = errors.New("cpu time limit exceeded")
+	// ErrProcessLimit is returned when a script exceeds OCTAVE_RLIMIT_NPROC
+	ErrProcessLimit = errors.New("process limit exceeded")
+	// ErrFileSizeLimit is returned when a script exceeds OCTAVE_RLIMIT_FSIZE
+	ErrFileSizeLimit = errors.New("file size limit exceeded")
+	// ErrOpenFilesLimit is returned when a script exceeds OCTAVE_RLIMIT_NOFILE
+	ErrOpenFilesLimit = errors.New("open files limit exceeded")
+	// ErrCPUBudget is returned when the caller has no CPU time left, see
+	// ExecOptions.CPUBudget
+	ErrCPUBudget = errors.New("cpu time budget exhausted")
+)
+
+// resourceLimits are the OS limits applied to every interpreter process.
+// Zero disables a limit. Limits are only enforced on Linux.
+type resourceLimits struct {
+	// addressSpace is RLIMIT_AS in bytes
+	addressSpace uint64
+	// cpu is RLIMIT_CPU in seconds, enforced per execution rather than over
+	// the lifetime of the long-lived interpreter
+	cpu uint64
+	// processes is RLIMIT_NPROC. Linux counts every process of the user, not
+	// only the children of the interpreter.
+	processes uint64
+	// fileSize is RLIMIT_FSIZE in bytes
+	fileSize uint64
+	// openFiles is RLIMIT_NOFILE
+	openFiles uint64
+}
+
+// loadResourceLimits reads the limits from the environment
+func loadResourceLimits(logger *slog.Logger) resourceLimits {
+	return resourceLimits{
+		addressSpace: parseLimit(logger, "OCTAVE_RLIMIT_AS") << 20,
+		cpu:          parseLimit(logger, "OCTAVE_RLIMIT_CPU"),
+		processes:    parseLimit(logger, "OCTAVE_RLIMIT_NPROC"),
+		fileSize:     parseLimit(logger, "OCTAVE_RLIMIT_FSIZE") << 20,
+		openFiles:    parseLimit(logger, "OCTAVE_RLIMIT_NOFILE"),
+	}
+}
+
+// parseLimit reads a non-negative limit, unset or invalid values disable it
+func parseLimit(logger *slog.Logger, name string) uint64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	limit, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		logger.Warn("Invalid "+name+", limit disabled", "value", value)
+		return 0
+	}
+	return limit
+}
+
+// limitMessages are the messages Octave prints when a call fails because of a
+// limit, they identify limits that were hit without killing the process
+var limitMessages = []struct {
+	text string
+	err  error
+}{
+	{"out of memory", ErrMemoryLimit},
+	{"memory exhausted", ErrMemoryLimit},
+	{"std::bad_alloc", ErrMemoryLimit},
+	{"cpu time limit exceeded", ErrCPULimit},
+	{"file size limit exceeded", ErrFileSizeLimit},
+	{"file too large", ErrFileSizeLimit},
+	{"too many open files", ErrOpenFilesLimit},
+	{"resource temporarily unavailable", ErrProcessLimit},
+}
+
+// classify maps a failed execution to the limit that caused it. Errors that are
+// unrelated to an enabled limit are returned unchanged.
+func (l resourceLimits) classify(err error, stderr string, state *os.ProcessState) error {
+	if err == nil || l == (resourceLimits{}) {
+		return err
+	}
+
+	kind := l.signalLimit(state)
+	if kind == nil {
+		lower := strings.ToLower(stderr)
+		for _, m := range limitMessages {
+			if strings.Contains(lower, m.text) {
+				kind = m.err
+				break
+			}
+		}
+	}
+	if kind == nil {
+		return err
+	}
+
+	var limit string
+	switch kind {
+	case ErrMemoryLimit:
+		if l.addressSpace == 0 {
+			return err
+		}
+		limit = fmt.Sprintf("%d MB", l.addressSpace>>20)
+	case ErrCPULimit:
+		if l.cpu == 0 {
+			return err
+		}
+		limit = fmt.Sprintf("%d s", l.cpu)
+	case ErrProcessLimit:
+		if l.processes == 0 {
+			return err
+		}
+		limit = fmt.Sprintf("%d processes", l.processes)
+	case ErrFileSizeLimit:
+		if l.fileSize == 0 {
+			return err
+		}
+		limit = fmt.Sprintf("%d MB", l.fileSize>>20)
+	case ErrOpenFilesLimit:
+		if l.openFiles == 0 {
+			return err
+		}
+		limit = fmt.Sprintf("%d files", l.openFiles)
+	}
+	return fmt.Errorf("%w (limit %s)", kind, limit)
+}
+
+// isLimitError reports whether err was caused by a resource limit
+func isLimitError(err error) bool {
+	return errors.Is(err, ErrMemoryLimit) || errors.Is(err, ErrCPULimit) ||
+		errors.Is(err, ErrProcessLimit) || errors.Is(err, ErrFileSizeLimit) ||
+		errors.Is(err, ErrOpenFilesLimit)
+}
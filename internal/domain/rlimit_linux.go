@@ -0,0 +1,136 @@
+package domain
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// clockTicks is the kernel USER_HZ used for CPU times in /proc, it is 100 on
+// every supported architecture
+const clockTicks = 100
+
+// apply sets the limits on a freshly started process, before it receives any
+// script
+func (l resourceLimits) apply(pid int) error {
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_AS, l.addressSpace},
+		{unix.RLIMIT_NPROC, l.processes},
+		{unix.RLIMIT_FSIZE, l.fileSize},
+		{unix.RLIMIT_NOFILE, l.openFiles},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := unix.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := unix.Prlimit(pid, limit.resource, &rlimit, nil); err != nil {
+			return fmt.Errorf("failed to set resource limit %d: %w", limit.resource, err)
+		}
+	}
+	return nil
+}
+
+// armCPU allows the process l.cpu more seconds of CPU time from now on. Only
+// the soft limit moves, an unprivileged process cannot raise its hard limit
+// again once lowered.
+func (l resourceLimits) armCPU(pid int) error {
+	if l.cpu == 0 {
+		return nil
+	}
+	used, err := cpuSeconds(pid)
+	if err != nil {
+		return err
+	}
+	var current unix.Rlimit
+	if err := unix.Prlimit(pid, unix.RLIMIT_CPU, nil, &current); err != nil {
+		return fmt.Errorf("failed to read cpu limit: %w", err)
+	}
+	// Round up so a partly used second never eats into the budget
+	rlimit := unix.Rlimit{Cur: used + 1 + l.cpu, Max: current.Max}
+	if rlimit.Cur > rlimit.Max {
+		rlimit.Cur = rlimit.Max
+	}
+	if err := unix.Prlimit(pid, unix.RLIMIT_CPU, &rlimit, nil); err != nil {
+		return fmt.Errorf("failed to set cpu limit: %w", err)
+	}
+	return nil
+}
+
+// cpuSeconds returns the user plus system CPU time consumed by a process
+// itself, the time RLIMIT_CPU counts
+func cpuSeconds(pid int) (uint64, error) {
+	ticks, _, err := cpuTicks(pid)
+	if err != nil {
+		return 0, err
+	}
+	return ticks / clockTicks, nil
+}
+
+// processCPUTime returns the user plus system CPU time consumed by a process
+// and its reaped children, such as gnuplot
+func processCPUTime(pid int) (time.Duration, error) {
+	ticks, children, err := cpuTicks(pid)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ticks+children) * (time.Second / clockTicks), nil
+}
+
+// cpuTicks returns the user plus system CPU time of a process and of its
+// reaped children in clock ticks
+func cpuTicks(pid int) (self, children uint64, err error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read process stats: %w", err)
+	}
+	// The command name may contain spaces, fields are counted after it
+	_, rest, found := strings.Cut(string(data), ") ")
+	if !found {
+		return 0, 0, fmt.Errorf("malformed process stats")
+	}
+	fields := strings.Fields(rest)
+	// utime, stime, cutime and cstime are fields 14 to 17, the state (field
+	// 3) comes first
+	if len(fields) < 15 {
+		return 0, 0, fmt.Errorf("malformed process stats")
+	}
+	var ticks [4]uint64
+	for i := range ticks {
+		if ticks[i], err = strconv.ParseUint(fields[11+i], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("malformed process stats: %w", err)
+		}
+	}
+	return ticks[0] + ticks[1], ticks[2] + ticks[3], nil
+}
+
+// signalLimit identifies limits enforced by the kernel with a signal
+func (l resourceLimits) signalLimit(state *os.ProcessState) error {
+	if state == nil {
+		return nil
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return nil
+	}
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return ErrCPULimit
+	case syscall.SIGXFSZ:
+		return ErrFileSizeLimit
+	case syscall.SIGSEGV, syscall.SIGABRT:
+		// Allocation failures outside Octave's own checks crash the process
+		if l.addressSpace != 0 {
+			return ErrMemoryLimit
+		}
+	}
+	return nil
+}
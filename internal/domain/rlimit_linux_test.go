@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestResourceLimits_Apply(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("Cannot start child process: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	limits := resourceLimits{addressSpace: 256 << 20, openFiles: 32, cpu: 3}
+	if err := limits.apply(cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+	if err := limits.armCPU(cmd.Process.Pid); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []struct {
+		resource int
+		expected uint64
+	}{
+		{unix.RLIMIT_AS, 256 << 20},
+		{unix.RLIMIT_NOFILE, 32},
+		// sleep has used no CPU yet, one second is added for rounding
+		{unix.RLIMIT_CPU, 4},
+	}
+	for _, check := range checks {
+		var rlimit unix.Rlimit
+		if err := unix.Prlimit(cmd.Process.Pid, check.resource, nil, &rlimit); err != nil {
+			t.Fatal(err)
+		}
+		if rlimit.Cur != check.expected {
+			t.Errorf("Resource %d: expected %d, got %d", check.resource, check.expected, rlimit.Cur)
+		}
+	}
+}
+
+func TestResourceLimits_SignalLimit(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "kill -XCPU $$")
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Skipf("Expected the shell to be killed, got: %v", err)
+	}
+
+	limits := resourceLimits{cpu: 1}
+	if got := limits.classify(ErrWorkerExited, "", exitErr.ProcessState); !errors.Is(got, ErrCPULimit) {
+		t.Errorf("Expected cpu limit error, got %v", got)
+	}
+}
+
+func TestCPUSeconds(t *testing.T) {
+	if _, err := cpuSeconds(os.Getpid()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessCPUTime(t *testing.T) {
+	used, err := processCPUTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seconds, err := cpuSeconds(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used < time.Duration(seconds)*time.Second {
+		t.Errorf("Expected at least %d s, got %v", seconds, used)
+	}
+}
+
+func TestProcessCPUTime_Children(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "i=0; while [ $i -lt 300000 ]; do i=$((i+1)); done")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("Failed to run the busy loop: %v", err)
+	}
+	childTime := cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	if childTime < 100*time.Millisecond {
+		t.Skipf("Busy loop too short to measure, took %v", childTime)
+	}
+
+	_, children, err := cpuTicks(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := time.Duration(children) * (time.Second / clockTicks); got < childTime-50*time.Millisecond {
+		t.Errorf("Expected the reaped child's %v to be counted, got %v", childTime, got)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package domain
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// apply is a no-op, resource limits are only supported on Linux
+func (l resourceLimits) apply(pid int) error {
+	return nil
+}
+
+// armCPU is a no-op, resource limits are only supported on Linux
+func (l resourceLimits) armCPU(pid int) error {
+	return nil
+}
+
+// processCPUTime is not supported, CPU time is only measured on Linux while
+// the process runs
+func processCPUTime(pid int) (time.Duration, error) {
+	return 0, errors.New("process CPU time is only available on Linux")
+}
+
+// signalLimit never matches, resource limits are only supported on Linux
+func (l resourceLimits) signalLimit(state *os.ProcessState) error {
+	return nil
+}
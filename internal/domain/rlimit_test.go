@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestLoadResourceLimits(t *testing.T) {
+	t.Setenv("OCTAVE_RLIMIT_AS", "512")
+	t.Setenv("OCTAVE_RLIMIT_CPU", "5")
+	t.Setenv("OCTAVE_RLIMIT_NPROC", "")
+	t.Setenv("OCTAVE_RLIMIT_FSIZE", "-1")
+	t.Setenv("OCTAVE_RLIMIT_NOFILE", "64")
+
+	limits := loadResourceLimits(slog.Default())
+	expected := resourceLimits{addressSpace: 512 << 20, cpu: 5, openFiles: 64}
+	if limits != expected {
+		t.Errorf("Expected %+v, got %+v", expected, limits)
+	}
+}
+
+func TestResourceLimits_Classify(t *testing.T) {
+	all := resourceLimits{addressSpace: 512 << 20, cpu: 5, processes: 32, fileSize: 10 << 20, openFiles: 64}
+
+	tests := []struct {
+		name     string
+		limits   resourceLimits
+		err      error
+		stderr   string
+		expected error
+		message  string
+	}{
+		{
+			name:     "out of memory",
+			limits:   all,
+			err:      ErrScriptFailed,
+			stderr:   "error: out of memory or dimension too large for Octave's index type",
+			expected: ErrMemoryLimit,
+			message:  "memory limit exceeded (limit 512 MB)",
+		},
+		{
+			name:     "cpu time reported before exiting",
+			limits:   all,
+			err:      ErrWorkerExited,
+			stderr:   "fatal: caught signal CPU time limit exceeded -- stopping myself...",
+			expected: ErrCPULimit,
+			message:  "cpu time limit exceeded (limit 5 s)",
+		},
+		{
+			name:     "file size",
+			limits:   all,
+			err:      ErrScriptFailed,
+			stderr:   "error: fwrite: File too large",
+			expected: ErrFileSizeLimit,
+			message:  "file size limit exceeded (limit 10 MB)",
+		},
+		{
+			name:     "open files",
+			limits:   all,
+			err:      ErrScriptFailed,
+			stderr:   "error: fopen: Too many open files",
+			expected: ErrOpenFilesLimit,
+			message:  "open files limit exceeded (limit 64 files)",
+		},
+		{
+			name:     "unrelated error",
+			limits:   all,
+			err:      ErrScriptFailed,
+			stderr:   "error: 'x' undefined",
+			expected: ErrScriptFailed,
+			message:  ErrScriptFailed.Error(),
+		},
+		{
+			name:     "limit not enabled",
+			limits:   resourceLimits{cpu: 5},
+			err:      ErrScriptFailed,
+			stderr:   "error: out of memory or dimension too large for Octave's index type",
+			expected: ErrScriptFailed,
+			message:  ErrScriptFailed.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.limits.classify(tt.err, tt.stderr, nil)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+			if err.Error() != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, err.Error())
+			}
+		})
+	}
+
+	if err := all.classify(nil, "out of memory", nil); err != nil {
+		t.Errorf("Expected nil for successful execution, got %v", err)
+	}
+}
@@ -7,6 +7,12 @@ import (
 // RunnerInterface defines the interface for executing Octave scripts
 type RunnerInterface interface {
 	ExecuteScript(ctx context.Context, script string) (string, error)
+	Execute(ctx context.Context, script string, opts ExecOptions) (*ExecResult, error)
 	GeneratePlot(ctx context.Context, script string, format string) ([]byte, error)
+	Plot(ctx context.Context, script string, format string, opts ExecOptions) (*PlotResult, error)
+	CheckSyntax(ctx context.Context, script string, tool string, opts ExecOptions) (*SyntaxCheck, error)
+	Help(ctx context.Context, name string, opts ExecOptions) (*HelpResult, error)
+	Lookfor(ctx context.Context, keyword string, opts ExecOptions) (*LookforResult, error)
+	ListPackages(ctx context.Context, opts ExecOptions) ([]PackageInfo, error)
 	GetVersion() string
 }
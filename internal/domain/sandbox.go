@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+)
+
+// Sandbox modes selected with OCTAVE_SANDBOX
+const (
+	SandboxNone       = "none"
+	SandboxNamespaces = "namespaces"
+)
+
+// sandboxTmpfsSize caps the private tmpfs that backs the sandbox root, its
+// working directory and HOME
+const sandboxTmpfsSize = "64m"
+
+// sandbox starts interpreters isolated from the host. The script validator is
+// not a security boundary, the sandbox is: even a script that slips past it
+// cannot write outside its private tmpfs or reach the network.
+type sandbox struct {
+	// exchangeDir holds one directory per interpreter, the only host
+	// directory visible inside its sandbox. It is used to hand files such as
+	// rendered plots back to the server.
+	exchangeDir string
+}
+
+// newSandbox reads OCTAVE_SANDBOX and prepares the sandbox. It returns nil
+// when sandboxing is disabled.
+func newSandbox(logger *slog.Logger) (*sandbox, error) {
+	mode := os.Getenv("OCTAVE_SANDBOX")
+	switch mode {
+	case "", SandboxNone:
+		return nil, nil
+	case SandboxNamespaces:
+	default:
+		return nil, fmt.Errorf("invalid OCTAVE_SANDBOX %q, must be %s or %s", mode, SandboxNamespaces, SandboxNone)
+	}
+
+	if err := checkNamespaceSupport(); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "octave-mcp-exchange-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox exchange dir: %w", err)
+	}
+	// Write and search only, so the directories of other interpreters cannot
+	// be listed
+	if err := os.Chmod(dir, 0300); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to set permissions on sandbox exchange dir: %w", err)
+	}
+
+	logger.Info("Running octave in namespace sandbox")
+	return &sandbox{exchangeDir: dir}, nil
+}
+
+// workerDir creates the exchange dir of an interpreter, "" meaning the default
+// temp dir when sandboxing is disabled
+func (s *sandbox) workerDir() (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	// MkdirTemp creates the directory with 0700 permissions
+	dir, err := os.MkdirTemp(s.exchangeDir, "worker-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create sandbox exchange dir: %w", err)
+	}
+	return dir, nil
+}
+
+// command builds the command that starts name, inside the sandbox if enabled.
+// exchange is the host directory mounted into the sandbox.
+func (s *sandbox) command(exchange, name string, args ...string) (*exec.Cmd, error) {
+	if s == nil {
+		return exec.Command(name, args...), nil
+	}
+	return s.namespaceCommand(exchange, name, args...)
+}
+
+// remove deletes the exchange dir of every interpreter
+func (s *sandbox) remove() error {
+	if s == nil {
+		return nil
+	}
+	if err := os.Chmod(s.exchangeDir, 0700); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.exchangeDir)
+}
@@ -0,0 +1,276 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// The server re-executes itself as the sandbox init process, which sets up
+// the mounts inside the new namespaces and then executes the interpreter
+const (
+	sandboxInitEnv     = "OCTAVE_MCP_SANDBOX_INIT"
+	sandboxTargetEnv   = "OCTAVE_MCP_SANDBOX_TARGET"
+	sandboxExchangeEnv = "OCTAVE_MCP_SANDBOX_EXCHANGE"
+)
+
+// sandboxHome is the working directory and HOME inside the sandbox
+const sandboxHome = "/home/octave"
+
+// sandboxReadOnlyDirs are bind-mounted read-only from the host when present
+var sandboxReadOnlyDirs = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/etc", "/opt"}
+
+// sandboxEnv are the variables passed from the server environment to the
+// interpreter, any other one could hold secrets such as API keys
+var sandboxEnv = []string{"PATH", "LANG", "LANGUAGE", "LC_ALL", "LC_CTYPE", "LC_NUMERIC", "LC_MESSAGES", "TZ", "OCTAVE_HOME", "OCTAVE_EXEC_PATH"}
+
+// sandboxDevices are bind-mounted from the host into the private /dev
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom"}
+
+func init() {
+	if os.Getenv(sandboxInitEnv) == "" {
+		return
+	}
+	// Capabilities and the working directory are per thread, keep the setup
+	// and the final exec on the same one
+	runtime.LockOSThread()
+	if err := sandboxInit(); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(126)
+	}
+}
+
+// checkNamespaceSupport fails early when user namespaces are disabled
+func checkNamespaceSupport() error {
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		return fmt.Errorf("namespace sandbox requires user namespaces: %w", err)
+	}
+	if data, err := os.ReadFile("/proc/sys/user/max_user_namespaces"); err == nil && strings.TrimSpace(string(data)) == "0" {
+		return errors.New("namespace sandbox requires user namespaces, user.max_user_namespaces is 0")
+	}
+	return nil
+}
+
+// namespaceCommand starts the sandbox init process in new user, mount, PID,
+// network, IPC and UTS namespaces. The caller is mapped to root inside the
+// user namespace so the init process can mount, it drops every capability
+// before executing the interpreter.
+func (s *sandbox) namespaceCommand(exchange, name string, args ...string) (*exec.Cmd, error) {
+	target, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start octave: %w", err)
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start octave: %w", err)
+	}
+
+	cmd := exec.Command("/proc/self/exe", args...)
+	cmd.Args[0] = name
+	cmd.Env = []string{
+		sandboxInitEnv + "=1",
+		sandboxTargetEnv + "=" + target,
+		sandboxExchangeEnv + "=" + exchange,
+	}
+	for _, key := range sandboxEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		// Never outlive the server
+		Pdeathsig: syscall.SIGKILL,
+	}
+	return cmd, nil
+}
+
+// sandboxInit runs inside the new namespaces, it only returns on error
+func sandboxInit() error {
+	target := os.Getenv(sandboxTargetEnv)
+	exchange := os.Getenv(sandboxExchangeEnv)
+	if target == "" || exchange == "" {
+		return errors.New("missing sandbox configuration")
+	}
+
+	if err := setupSandboxRoot(exchange); err != nil {
+		return err
+	}
+	if err := dropCapabilities(); err != nil {
+		return err
+	}
+
+	env := []string{"HOME=" + sandboxHome, "TMPDIR=/tmp", "PWD=" + sandboxHome}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case sandboxInitEnv, sandboxTargetEnv, sandboxExchangeEnv, "HOME", "TMPDIR", "PWD", "OLDPWD":
+			continue
+		}
+		env = append(env, kv)
+	}
+	return unix.Exec(target, append([]string{target}, os.Args[1:]...), env)
+}
+
+// setupSandboxRoot builds a new root on a private tmpfs holding read-only
+// system directories, a few devices, /tmp, HOME and the exchange dir, then
+// pivots into it so the host filesystem is no longer reachable
+func setupSandboxRoot(exchange string) error {
+	// Keep every mount below private to this namespace
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+
+	// The exchange dir usually lives in /tmp, which the new root covers
+	exchangeFd, err := unix.Open(exchange, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open exchange dir: %w", err)
+	}
+	defer unix.Close(exchangeFd)
+
+	root := "/tmp"
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size="+sandboxTmpfsSize+",mode=0755"); err != nil {
+		return fmt.Errorf("failed to mount sandbox root: %w", err)
+	}
+
+	for _, dir := range sandboxReadOnlyDirs {
+		info, err := os.Lstat(dir)
+		if err != nil {
+			continue
+		}
+		dst := filepath.Join(root, dir)
+		if info.Mode()&os.ModeSymlink != 0 {
+			// Merged /usr layouts link /bin and /lib into /usr
+			link, err := os.Readlink(dir)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, dst); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := bindMount(dir, dst, true); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{"dev", "proc", "tmp", strings.TrimPrefix(sandboxHome, "/")} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(filepath.Join(root, "tmp"), 0o1777); err != nil {
+		return err
+	}
+	if err := os.Chmod(filepath.Join(root, sandboxHome), 0700); err != nil {
+		return err
+	}
+	for _, dev := range sandboxDevices {
+		if err := bindMount(dev, filepath.Join(root, dev), false); err != nil {
+			return err
+		}
+	}
+	if err := bindMount(fmt.Sprintf("/proc/self/fd/%d", exchangeFd), filepath.Join(root, exchange), false); err != nil {
+		return err
+	}
+	// A proc instance for the new PID namespace. Some container runtimes
+	// forbid it, Octave runs without /proc.
+	if err := unix.Mount("proc", filepath.Join(root, "proc"), "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: /proc not available: %v\n", err)
+	}
+
+	oldRoot := filepath.Join(root, ".oldroot")
+	if err := os.Mkdir(oldRoot, 0700); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(root, oldRoot); err != nil {
+		return fmt.Errorf("failed to pivot root: %w", err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Unmount("/.oldroot", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach host root: %w", err)
+	}
+	if err := os.Remove("/.oldroot"); err != nil {
+		return err
+	}
+	return unix.Chdir(sandboxHome)
+}
+
+// bindMount mounts src on dst, creating dst first. Read-only remounts keep the
+// flags of the source mount, which the kernel locks inside user namespaces.
+func bindMount(src, dst string, readOnly bool) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(dst, 0755)
+	} else {
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err == nil {
+			err = os.WriteFile(dst, nil, 0644)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := unix.Mount(src, dst, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind %s: %w", src, err)
+	}
+	if !readOnly {
+		return nil
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(dst, &st); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	for _, f := range []struct{ st, ms uintptr }{
+		{unix.ST_NOSUID, unix.MS_NOSUID},
+		{unix.ST_NODEV, unix.MS_NODEV},
+		{unix.ST_NOEXEC, unix.MS_NOEXEC},
+		{unix.ST_NOATIME, unix.MS_NOATIME},
+		{unix.ST_NODIRATIME, unix.MS_NODIRATIME},
+		{unix.ST_RELATIME, unix.MS_RELATIME},
+	} {
+		if uintptr(st.Flags)&f.st != 0 {
+			flags |= f.ms
+		}
+	}
+	if err := unix.Mount("", dst, "", flags, ""); err != nil {
+		return fmt.Errorf("failed to make %s read-only: %w", src, err)
+	}
+	return nil
+}
+
+// dropCapabilities empties the bounding set so the interpreter, although it
+// runs as root inside the user namespace, executes without any capability
+func dropCapabilities() error {
+	for c := 0; ; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			if errors.Is(err, unix.EINVAL) {
+				break
+			}
+			return fmt.Errorf("failed to drop capability %d: %w", c, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	return nil
+}
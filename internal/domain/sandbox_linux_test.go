@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSandbox_Isolation runs a shell in the sandbox, the test binary itself
+// acts as the sandbox init process
+func TestSandbox_Isolation(t *testing.T) {
+	t.Setenv("OCTAVE_SANDBOX", SandboxNamespaces)
+	sb, err := newSandbox(slog.Default())
+	if err != nil {
+		t.Skipf("Namespace sandbox not supported: %v", err)
+	}
+	defer sb.remove()
+
+	// Only selected variables reach the sandbox
+	t.Setenv("OCTAVE_MCP_TEST_SECRET", "leaked")
+	hostDir := t.TempDir()
+	exchangeDir, err := sb.workerDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherDir, err := sb.workerDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := strings.Join([]string{
+		"echo pid=$$",
+		"echo home=$HOME cwd=$(pwd)",
+		"touch " + filepath.Join(hostDir, "escaped") + " 2>/dev/null && echo host-write",
+		"touch /etc/octave-mcp-sandbox 2>/dev/null && echo etc-write",
+		"touch $HOME/inside && echo home-write",
+		"touch " + filepath.Join(exchangeDir, "out") + " && echo exchange-write",
+		"ls " + sb.exchangeDir + " | sed 's/^/exchange=/'",
+		"echo env=$OCTAVE_MCP_TEST_SECRET",
+		"cat /proc/net/dev | tail -n +3 | cut -d: -f1 | tr -d ' ' | sed 's/^/iface=/'",
+	}, "\n")
+	cmd, err := sb.command(exchangeDir, "sh", "-c", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Skipf("Namespace sandbox not usable here: %v: %s", err, out)
+	}
+	output := string(out)
+
+	for _, expected := range []string{"pid=1\n", "home=" + sandboxHome + " cwd=" + sandboxHome + "\n", "home-write\n", "exchange-write\n", "exchange=" + filepath.Base(exchangeDir) + "\n", "env=\n", "iface=lo\n"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+	for _, unexpected := range []string{"host-write", "etc-write", filepath.Base(otherDir)} {
+		if strings.Contains(output, unexpected) {
+			t.Errorf("Expected %s to be denied, got:\n%s", unexpected, output)
+		}
+	}
+	if strings.Count(output, "iface=") != 1 {
+		t.Errorf("Expected only the loopback interface, got:\n%s", output)
+	}
+	if _, err := os.Stat(filepath.Join(hostDir, "escaped")); !os.IsNotExist(err) {
+		t.Error("Expected no file to be created on the host")
+	}
+}
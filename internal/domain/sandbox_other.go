@@ -0,0 +1,18 @@
+//go:build !linux
+
+package domain
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// checkNamespaceSupport fails, the namespace sandbox is only supported on Linux
+func checkNamespaceSupport() error {
+	return errors.New("namespace sandbox is only supported on Linux")
+}
+
+// namespaceCommand is never reached, checkNamespaceSupport fails first
+func (s *sandbox) namespaceCommand(exchange, name string, args ...string) (*exec.Cmd, error) {
+	return nil, errors.New("namespace sandbox is only supported on Linux")
+}
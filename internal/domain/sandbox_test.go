@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewSandbox_Mode(t *testing.T) {
+	for _, mode := range []string{"", SandboxNone} {
+		t.Setenv("OCTAVE_SANDBOX", mode)
+		sb, err := newSandbox(slog.Default())
+		if err != nil || sb != nil {
+			t.Errorf("Expected no sandbox for %q, got %v, %v", mode, sb, err)
+		}
+	}
+
+	t.Setenv("OCTAVE_SANDBOX", "chroot")
+	if _, err := newSandbox(slog.Default()); err == nil || !strings.Contains(err.Error(), `invalid OCTAVE_SANDBOX "chroot"`) {
+		t.Errorf("Expected invalid mode error, got: %v", err)
+	}
+}
+
+func TestSandbox_Nil(t *testing.T) {
+	var sb *sandbox
+	if dir, err := sb.workerDir(); dir != "" || err != nil {
+		t.Errorf("Expected the default temp dir without sandbox, got %q, %v", dir, err)
+	}
+	cmd, err := sb.command("", "octave-cli", "--silent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.SysProcAttr != nil || cmd.Args[0] != "octave-cli" {
+		t.Errorf("Expected plain command, got %v", cmd.Args)
+	}
+	if err := sb.remove(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSandbox_ExchangeDir(t *testing.T) {
+	t.Setenv("OCTAVE_SANDBOX", SandboxNamespaces)
+	sb, err := newSandbox(slog.Default())
+	if err != nil {
+		t.Skipf("Namespace sandbox not supported: %v", err)
+	}
+	info, err := os.Stat(sb.exchangeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0300 {
+		t.Errorf("Expected exchange dir mode 0300, got %o", info.Mode().Perm())
+	}
+	dir, err := sb.workerDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dir); err != nil || filepath.Dir(dir) != sb.exchangeDir || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected a private worker dir in the exchange dir, got %s: %v", dir, err)
+	}
+	if err := sb.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sb.exchangeDir); !os.IsNotExist(err) {
+		t.Errorf("Expected exchange dir to be removed, got: %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxSessions           = 5
+	defaultSessionIdleTTLSeconds = 600
+)
+
+var (
+	// ErrSessionNotFound is returned when a session ID does not match a live session
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrTooManySessions is returned when the session cap has been reached
+	ErrTooManySessions = errors.New("maximum number of sessions reached")
+)
+
+// session is a persistent interpreter whose workspace survives between calls
+type session struct {
+	id     string
+	worker *worker
+	// files is the scratch directory of the session, the working directory
+	// of its interpreter
+	files *workspace
+	// mu serializes executions, the interpreter runs one script at a time
+	mu       sync.Mutex
+	lastUsed time.Time
+}
+
+// SessionManager keeps one long-lived Octave process per session and closes
+// sessions that stay idle for longer than the configured TTL.
+type SessionManager struct {
+	logger      *slog.Logger
+	sandbox     *sandbox
+	maxSessions int
+	idleTTL     time.Duration
+	quota       workspaceQuota
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	// onClose, when set, is called with the ID of every session that ends,
+	// except at shutdown
+	onClose  func(id string)
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewSessionManager(logger *slog.Logger) *SessionManager {
+	return newSessionManager(logger, nil)
+}
+
+// newSessionManager creates a manager whose interpreters run inside sb
+func newSessionManager(logger *slog.Logger, sb *sandbox) *SessionManager {
+	// Configure session cap (default: 5)
+	maxSessions := defaultMaxSessions
+	if limitStr := os.Getenv("OCTAVE_MAX_SESSIONS"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit >= 0 {
+			maxSessions = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_MAX_SESSIONS, using default", "value", limitStr)
+		}
+	}
+
+	// Configure idle TTL (default: 600 seconds)
+	idleTTL := defaultSessionIdleTTLSeconds
+	if ttlStr := os.Getenv("OCTAVE_SESSION_IDLE_TTL"); ttlStr != "" {
+		if ttl, err := strconv.Atoi(ttlStr); err == nil && ttl > 0 {
+			idleTTL = ttl
+		} else {
+			logger.Warn("Invalid OCTAVE_SESSION_IDLE_TTL, using default", "value", ttlStr)
+		}
+	}
+
+	m := &SessionManager{
+		logger:      logger,
+		sandbox:     sb,
+		maxSessions: maxSessions,
+		idleTTL:     time.Duration(idleTTL) * time.Second,
+		quota:       loadWorkspaceQuota(logger),
+		sessions:    make(map[string]*session),
+		stop:        make(chan struct{}),
+	}
+	go m.reapLoop()
+	return m
+}
+
+// Create starts a session with the given ID. It is a no-op returning false
+// when the session already exists.
+func (m *SessionManager) Create(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	if _, ok := m.sessions[id]; ok {
+		m.mu.Unlock()
+		return false, nil
+	}
+	if err := m.checkCapacityLocked(); err != nil {
+		m.mu.Unlock()
+		return false, err
+	}
+	m.mu.Unlock()
+
+	// Start the interpreter outside the lock, boot takes a while
+	ctx, cancel := context.WithTimeout(ctx, defaultWorkerStartupSeconds*time.Second)
+	defer cancel()
+	w, err := startWorker(ctx, m.logger, m.sandbox)
+	if err != nil {
+		return false, fmt.Errorf("failed to start session: %w", err)
+	}
+	s := &session{id: id, worker: w, lastUsed: time.Now()}
+	if err := s.openWorkspace(ctx, m.quota); err != nil {
+		s.close()
+		return false, fmt.Errorf("failed to start session: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[id]; ok {
+		// Lost a race with a concurrent Create for the same ID
+		s.close()
+		return false, nil
+	}
+	if err := m.checkCapacityLocked(); err != nil {
+		s.close()
+		return false, err
+	}
+	m.sessions[id] = s
+	m.logger.Info("Session created", "session_id", id, "active_sessions", len(m.sessions))
+	return true, nil
+}
+
+// openWorkspace creates the session workspace in the exchange dir of the
+// interpreter and makes it its working directory
+func (s *session) openWorkspace(ctx context.Context, quota workspaceQuota) error {
+	files, err := newWorkspace(s.worker.exchangeDir, quota)
+	if err != nil {
+		return err
+	}
+	s.files = files
+	if _, err := s.worker.exec(ctx, fmt.Sprintf(`cd(%s);`, octaveString(files.dir)), captureOptions{}); err != nil {
+		return fmt.Errorf("failed to enter workspace: %w", err)
+	}
+	return nil
+}
+
+// close stops the interpreter and deletes the workspace
+func (s *session) close() {
+	s.worker.close()
+	if s.files != nil {
+		s.files.remove()
+	}
+}
+
+// checkCapacityLocked evicts expired sessions and reports whether another one fits
+func (m *SessionManager) checkCapacityLocked() error {
+	if len(m.sessions) < m.maxSessions {
+		return nil
+	}
+	m.reapLocked(time.Now())
+	if len(m.sessions) >= m.maxSessions {
+		return fmt.Errorf("%w (%d)", ErrTooManySessions, m.maxSessions)
+	}
+	return nil
+}
+
+// Close terminates the session and discards its workspace
+func (m *SessionManager) Close(id string) error {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	if ok {
+		delete(m.sessions, id)
+	}
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	s.close()
+	m.logger.Info("Session closed", "session_id", id)
+	m.closed(id)
+	return nil
+}
+
+// Exists reports whether a live session with the given ID exists
+func (m *SessionManager) Exists(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.sessions[id]
+	return ok
+}
+
+// workspace returns the workspace of a session
+func (m *SessionManager) workspace(id string) (*workspace, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return s.files, nil
+}
+
+// exec runs script inside the session. A session whose interpreter dies,
+// including because the script timed out, is removed. Files the script wrote
+// beyond the workspace quota fail the execution.
+func (m *SessionManager) exec(ctx context.Context, id string, exec func(context.Context, *worker) (execOutput, error)) (execOutput, error) {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	m.mu.Unlock()
+	if !ok {
+		return execOutput{}, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		s.lastUsed = time.Now()
+	}()
+
+	out, err := exec(ctx, s.worker)
+	if s.worker.stopped() {
+		m.mu.Lock()
+		if m.sessions[id] == s {
+			delete(m.sessions, id)
+		}
+		m.mu.Unlock()
+		s.files.remove()
+		m.logger.Warn("Session terminated", "session_id", id, "error", err)
+		m.closed(id)
+		return out, fmt.Errorf("session %s terminated, its workspace is lost: %w", id, err)
+	}
+	if err == nil {
+		err = s.files.checkQuota()
+	}
+	return out, err
+}
+
+func (m *SessionManager) reapLoop() {
+	interval := m.idleTTL / 2
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.mu.Lock()
+			m.reapLocked(now)
+			m.mu.Unlock()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// reapLocked closes sessions idle for longer than the TTL. Sessions that are
+// currently executing are never reaped.
+func (m *SessionManager) reapLocked(now time.Time) {
+	for id, s := range m.sessions {
+		if !s.mu.TryLock() {
+			continue
+		}
+		expired := now.Sub(s.lastUsed) > m.idleTTL || s.worker.stopped()
+		s.mu.Unlock()
+		if !expired {
+			continue
+		}
+		delete(m.sessions, id)
+		go func() {
+			s.close()
+			m.closed(id)
+		}()
+		m.logger.Info("Session expired", "session_id", id)
+	}
+}
+
+// closed reports the end of a session to the onClose callback
+func (m *SessionManager) closed(id string) {
+	if m.onClose != nil {
+		m.onClose(id)
+	}
+}
+
+// Shutdown closes every session and stops the reaper
+func (m *SessionManager) Shutdown() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*session)
+	m.mu.Unlock()
+
+	for _, s := range sessions {
+		s.close()
+	}
+}
@@ -0,0 +1,84 @@
+package domain
+
+import "context"
+
+// slotWaiter is a caller waiting for an execution slot
+type slotWaiter struct {
+	// moved is signalled when a caller ahead of it leaves the line
+	moved chan struct{}
+}
+
+// acquire takes an execution slot from the semaphore. While every slot is
+// busy onQueue, when set, is told the caller's position in line (1 is next)
+// whenever it changes, and 0 once the slot is taken. Blocked callers are
+// served in order, so the position is accurate unless callers give up.
+func (r *Runner) acquire(ctx context.Context, onQueue func(position int)) error {
+	select {
+	case r.semaphore <- struct{}{}:
+		if onQueue != nil {
+			onQueue(0)
+		}
+		return nil
+	default:
+	}
+
+	w := &slotWaiter{moved: make(chan struct{}, 1)}
+	r.waitMu.Lock()
+	r.waiting = append(r.waiting, w)
+	position := len(r.waiting)
+	r.waitMu.Unlock()
+	defer r.leaveQueue(w)
+
+	if onQueue != nil {
+		onQueue(position)
+	}
+	for {
+		select {
+		case r.semaphore <- struct{}{}:
+			if onQueue != nil {
+				onQueue(0)
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.moved:
+			if p := r.queuePosition(w); p != position && p > 0 {
+				position = p
+				if onQueue != nil {
+					onQueue(position)
+				}
+			}
+		}
+	}
+}
+
+// queuePosition returns the 1-based position of w in line, or 0 if it left
+func (r *Runner) queuePosition(w *slotWaiter) int {
+	r.waitMu.Lock()
+	defer r.waitMu.Unlock()
+	for i, other := range r.waiting {
+		if other == w {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// leaveQueue removes w from the line and tells the callers behind it
+func (r *Runner) leaveQueue(w *slotWaiter) {
+	r.waitMu.Lock()
+	defer r.waitMu.Unlock()
+	for i, other := range r.waiting {
+		if other != w {
+			continue
+		}
+		r.waiting = append(r.waiting[:i], r.waiting[i+1:]...)
+		for _, behind := range r.waiting[i:] {
+			select {
+			case behind.moved <- struct{}{}:
+			default:
+			}
+		}
+		return
+	}
+}
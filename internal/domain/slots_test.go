@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// positionRecorder collects the positions reported to an OnQueue callback
+type positionRecorder chan int
+
+func (p positionRecorder) record(position int) {
+	p <- position
+}
+
+func (p positionRecorder) expect(t *testing.T, want int) {
+	t.Helper()
+	select {
+	case got := <-p:
+		if got != want {
+			t.Errorf("Expected position %d, got %d", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for position %d", want)
+	}
+}
+
+func TestRunner_Acquire(t *testing.T) {
+	r := &Runner{semaphore: make(chan struct{}, 1)}
+	ctx := context.Background()
+
+	first := make(positionRecorder, 10)
+	if err := r.acquire(ctx, first.record); err != nil {
+		t.Fatal(err)
+	}
+	first.expect(t, 0)
+
+	second, third := make(positionRecorder, 10), make(positionRecorder, 10)
+	done := make(chan error, 2)
+	go func() { done <- r.acquire(ctx, second.record) }()
+	second.expect(t, 1)
+
+	thirdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() { done <- r.acquire(thirdCtx, third.record) }()
+	third.expect(t, 2)
+
+	// The caller ahead taking the slot moves the next one up
+	<-r.semaphore
+	second.expect(t, 0)
+	third.expect(t, 1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+	if p := r.queuePosition(&slotWaiter{}); p != 0 || len(r.waiting) != 0 {
+		t.Errorf("Expected empty line, got %d waiting", len(r.waiting))
+	}
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SyntaxCheck is the outcome of checking a script without running it
+type SyntaxCheck struct {
+	// SyntaxErrors lists the parse errors. The parser stops at the first one.
+	SyntaxErrors []SyntaxError
+	// Violations lists every construct the security policy forbids
+	Violations []Violation
+}
+
+// Valid reports whether the script parses and complies with the policy
+func (c *SyntaxCheck) Valid() bool {
+	return len(c.SyntaxErrors) == 0 && len(c.Violations) == 0
+}
+
+// syntaxCheckScript parses dir/script.m with Octave's parser, which builds
+// the parse tree without evaluating anything, and saves the parse error, if
+// any, to dir/syntax.txt
+const syntaxCheckScript = `
+try
+  __parse_file__([%[1]s "/script.m"]);
+catch __octave_mcp_err__
+  __octave_mcp_fid__ = fopen([%[1]s "/syntax.txt"], "w");
+  fputs(__octave_mcp_fid__, __octave_mcp_err__.message);
+  fclose(__octave_mcp_fid__);
+end
+`
+
+var parseErrorLineRe = regexp.MustCompile(`^parse error(?: near line (\d+))?`)
+
+// CheckSyntax parses a script without executing it and checks it against the
+// policy of the given tool, run_octave when empty. Policy violations are
+// reported along with syntax errors so both can be fixed at once.
+func (r *Runner) CheckSyntax(ctx context.Context, script string, tool string, opts ExecOptions) (*SyntaxCheck, error) {
+	r.logger.Debug("CheckSyntax started", "script_length", len(script), "tool", tool)
+
+	if script == "" {
+		return nil, fmt.Errorf("script cannot be empty")
+	}
+	switch tool {
+	case "":
+		tool = ToolRunOctave
+	case ToolRunOctave, ToolGeneratePlot:
+	default:
+		return nil, fmt.Errorf("unknown tool: %s (must be %s or %s)", tool, ToolRunOctave, ToolGeneratePlot)
+	}
+
+	check := &SyntaxCheck{}
+	var syntaxErr *SyntaxError
+	var validationErr *ValidationError
+	err := r.policy.Validate(tool, script)
+	switch {
+	case errors.As(err, &syntaxErr):
+		// The tokenizer already found the error, the parser would stop at it too
+		check.SyntaxErrors = append(check.SyntaxErrors, *syntaxErr)
+		return check, nil
+	case errors.As(err, &validationErr):
+		check.Violations = validationErr.Violations
+	case err != nil:
+		return nil, err
+	}
+
+	// Acquire semaphore to limit concurrent executions
+	if err := r.acquire(ctx, opts.OnQueue); err != nil {
+		return nil, err
+	}
+	defer func() {
+		<-r.semaphore
+	}()
+
+	parseErr, err := r.parse(ctx, sanitizeScript(script), opts)
+	if err != nil {
+		r.logger.Error("CheckSyntax failed", "error", err)
+		return nil, fmt.Errorf("syntax check failed: %w", err)
+	}
+	if parseErr != nil {
+		check.SyntaxErrors = append(check.SyntaxErrors, *parseErr)
+	}
+
+	r.logger.Debug("CheckSyntax completed", "syntax_errors", len(check.SyntaxErrors), "violations", len(check.Violations))
+	return check, nil
+}
+
+// parse runs Octave's parser on the script in a fresh interpreter. Callers
+// must hold the semaphore.
+func (r *Runner) parse(ctx context.Context, script string, opts ExecOptions) (*SyntaxError, error) {
+	var message []byte
+	var readErr error
+	x := &exchange{
+		pattern: "octave-syntax-*",
+		prepare: func(dir string, root *os.Root) (string, error) {
+			if err := root.WriteFile("script.m", []byte(script), 0600); err != nil {
+				return "", fmt.Errorf("failed to write script: %w", err)
+			}
+			return fmt.Sprintf(syntaxCheckScript, octaveString(dir)), nil
+		},
+		collect: func(root *os.Root) {
+			message, readErr = readExchangeFile(root, "syntax.txt")
+		},
+	}
+
+	// The workspace is not needed to parse, always use a pooled interpreter
+	if _, err := r.runExchange(ctx, x, ExecOptions{Timeout: opts.Timeout, OnUsage: opts.OnUsage, CPUBudget: opts.CPUBudget}); err != nil {
+		return nil, err
+	}
+	if errors.Is(readErr, os.ErrNotExist) {
+		return nil, nil
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read syntax check result: %w", readErr)
+	}
+	parseErr := parseOctaveSyntaxError(string(message))
+	return &parseErr, nil
+}
+
+// parseOctaveSyntaxError extracts the position and the description from a
+// parse error message such as
+//
+//	parse error near line 2 of file /tmp/octave-syntax-1/script.m
+//
+//	  syntax error
+//
+//	>>> x = (1 +
+//	           ^
+//
+// The caret sits under the offending character, after the ">>> " prompt.
+func parseOctaveSyntaxError(message string) SyntaxError {
+	result := SyntaxError{Line: 1, Column: 1}
+	message = strings.TrimSpace(message)
+	lines := strings.Split(message, "\n")
+	m := parseErrorLineRe.FindStringSubmatch(lines[0])
+	if m == nil {
+		// Not a parse error, report it whole
+		result.Message = filterOutput(message)
+		return result
+	}
+	if m[1] != "" {
+		result.Line, _ = strconv.Atoi(m[1])
+	}
+	lines = lines[1:]
+
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, ">>> "):
+			if i+1 < len(lines) {
+				if caret := strings.IndexByte(lines[i+1], '^'); caret >= 0 {
+					result.Column = max(1, caret-3)
+				}
+			}
+		case strings.TrimSpace(line) == "" || strings.TrimSpace(line) == "^":
+		case result.Message == "":
+			result.Message = strings.TrimSpace(line)
+		}
+	}
+	if result.Message == "" {
+		result.Message = "syntax error"
+	}
+	return result
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestParseOctaveSyntaxError(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    SyntaxError
+	}{
+		{
+			name:    "with caret",
+			message: "parse error near line 2 of file /tmp/octave-syntax-1/script.m\n\n  syntax error\n\n>>> x = (1 + ;\n             ^\n",
+			want:    SyntaxError{Line: 2, Column: 10, Message: "syntax error"},
+		},
+		{
+			name:    "without caret",
+			message: "parse error near line 5 of file /tmp/octave-syntax-1/script.m\n\n  'endwhile' command matched by 'endif'\n",
+			want:    SyntaxError{Line: 5, Column: 1, Message: "'endwhile' command matched by 'endif'"},
+		},
+		{
+			name:    "without position",
+			message: "parse error:\n\n  syntax error\n",
+			want:    SyntaxError{Line: 1, Column: 1, Message: "syntax error"},
+		},
+		{
+			name:    "other error",
+			message: "could not read /tmp/octave-syntax-1/script.m",
+			want:    SyntaxError{Line: 1, Column: 1, Message: "could not read /[REDACTED]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseOctaveSyntaxError(tt.message); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,797 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// defaultDeniedFunctions are the functions scripts may not call, directly or
+// indirectly. Octave identifiers are case-sensitive, so matching is too.
+var defaultDeniedFunctions = []string{
+	"system", "exec", "popen", "popen2", // Direct system command execution
+	"eval", "evalin", "evalc", // Code execution functions
+	"urlread", "urlwrite", "webread", "webwrite", "websave", "web", "ftp", // Network functions that could be used for data exfiltration
+	"python", "perl", "mkoctfile", "ls", // Wrappers that build a shell command line from their arguments
+	"java", "javaMethod", "javaObject", // Java calls can reach Runtime.exec
+	"addpath", "rmpath", "path", "restoredefaultpath", "rehash", // Load path changes that would pick up code files a script wrote
+	"setenv", "putenv", "unsetenv", // Environment changes would outlive the execution in a pooled interpreter
+	"load", "save", // File I/O functions that could be misused
+	"unix", "dos", // Platform-specific command execution
+	"waitpid", "fork", // Process control functions
+}
+
+// dispatchFunctions call the functions named by some of their arguments,
+// mapped to the 1-based positions of those arguments. The arguments must be
+// string literals or function handles so they can be checked.
+var dispatchFunctions = map[string][]int{
+	"feval": {1}, "cellfun": {1}, "arrayfun": {1}, "structfun": {1}, "bsxfun": {1},
+	"str2func": {1}, "fcnchk": {1}, "builtin": {1}, "inline": {1},
+	// nthargout (N, FCN, ...) or nthargout (N, NTOT, FCN, ...)
+	"nthargout": {2, 3},
+	// Solvers and integrators evaluate the function they are given by name
+	"fzero": {1}, "fminsearch": {1}, "fminbnd": {1}, "fminunc": {1}, "fsolve": {1}, "sqp": {2, 3, 4},
+	"quad": {1}, "quadgk": {1}, "quadl": {1}, "quadv": {1}, "quadcc": {1},
+	"integral": {1}, "integral2": {1}, "integral3": {1}, "dblquad": {1}, "triplequad": {1},
+	"ode23": {1}, "ode23s": {1}, "ode45": {1}, "ode15s": {1}, "ode15i": {1},
+	"lsode": {1}, "daspk": {1}, "dassl": {1}, "dasrt": {1},
+}
+
+// fileFunctions read, write or inspect the files named by their leading
+// arguments, mapped to the number of path arguments. In a session workspace
+// they may only name files inside it. Functions taking a file id, such as
+// fskipl or fdisp, need no check: ids only come from fopen, which is checked.
+var fileFunctions = map[string]int{
+	"load": 1, "save": 1, "fopen": 1, "fileread": 1, "textread": 1, "importdata": 1, "type": 1,
+	"csvread": 1, "csvwrite": 1, "dlmread": 1, "dlmwrite": 1,
+	"xlsread": 1, "xlswrite": 1, "odsread": 1, "odswrite": 1,
+	"imread": 1, "imwrite": 1, "imfinfo": 1,
+	"audioread": 1, "audiowrite": 1, "audioinfo": 1,
+	"saveas": 1, "hgsave": 1, "hgload": 1,
+	"delete": 1, "unlink": 1, "diary": 1, "print": 1,
+	"copyfile": 2, "movefile": 2, "rename": 2, "link": 2, "symlink": 2,
+	"mkdir": 2, "rmdir": 1,
+	"exist": 1, "stat": 1, "lstat": 1, "isfile": 1, "isfolder": 1, "isdir": 1, "fileattrib": 1,
+	"readdir": 1, "dir": 1, "glob": 1, "what": 1,
+}
+
+// figureFileFunctions take a figure handle before the path, as in
+// saveas (h, "out.png")
+var figureFileFunctions = map[string]bool{"saveas": true, "hgsave": true}
+
+// listingFunctions take a directory or a glob pattern, which must stay in the
+// workspace: "." or a file name that may hold wildcards
+var listingFunctions = map[string]bool{"readdir": true, "dir": true, "glob": true, "what": true}
+
+// fileCallFollowers are the operators that may follow the name of a file
+// function in a session workspace, any other one could start command syntax
+var fileCallFollowers = []string{"(", ")", "]", "}", ";", ",", "=", "."}
+
+// workspacePatternRe matches the patterns listingFunctions accept
+var workspacePatternRe = regexp.MustCompile(`^(\.|[A-Za-z0-9_*?\[\]][A-Za-z0-9_.*?\[\]-]{0,127})$`)
+
+// codeFunctions run the code in files, extract archives or compile sources,
+// which could put code files in the workspace that skip the validator. They
+// are denied in a session workspace.
+var codeFunctions = map[string]bool{
+	"source": true, "run": true, "autoload": true,
+	"unzip": true, "untar": true, "gunzip": true, "bunzip2": true, "unpack": true,
+	"mkoctfile": true,
+}
+
+// directoryFunctions change the working directory, which is the session
+// workspace and must stay so
+var directoryFunctions = map[string]bool{
+	"cd":    true,
+	"chdir": true,
+}
+
+// ruleWorkspace is reported for file I/O that escapes the session workspace.
+// It is built in and applies in every mode.
+const ruleWorkspace = "workspace"
+
+// Violation is a forbidden construct found in a script
+type Violation struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Function string `json:"function"`
+	Message  string `json:"message"`
+	// Rule names the policy rule that fired, e.g. deny or tools.run_octave.allow
+	Rule string `json:"rule"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("line %d, column %d: %s (rule %s)", v.Line, v.Column, v.Message, v.Rule)
+}
+
+// ValidationError is returned for scripts that contain forbidden constructs
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.String()
+	}
+	return "script contains forbidden function calls: " + strings.Join(parts, "; ")
+}
+
+// validator checks tokenized scripts against a set of denied functions and,
+// in allowlist mode, a set of allowed ones
+type validator struct {
+	// denied maps each denied function to the rule that denies it
+	denied map[string]string
+	// allowed is nil in denylist mode
+	allowed   map[string]bool
+	allowRule string
+	// packages holds the packages pkg load may load
+	packages map[string]bool
+	// workspace confines file I/O to the session workspace
+	workspace bool
+}
+
+func newValidator(denied []string) *validator {
+	v := &validator{denied: make(map[string]string, len(denied))}
+	for _, name := range denied {
+		v.denied[name] = "deny"
+	}
+	return v
+}
+
+var defaultValidator = newValidator(defaultDeniedFunctions)
+
+// validateScript checks if the script calls any function that could lead to
+// command execution, data exfiltration or other security issues in GNU Octave.
+// Calls made through command syntax, function handles and dispatchers such as
+// feval or cellfun are detected as well.
+func validateScript(script string) error {
+	return defaultValidator.validate(script)
+}
+
+func (v *validator) validate(script string) error {
+	// Session workspaces keep the variables of earlier calls
+	tokens, err := tokenizeScript(script, v.workspace)
+	if err != nil {
+		return err
+	}
+	if violations := v.check(tokens); len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// check walks the tokens and reports every forbidden call
+func (v *validator) check(tokens []token) []Violation {
+	var violations []Violation
+	report := func(tok token, name, rule, format string, args ...any) {
+		violations = append(violations, Violation{
+			Line:     tok.Line,
+			Column:   tok.Column,
+			Function: name,
+			Message:  fmt.Sprintf(format, args...),
+			Rule:     rule,
+		})
+	}
+
+	var names *scriptNames
+	if v.allowed != nil {
+		names = resolveNames(tokens)
+	}
+
+	code := significantTokens(tokens)
+	for i, tok := range code {
+		if tok.Kind != tokenIdent {
+			continue
+		}
+		var prev *token
+		if i > 0 {
+			prev = &code[i-1]
+		}
+		// Struct fields such as s.save are not function calls
+		if prev != nil && prev.Kind == tokenOperator && prev.Text == "." {
+			continue
+		}
+		isHandle := prev != nil && prev.Kind == tokenOperator && prev.Text == "@"
+
+		if rule := v.denied[tok.Text]; rule != "" {
+			if isHandle {
+				report(tok, tok.Text, rule, "function handle to forbidden function %s", tok.Text)
+			} else {
+				report(tok, tok.Text, rule, "call to forbidden function %s", tok.Text)
+			}
+			continue
+		}
+
+		if v.allowed != nil && !v.allowed[tok.Text] && !names.isVariable(tok) {
+			report(tok, tok.Text, v.allowRule, "function %s is not in the allow list", tok.Text)
+			continue
+		}
+
+		if tok.Text == "pkg" {
+			violations = append(violations, v.checkPkg(code, i, isHandle)...)
+			continue
+		}
+
+		if v.workspace && (directoryFunctions[tok.Text] || codeFunctions[tok.Text]) {
+			report(tok, tok.Text, ruleWorkspace, "%s is not allowed in a session workspace", tok.Text)
+			continue
+		}
+		if v.workspace && fileFunctions[tok.Text] > 0 {
+			violations = append(violations, checkFileCall(code, i, isHandle)...)
+			continue
+		}
+
+		if tok.Text == "print" && !isHandle {
+			violations = append(violations, checkPrintPipe(code, i)...)
+		}
+		if dispatchFunctions[tok.Text] == nil {
+			continue
+		}
+		if isHandle {
+			// A handle to a dispatcher could be called with any function name
+			report(tok, tok.Text, ruleDynamicDispatch, "function handle to %s is not allowed", tok.Text)
+			continue
+		}
+		violations = append(violations, v.checkDispatch(code, i, names)...)
+	}
+	return violations
+}
+
+// checkDispatch inspects the function arguments of a dispatcher call such as
+// feval("system", ...) or cellfun("save", ...)
+func (v *validator) checkDispatch(code []token, i int, names *scriptNames) []Violation {
+	dispatcher := code[i]
+	args := callArgs(code, i)
+	var violations []Violation
+	for _, position := range dispatchFunctions[dispatcher.Text] {
+		if position > len(args) {
+			break
+		}
+		violations = append(violations, v.checkDispatchArg(dispatcher, args[position-1], names)...)
+	}
+	return violations
+}
+
+// checkDispatchArg inspects an argument of a dispatcher that may name a function
+func (v *validator) checkDispatchArg(dispatcher token, arg []token, names *scriptNames) []Violation {
+	dynamic := Violation{
+		Line:     dispatcher.Line,
+		Column:   dispatcher.Column,
+		Function: dispatcher.Text,
+		Message:  fmt.Sprintf("dynamic function reference in %s, pass a function handle (@name) or a string literal", dispatcher.Text),
+		Rule:     ruleDynamicDispatch,
+	}
+
+	switch {
+	case len(arg) == 0:
+		return nil
+	case arg[0].Kind == tokenOperator && arg[0].Text == "@":
+		// Function handles and anonymous functions are checked like any other code
+		return nil
+	case len(arg) == 1 && arg[0].Kind == tokenNumber:
+		// A count such as the N of nthargout
+		return nil
+	case len(arg) == 2 && arg[0].Text == "[" && arg[1].Text == "]":
+		// An omitted function, as in sqp (x0, phi, [], h)
+		return nil
+	case len(arg) != 1 || (arg[0].Kind != tokenString && arg[0].Kind != tokenCommandArg):
+		return []Violation{dynamic}
+	}
+
+	name := strings.TrimSpace(arg[0].Value)
+	if dispatcher.Text == "inline" || strings.HasPrefix(name, "@") {
+		// The string holds code, e.g. str2func("@(x) system(x)")
+		inner, err := tokenize(name)
+		if err != nil {
+			return []Violation{dynamic}
+		}
+		var violations []Violation
+		for _, nested := range v.check(inner) {
+			violations = append(violations, Violation{
+				Line:     arg[0].Line,
+				Column:   arg[0].Column,
+				Function: nested.Function,
+				Message:  fmt.Sprintf("%s in code passed to %s", nested.Message, dispatcher.Text),
+				Rule:     nested.Rule,
+			})
+		}
+		return violations
+	}
+
+	violation := Violation{Line: arg[0].Line, Column: arg[0].Column, Function: name}
+	switch {
+	case v.denied[name] != "":
+		violation.Message = fmt.Sprintf("call to forbidden function %s through %s", name, dispatcher.Text)
+		violation.Rule = v.denied[name]
+	case dispatchFunctions[name] != nil:
+		violation.Message = fmt.Sprintf("call to forbidden function %s through %s", name, dispatcher.Text)
+		violation.Rule = ruleDynamicDispatch
+	case v.workspace && (fileFunctions[name] > 0 || directoryFunctions[name] || codeFunctions[name]):
+		// The path cannot be checked through a dispatcher
+		violation.Message = fmt.Sprintf("call to %s through %s is not allowed in a session workspace", name, dispatcher.Text)
+		violation.Rule = ruleWorkspace
+	case name == "pkg":
+		// The pkg action cannot be checked through a dispatcher
+		violation.Message = fmt.Sprintf("call to pkg through %s is not allowed", dispatcher.Text)
+		violation.Rule = rulePkg
+	case v.allowed != nil && !v.allowed[name] && !names.isScriptFunction(name, dispatcher):
+		// A name passed as a string calls the function even if a variable
+		// has that name
+		violation.Message = fmt.Sprintf("function %s called through %s is not in the allow list", name, dispatcher.Text)
+		violation.Rule = v.allowRule
+	default:
+		return nil
+	}
+	return []Violation{violation}
+}
+
+// callArgs splits the arguments of the call at code[i], made with command or
+// function syntax. It returns nil when the name is not called.
+func callArgs(code []token, i int) [][]token {
+	var args [][]token
+	switch {
+	case i+1 < len(code) && code[i+1].Kind == tokenCommandArg:
+		for j := i + 1; j < len(code) && code[j].Kind == tokenCommandArg; j++ {
+			args = append(args, code[j:j+1])
+		}
+	case i+1 < len(code) && code[i+1].Kind == tokenOperator && code[i+1].Text == "(":
+		depth := 0
+		start := i + 2
+		for j := i + 1; j < len(code); j++ {
+			if code[j].Kind != tokenOperator {
+				continue
+			}
+			switch code[j].Text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+				if depth == 0 {
+					if j > start || len(args) > 0 {
+						args = append(args, code[start:j])
+					}
+					return args
+				}
+			case ",":
+				if depth == 1 {
+					args = append(args, code[start:j])
+					start = j + 1
+				}
+			}
+		}
+		args = append(args, code[start:])
+	}
+	return args
+}
+
+// checkPrintPipe refuses print targets starting with "|", which print pipes
+// to a shell command
+func checkPrintPipe(code []token, i int) []Violation {
+	var violations []Violation
+	for _, arg := range callArgs(code, i) {
+		for _, tok := range arg {
+			if (tok.Kind == tokenString || tok.Kind == tokenCommandArg) && strings.HasPrefix(strings.TrimSpace(tok.Value), "|") {
+				violations = append(violations, Violation{
+					Line:     tok.Line,
+					Column:   tok.Column,
+					Function: "print",
+					Message:  "print to a pipe is not allowed",
+					Rule:     rulePrintPipe,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// checkPkg inspects a pkg call, in command or function syntax. Only loading
+// allowed packages, unloading, listing and describing are permitted, and the
+// arguments must be literals so they can be checked.
+func (v *validator) checkPkg(code []token, i int, isHandle bool) []Violation {
+	tok := code[i]
+	report := func(at token, rule, format string, args ...any) []Violation {
+		return []Violation{{
+			Line:     at.Line,
+			Column:   at.Column,
+			Function: "pkg",
+			Message:  fmt.Sprintf(format, args...),
+			Rule:     rule,
+		}}
+	}
+	if isHandle {
+		return report(tok, rulePkg, "function handle to pkg is not allowed")
+	}
+
+	var args []token
+	switch {
+	case i+1 < len(code) && code[i+1].Kind == tokenCommandArg:
+		for j := i + 1; j < len(code) && code[j].Kind == tokenCommandArg; j++ {
+			args = append(args, code[j])
+		}
+	case i+1 < len(code) && code[i+1].Kind == tokenOperator && code[i+1].Text == "(":
+		// Every argument must be a single string literal
+		for j := i + 2; j < len(code); j += 2 {
+			if code[j].Kind == tokenOperator && code[j].Text == ")" && len(args) == 0 {
+				break
+			}
+			if code[j].Kind != tokenString || j+1 >= len(code) || code[j+1].Kind != tokenOperator ||
+				(code[j+1].Text != "," && code[j+1].Text != ")") {
+				return report(code[j], rulePkg, "pkg arguments must be string literals")
+			}
+			args = append(args, code[j])
+			if code[j+1].Text == ")" {
+				break
+			}
+		}
+	}
+	if len(args) == 0 {
+		// Without arguments pkg only prints its usage
+		return nil
+	}
+
+	switch action := args[0].Value; action {
+	case "list", "describe", "unload":
+		return nil
+	case "load":
+		var violations []Violation
+		for _, arg := range args[1:] {
+			if strings.HasPrefix(arg.Value, "-") || v.packages[arg.Value] {
+				continue
+			}
+			violations = append(violations, report(arg, "packages", "package %s is not in the package allow list", arg.Value)...)
+		}
+		return violations
+	default:
+		return report(args[0], rulePkg, "pkg %s is not allowed", action)
+	}
+}
+
+// checkFileCall inspects the path arguments of a file I/O call in a session
+// workspace, in command or function syntax. Leading options such as -ascii
+// are skipped, the paths must be string literals naming a file in the
+// workspace.
+func checkFileCall(code []token, i int, isHandle bool) []Violation {
+	tok := code[i]
+	report := func(at token, format string, args ...any) []Violation {
+		return []Violation{{
+			Line:     at.Line,
+			Column:   at.Column,
+			Function: tok.Text,
+			Message:  fmt.Sprintf(format, args...),
+			Rule:     ruleWorkspace,
+		}}
+	}
+	if isHandle {
+		return report(tok, "function handle to %s is not allowed in a session workspace", tok.Text)
+	}
+
+	if i+1 < len(code) && code[i+1].Kind == tokenOperator && !slices.Contains(fileCallFollowers, code[i+1].Text) {
+		// The name may be a variable of an earlier call, so `type /etc/passwd`
+		// is read as a division, while Octave runs command syntax when it is not
+		return report(tok, "%s must be called with parentheses in a session workspace", tok.Text)
+	}
+	args := callArgs(code, i)
+	if figureFileFunctions[tok.Text] && len(args) > 0 && !isStringArg(args[0]) {
+		args = args[1:]
+	}
+	want := fileFunctions[tok.Text]
+	var paths []token
+	for _, arg := range args {
+		if len(paths) == want {
+			break
+		}
+		if !isStringArg(arg) {
+			at := tok
+			if len(arg) > 0 {
+				at = arg[0]
+			}
+			return report(at, "%s must be given a string literal naming a file in the session workspace", tok.Text)
+		}
+		if !strings.HasPrefix(arg[0].Value, "-") {
+			paths = append(paths, arg[0])
+		}
+	}
+
+	var violations []Violation
+	for _, path := range paths {
+		if listingFunctions[tok.Text] {
+			if !workspacePatternRe.MatchString(path.Value) {
+				violations = append(violations, report(path, "%s: invalid pattern %q, use \".\" or a file name in the session workspace", tok.Text, path.Value)...)
+			}
+			continue
+		}
+		if err := checkWorkspaceFileName(path.Value); err != nil {
+			violations = append(violations, report(path, "%s: %v", tok.Text, err)...)
+		}
+	}
+	return violations
+}
+
+// isStringArg reports whether a call argument is a single string literal
+func isStringArg(arg []token) bool {
+	return len(arg) == 1 && (arg[0].Kind == tokenString || arg[0].Kind == tokenCommandArg)
+}
+
+// significantTokens drops comments and newlines, which never affect calls
+func significantTokens(tokens []token) []token {
+	code := make([]token, 0, len(tokens))
+	for _, tok := range tokens {
+		if tok.Kind == tokenComment || tok.Kind == tokenNewline {
+			continue
+		}
+		code = append(code, tok)
+	}
+	return code
+}
+
+// position locates a token in a script
+type position struct {
+	line, column int
+}
+
+func positionOf(tok token) position {
+	return position{tok.Line, tok.Column}
+}
+
+func (p position) before(other position) bool {
+	return p.line < other.line || (p.line == other.line && p.column < other.column)
+}
+
+// scriptNames tells the identifiers of a script that do not call a function
+// apart from the others. In allowlist mode they may be used without being
+// allowed.
+type scriptNames struct {
+	// variables holds the positions of declarations, assignment targets and
+	// uses of variables definitely assigned earlier in the same scope
+	variables map[position]bool
+	// functions maps the functions the script defines at top level to the
+	// position of their definition, calls after it run validated code
+	functions map[string]position
+}
+
+// isVariable reports whether the identifier tok does not call a function
+func (n *scriptNames) isVariable(tok token) bool {
+	return n.variables[positionOf(tok)] || n.isScriptFunction(tok.Text, tok)
+}
+
+// isScriptFunction reports whether name is a function the script defined
+// before at
+func (n *scriptNames) isScriptFunction(name string, at token) bool {
+	defined, ok := n.functions[name]
+	return ok && defined.before(positionOf(at))
+}
+
+// scope holds the names assigned in a block of code. Function bodies start a
+// new set of variables, other blocks see the variables of their parents.
+type scope struct {
+	function bool
+	names    map[string]bool
+}
+
+// nameResolver walks a script in order for resolveNames
+type nameResolver struct {
+	names  *scriptNames
+	scopes []*scope
+}
+
+// resolveNames walks a script in order, keeping track of the variables that
+// are definitely assigned. Assignments in a conditional, loop or try body
+// only count inside it. Parameters of functions and anonymous functions do
+// not count, since callers may omit them and the name then calls the
+// function of that name.
+func resolveNames(tokens []token) *scriptNames {
+	r := &nameResolver{
+		names:  &scriptNames{variables: make(map[position]bool), functions: make(map[string]position)},
+		scopes: []*scope{newScope(true)},
+	}
+
+	var stmt []token
+	depth := 0
+	for i, tok := range tokens {
+		switch tok.Kind {
+		case tokenComment:
+			continue
+		case tokenIdent:
+			if r.assigned(tok.Text) {
+				r.declare(tok)
+			}
+		case tokenOperator:
+			switch tok.Text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			case "@":
+				// Anonymous function parameters, @(x, y) ...
+				if i+1 < len(tokens) && tokens[i+1].Text == "(" {
+					for _, param := range tokens[i+2:] {
+						if param.Kind == tokenOperator && param.Text == ")" {
+							break
+						}
+						if param.Kind == tokenIdent {
+							r.declare(param)
+						}
+					}
+				}
+			}
+		case tokenKeyword:
+			if depth == 0 {
+				r.keyword(tok.Text)
+			}
+		}
+		endOfStatement := tok.Kind == tokenNewline ||
+			(tok.Kind == tokenOperator && (tok.Text == ";" || tok.Text == ","))
+		if endOfStatement && depth == 0 {
+			r.statement(stmt)
+			stmt = stmt[:0]
+			continue
+		}
+		stmt = append(stmt, tok)
+	}
+	r.statement(stmt)
+	return r.names
+}
+
+func newScope(function bool) *scope {
+	return &scope{function: function, names: map[string]bool{"ans": true}}
+}
+
+// assigned reports whether name is a variable of the current scope
+func (r *nameResolver) assigned(name string) bool {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if r.scopes[i].names[name] {
+			return true
+		}
+		if r.scopes[i].function {
+			break
+		}
+	}
+	return false
+}
+
+// declare marks the identifier tok as not calling a function
+func (r *nameResolver) declare(tok token) {
+	r.names.variables[positionOf(tok)] = true
+}
+
+// define makes tok a variable of the current block from now on
+func (r *nameResolver) define(tok token) {
+	r.declare(tok)
+	r.scopes[len(r.scopes)-1].names[tok.Text] = true
+}
+
+// keyword opens, switches or closes blocks
+func (r *nameResolver) keyword(text string) {
+	switch text {
+	case "if", "while", "for", "parfor", "switch", "try", "unwind_protect", "do":
+		r.scopes = append(r.scopes, newScope(false))
+	case "function":
+		r.scopes = append(r.scopes, newScope(true))
+	case "elseif", "else", "case", "otherwise", "catch", "unwind_protect_cleanup":
+		if !r.scopes[len(r.scopes)-1].function {
+			r.scopes[len(r.scopes)-1] = newScope(false)
+		}
+	case "end", "endif", "endwhile", "endfor", "endparfor", "endswitch",
+		"end_try_catch", "end_unwind_protect", "until", "endfunction":
+		if len(r.scopes) > 1 {
+			r.scopes = r.scopes[:len(r.scopes)-1]
+		}
+	}
+}
+
+// statement records the names a finished statement assigns or declares
+func (r *nameResolver) statement(stmt []token) {
+	// Skip keywords that open a block, as in "else x = 1"
+	for len(stmt) > 0 && stmt[0].Kind == tokenKeyword {
+		switch stmt[0].Text {
+		case "function":
+			r.functionHeader(stmt[1:])
+			return
+		case "global", "persistent":
+			// global a b = 1 c declares a, b and c, which start out empty
+			depth := 0
+			for i, tok := range stmt {
+				switch {
+				case tok.Kind == tokenOperator && (tok.Text == "(" || tok.Text == "[" || tok.Text == "{"):
+					depth++
+				case tok.Kind == tokenOperator && (tok.Text == ")" || tok.Text == "]" || tok.Text == "}"):
+					depth--
+				case tok.Kind == tokenIdent && depth == 0 && stmt[i-1].Kind != tokenOperator:
+					r.define(tok)
+				}
+			}
+			return
+		case "catch":
+			// catch err
+			if len(stmt) == 2 && stmt[1].Kind == tokenIdent {
+				r.define(stmt[1])
+			}
+			return
+		}
+		stmt = stmt[1:]
+	}
+	// for (i = 1:n)
+	if len(stmt) > 0 && stmt[0].Kind == tokenOperator && stmt[0].Text == "(" {
+		stmt = stmt[1:]
+	}
+
+	lhs := -1
+	depth := 0
+	for i, tok := range stmt {
+		if tok.Kind != tokenOperator {
+			continue
+		}
+		switch tok.Text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case "=":
+			if depth == 0 {
+				lhs = i
+			}
+		}
+		if lhs >= 0 {
+			break
+		}
+	}
+	if lhs <= 0 {
+		return
+	}
+
+	target := stmt[:lhs]
+	if target[0].Kind == tokenIdent {
+		r.define(target[0])
+		return
+	}
+	// Multiple return values, [a, b] = ...
+	depth = 0
+	for i, tok := range target {
+		switch {
+		case tok.Kind == tokenOperator && (tok.Text == "(" || tok.Text == "[" || tok.Text == "{"):
+			depth++
+		case tok.Kind == tokenOperator && (tok.Text == ")" || tok.Text == "]" || tok.Text == "}"):
+			depth--
+		case tok.Kind == tokenIdent && depth == 1:
+			if i > 0 && target[i-1].Kind == tokenOperator && target[i-1].Text == "." {
+				continue
+			}
+			r.define(tok)
+		}
+	}
+}
+
+// functionHeader records a function definition such as [a, b] = name (x, y).
+// The outputs and parameters are declarations, but are not assigned when the
+// body starts.
+func (r *nameResolver) functionHeader(header []token) {
+	name := -1
+	for i, tok := range header {
+		if tok.Kind == tokenOperator && tok.Text == "=" {
+			name = -1
+			for j := i + 1; j < len(header); j++ {
+				if header[j].Kind == tokenIdent {
+					name = j
+					break
+				}
+			}
+			break
+		}
+		if name < 0 && tok.Kind == tokenIdent {
+			name = i
+		}
+	}
+	for i, tok := range header {
+		if tok.Kind != tokenIdent {
+			continue
+		}
+		r.declare(tok)
+		// Only a function defined at top level is surely defined once its
+		// definition ran, the function keyword opened the second scope
+		if i == name && len(r.scopes) == 2 {
+			r.names.functions[tok.Text] = positionOf(tok)
+		}
+	}
+}
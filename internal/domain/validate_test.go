@@ -0,0 +1,135 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		wantFunc string
+		line     int
+		column   int
+	}{
+		// Scripts rejected by the old substring matching that are harmless
+		{name: "function name inside string", script: `disp("save(x)")`},
+		{name: "function name inside single quoted string", script: `msg = 'call system(';`},
+		{name: "logical or", script: "a = true; b = false; c = a || b;"},
+		{name: "logical and", script: "c = 1 && 0;"},
+		{name: "function name in comment", script: "x = 1; % system('ls')"},
+		{name: "function name in block comment", script: "%{\nsystem('ls')\n%}\nx = 1;"},
+		{name: "struct field", script: "s.save = 1; s.load(2) = 3;"},
+		{name: "transpose before string", script: "x = a'; y = 'load';"},
+		{name: "identifier containing denied name", script: "systematic = 1; saved = 2;"},
+		{name: "anonymous function in cellfun", script: "cellfun(@(x) x * 2, {1, 2})"},
+		{name: "safe function name in feval", script: `feval("sin", 1)`},
+		{name: "safe handle in feval", script: "feval(@sin, 1)"},
+		{name: "safe anonymous function in str2func", script: `f = str2func("@(x) x + 1");`},
+
+		// Direct calls
+		{name: "direct call", script: "system('ls')", wantFunc: "system", line: 1, column: 1},
+		{name: "call with space", script: `system ("ls")`, wantFunc: "system", line: 1, column: 1},
+		{name: "call with tab", script: "system\t('ls')", wantFunc: "system", line: 1, column: 1},
+		{name: "command syntax", script: "x = 1;\nsystem ls", wantFunc: "system", line: 2, column: 1},
+		{name: "call without parentheses", script: "y = 2; x = evalc", wantFunc: "evalc", line: 1, column: 12},
+		{name: "after comment line", script: "# system('safe');\n  unix('rm -rf /')", wantFunc: "unix", line: 2, column: 3},
+		{name: "after transpose", script: "x = a';system('ls')", wantFunc: "system", line: 1, column: 8},
+		{name: "inside matrix", script: "x = [1 save('f')]", wantFunc: "save", line: 1, column: 8},
+		{name: "python", script: `python("-c", "import os")`, wantFunc: "python", line: 1, column: 1},
+		{name: "perl", script: `perl("x; id")`, wantFunc: "perl", line: 1, column: 1},
+		{name: "mkoctfile", script: `mkoctfile("--eval")`, wantFunc: "mkoctfile", line: 1, column: 1},
+		{name: "java", script: `java("java.lang.Runtime")`, wantFunc: "java", line: 1, column: 1},
+		{name: "javaMethod", script: `javaMethod("exec", javaMethod("getRuntime", "java.lang.Runtime"), "id")`, wantFunc: "javaMethod", line: 1, column: 1},
+		{name: "javaObject", script: `javaObject("java.lang.ProcessBuilder", "id")`, wantFunc: "javaObject", line: 1, column: 1},
+		{name: "web", script: `web("http://example.com")`, wantFunc: "web", line: 1, column: 1},
+		{name: "webread", script: `webread("http://example.com")`, wantFunc: "webread", line: 1, column: 1},
+		{name: "webwrite", script: `webwrite("http://example.com", "x")`, wantFunc: "webwrite", line: 1, column: 1},
+		{name: "websave", script: `websave("f", "http://example.com")`, wantFunc: "websave", line: 1, column: 1},
+		{name: "urlwrite", script: `urlwrite("http://example.com", "f")`, wantFunc: "urlwrite", line: 1, column: 1},
+		{name: "ftp", script: `f = ftp("example.com")`, wantFunc: "ftp", line: 1, column: 5},
+		{name: "rehash after writing code", script: "f = fopen(\"x.m\", \"w\"); fclose(f);\nrehash", wantFunc: "rehash", line: 2, column: 1},
+		{name: "addpath", script: `addpath("/tmp/code")`, wantFunc: "addpath", line: 1, column: 1},
+		{name: "path", script: `path("/tmp/code", path)`, wantFunc: "path", line: 1, column: 1},
+		{name: "rmpath", script: `rmpath("/usr/share/octave")`, wantFunc: "rmpath", line: 1, column: 1},
+		{name: "setenv", script: `setenv("LD_PRELOAD", "/tmp/x.so")`, wantFunc: "setenv", line: 1, column: 1},
+		{name: "putenv", script: `putenv("PATH", "/tmp")`, wantFunc: "putenv", line: 1, column: 1},
+		{name: "unsetenv", script: `unsetenv("HOME")`, wantFunc: "unsetenv", line: 1, column: 1},
+
+		// Indirect calls
+		{name: "feval with string", script: `feval("system", "ls")`, wantFunc: "system", line: 1, column: 7},
+		{name: "feval with space", script: `feval ('system', 'ls')`, wantFunc: "system", line: 1, column: 8},
+		{name: "feval command syntax", script: `feval system ls`, wantFunc: "system", line: 1, column: 7},
+		{name: "cellfun with string", script: `cellfun("system", {"ls"})`, wantFunc: "system", line: 1, column: 9},
+		{name: "function handle", script: "f = @system; f('ls')", wantFunc: "system", line: 1, column: 6},
+		{name: "handle in cellfun", script: "cellfun(@unix, {'ls'})", wantFunc: "unix", line: 1, column: 10},
+		{name: "str2func", script: `f = str2func("popen");`, wantFunc: "popen", line: 1, column: 14},
+		{name: "str2func anonymous function", script: `f = str2func("@(c) system(c)");`, wantFunc: "system", line: 1, column: 14},
+		{name: "inline", script: `f = inline("system(x)");`, wantFunc: "system", line: 1, column: 12},
+		{name: "dynamic feval", script: "name = 'system'; feval(name, 'ls')", wantFunc: "feval", line: 1, column: 18},
+		{name: "dynamic str2func", script: "f = str2func(['sys' 'tem']);", wantFunc: "str2func", line: 1, column: 5},
+		{name: "handle to dispatcher", script: "f = @feval; f('system', 'ls')", wantFunc: "feval", line: 1, column: 6},
+		{name: "builtin", script: `builtin("system", "ls")`, wantFunc: "system", line: 1, column: 9},
+		{name: "hex escape in feval", script: `feval("\x73ystem", "id")`, wantFunc: "system", line: 1, column: 7},
+		{name: "octal escape in feval", script: `feval("\163ystem", "id")`, wantFunc: "system", line: 1, column: 7},
+		{name: "variable followed by operator word", script: "a = 1;\na -system(\"id\")", wantFunc: "system", line: 2, column: 4},
+		{name: "variable followed by comparison word", script: "a = 1; a ==system(\"id\")", wantFunc: "system", line: 1, column: 12},
+		{name: "nthargout with string", script: `nthargout(1, "system", "id")`, wantFunc: "system", line: 1, column: 14},
+		{name: "nthargout with output count", script: `nthargout(1, 2, "system", "id")`, wantFunc: "system", line: 1, column: 17},
+		{name: "bsxfun with string", script: `bsxfun("system", "id", "")`, wantFunc: "system", line: 1, column: 8},
+		{name: "fzero with string", script: `fzero("system", 1)`, wantFunc: "system", line: 1, column: 7},
+		{name: "integral with variable", script: "f = 'system'; integral(f, 0, 1)", wantFunc: "integral", line: 1, column: 15},
+		{name: "ode45 with anonymous function", script: "ode45(@(t, y) -y, [0 1], 1)"},
+		{name: "sqp with omitted functions", script: "sqp([1; 1], @(x) sum(x.^2), [], [])"},
+		{name: "print to pipe", script: `print("|lpr")`, wantFunc: "print", line: 1, column: 7},
+		{name: "print to pipe with command syntax", script: "print -dpng |cat", wantFunc: "print", line: 1, column: 13},
+		{name: "print to built pipe", script: `print(["|" "id"], "-dpng")`, wantFunc: "print", line: 1, column: 8},
+		{name: "print to file", script: `print("out.png", "-dpng")`},
+		{name: "anonymous function body", script: "f = @() urlread('http://x');", wantFunc: "urlread", line: 1, column: 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateScript(tt.script)
+			if tt.wantFunc == "" {
+				if err != nil {
+					t.Errorf("Expected script to pass, got: %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected ValidationError, got: %v", err)
+			}
+			v := validationErr.Violations[0]
+			if v.Function != tt.wantFunc || v.Line != tt.line || v.Column != tt.column {
+				t.Errorf("Expected %s at %d:%d, got %s at %d:%d (%s)", tt.wantFunc, tt.line, tt.column, v.Function, v.Line, v.Column, v.Message)
+			}
+		})
+	}
+}
+
+func TestValidateScript_ReportsEveryViolation(t *testing.T) {
+	err := validateScript("system('a');\nx = 1;\nsave('f', 'x');")
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got: %v", err)
+	}
+	if len(validationErr.Violations) != 2 {
+		t.Fatalf("Expected 2 violations, got: %v", validationErr.Violations)
+	}
+	expected := "script contains forbidden function calls: line 1, column 1: call to forbidden function system (rule deny); line 3, column 1: call to forbidden function save (rule deny)"
+	if err.Error() != expected {
+		t.Errorf("Expected error: %s, got: %s", expected, err.Error())
+	}
+}
+
+func TestValidateScript_SyntaxError(t *testing.T) {
+	err := validateScript("x = 'unterminated")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected SyntaxError, got: %v", err)
+	}
+}
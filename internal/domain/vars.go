@@ -0,0 +1,378 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Workspace variables requested through ExecOptions.ReturnVars are serialized
+// with Octave's jsonencode and decoded into plain JSON values:
+//
+//   - real numeric and logical scalars become JSON numbers and booleans
+//   - non-scalar arrays keep their shape as nested arrays, outermost dimension
+//     first, so a 2x3 matrix becomes [[a,b,c],[d,e,f]] and a 3x1 column vector
+//     becomes [[a],[b],[c]]
+//   - NaN, Inf and -Inf become the strings "NaN", "Infinity" and "-Infinity"
+//   - complex numbers become {"re": x, "im": y}
+//   - char row vectors become strings, char matrices arrays of row strings
+//   - scalar structs become objects, struct arrays arrays of objects
+//   - cell arrays become nested arrays of their decoded elements
+//   - other classes become {"unsupported": "<class>"}
+//   - variables that do not exist are returned as null
+
+// maxReturnVars caps how many variables a single execution may return
+const maxReturnVars = 32
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// errVarsNotCollected is returned when a script that ran without error never
+// reached the code printing the variables, which happens when it calls return
+var errVarsNotCollected = errors.New("return_vars could not be collected: the script stopped before its end, for example by calling return")
+
+// encoderFunction converts a value into a tagged representation that
+// jsonencode handles unambiguously. Values are flattened column-major and the
+// original size is sent along so the shape can be rebuilt on the Go side.
+const encoderFunction = `
+function r = __octave_mcp_encode__(v)
+  r.t = "unsupported";
+  r.sz = size(v);
+  if ischar(v)
+    r.t = "char";
+    r.v = num2cell(v, 2)';
+  elseif islogical(v)
+    r.t = "bool";
+    r.v = num2cell(v(:)');
+  elseif isnumeric(v)
+    r.t = "num";
+    r.re = __octave_mcp_encode_real__(real(v));
+    if iscomplex(v)
+      r.im = __octave_mcp_encode_real__(imag(v));
+    end
+  elseif isstruct(v)
+    r.t = "struct";
+    r.f = fieldnames(v)';
+    r.v = cell(1, numel(v));
+    for i = 1:numel(v)
+      e = struct();
+      for j = 1:numel(r.f)
+        e.(r.f{j}) = __octave_mcp_encode__(v(i).(r.f{j}));
+      end
+      r.v{i} = e;
+    end
+  elseif iscell(v)
+    r.t = "cell";
+    r.v = cellfun(@__octave_mcp_encode__, v(:)', "UniformOutput", false);
+  else
+    r.v = class(v);
+  end
+endfunction
+
+function c = __octave_mcp_encode_real__(x)
+  x = double(x(:)');
+  c = num2cell(x);
+  c(isnan(x)) = {"NaN"};
+  c(x == Inf) = {"Infinity"};
+  c(x == -Inf) = {"-Infinity"};
+endfunction
+`
+
+// validateReturnVars makes sure every requested name is a plain identifier,
+// the names are interpolated into the generated Octave code
+func validateReturnVars(names []string) error {
+	if len(names) > maxReturnVars {
+		return fmt.Errorf("too many return_vars: %d (maximum %d)", len(names), maxReturnVars)
+	}
+	for _, name := range names {
+		if !identifierRe.MatchString(name) {
+			return fmt.Errorf("invalid variable name in return_vars: %q", name)
+		}
+	}
+	return nil
+}
+
+// returnVarsScript generates the code appended to a script to print the
+// requested variables after marker, one name line followed by one JSON line each
+func returnVarsScript(names []string, marker string) string {
+	var b strings.Builder
+	b.WriteString("\n")
+	b.WriteString(encoderFunction)
+	fmt.Fprintf(&b, "fprintf(stdout, \"\\n%s\\n\");\n", marker)
+	for _, name := range names {
+		fmt.Fprintf(&b, "fprintf(stdout, \"%s\\n\");\n", name)
+		fmt.Fprintf(&b, "if exist(\"%s\", \"var\") == 1\n", name)
+		fmt.Fprintf(&b, "  fprintf(stdout, \"%%s\\n\", jsonencode(__octave_mcp_encode__(%s)));\n", name)
+		b.WriteString("else\n  fprintf(stdout, \"null\\n\");\nend\n")
+	}
+	return b.String()
+}
+
+// extractReturnedVars splits the variables printed by returnVarsScript from
+// the script output and decodes them
+func extractReturnedVars(stdout string, marker string) (string, map[string]any, error) {
+	output, encoded, found := strings.Cut(stdout, "\n"+marker+"\n")
+	if !found {
+		return stdout, nil, errVarsNotCollected
+	}
+
+	vars := make(map[string]any)
+	lines := strings.Split(strings.TrimRight(encoded, "\n"), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		name, raw := lines[i], lines[i+1]
+		value, err := decodeVar([]byte(raw))
+		if err != nil {
+			return output, nil, fmt.Errorf("failed to decode variable %s: %w", name, err)
+		}
+		vars[name] = value
+	}
+	return output, vars, nil
+}
+
+// encodedValue mirrors the structure produced by __octave_mcp_encode__
+type encodedValue struct {
+	T  string          `json:"t"`
+	Sz json.RawMessage `json:"sz"`
+	V  json.RawMessage `json:"v"`
+	Re json.RawMessage `json:"re"`
+	Im json.RawMessage `json:"im"`
+}
+
+// decodeVar turns the tagged jsonencode output into a plain JSON value
+func decodeVar(raw []byte) (any, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	var ev encodedValue
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return nil, err
+	}
+	return ev.decode()
+}
+
+func (ev *encodedValue) decode() (any, error) {
+	dims, err := decodeSize(ev.Sz)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ev.T {
+	case "char":
+		var rows []string
+		if err := decodeList(ev.V, &rows); err != nil {
+			return nil, err
+		}
+		if len(dims) == 2 && dims[0] <= 1 {
+			if len(rows) == 0 {
+				return "", nil
+			}
+			return filterOutput(rows[0]), nil
+		}
+		values := make([]any, len(rows))
+		for i, row := range rows {
+			values[i] = filterOutput(row)
+		}
+		return values, nil
+
+	case "bool":
+		var flat []any
+		if err := decodeList(ev.V, &flat); err != nil {
+			return nil, err
+		}
+		return reshape(flat, dims), nil
+
+	case "num":
+		var re, im []any
+		if err := decodeList(ev.Re, &re); err != nil {
+			return nil, err
+		}
+		if len(ev.Im) > 0 {
+			if err := decodeList(ev.Im, &im); err != nil {
+				return nil, err
+			}
+			if len(im) != len(re) {
+				return nil, fmt.Errorf("complex value has %d real and %d imaginary parts", len(re), len(im))
+			}
+			for i := range re {
+				re[i] = map[string]any{"re": re[i], "im": im[i]}
+			}
+		}
+		return reshape(re, dims), nil
+
+	case "struct", "cell":
+		var elems []json.RawMessage
+		if err := decodeList(ev.V, &elems); err != nil {
+			return nil, err
+		}
+		flat := make([]any, len(elems))
+		for i, elem := range elems {
+			if ev.T == "cell" {
+				value, err := decodeVar(elem)
+				if err != nil {
+					return nil, err
+				}
+				flat[i] = value
+				continue
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(elem, &fields); err != nil {
+				return nil, err
+			}
+			obj := make(map[string]any, len(fields))
+			for name, field := range fields {
+				value, err := decodeVar(field)
+				if err != nil {
+					return nil, err
+				}
+				obj[name] = value
+			}
+			flat[i] = obj
+		}
+		return reshape(flat, dims), nil
+
+	default:
+		var class string
+		if err := json.Unmarshal(ev.V, &class); err != nil {
+			class = ev.T
+		}
+		return map[string]any{"unsupported": class}, nil
+	}
+}
+
+// decodeSize reads the size vector, which jsonencode emits as a flat array
+func decodeSize(raw json.RawMessage) ([]int, error) {
+	var dims []int
+	if err := json.Unmarshal(raw, &dims); err != nil {
+		return nil, fmt.Errorf("invalid size: %w", err)
+	}
+	return dims, nil
+}
+
+// decodeList unmarshals a list that may be missing when it is empty
+func decodeList(raw json.RawMessage, dst any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+// reshape rebuilds an N-d array from values flattened in column-major order.
+// Scalars are returned unwrapped.
+func reshape(flat []any, dims []int) any {
+	total := 1
+	for _, d := range dims {
+		total *= d
+	}
+	if total == 1 && len(flat) == 1 {
+		return flat[0]
+	}
+	if total != len(flat) || len(dims) == 0 {
+		return flat
+	}
+
+	strides := make([]int, len(dims))
+	stride := 1
+	for k, d := range dims {
+		strides[k] = stride
+		stride *= d
+	}
+
+	var build func(k int, offset int) any
+	build = func(k int, offset int) any {
+		if k == len(dims) {
+			return flat[offset]
+		}
+		out := make([]any, dims[k])
+		for i := range out {
+			out[i] = build(k+1, offset+i*strides[k])
+		}
+		return out
+	}
+	return build(0, 0)
+}
+
+// maxSnapshotValueBytes caps the size, as reported by whos, of the variables
+// whose value is included in a snapshot
+const maxSnapshotValueBytes = 64 * 1024
+
+// VariableInfo describes a variable of a session workspace
+type VariableInfo struct {
+	Name  string `json:"name"`
+	Class string `json:"class"`
+	Size  []int  `json:"size"`
+	Bytes int64  `json:"bytes"`
+	// Value is the decoded value, nil when Omitted
+	Value any `json:"value"`
+	// Omitted reports that the value is larger than maxSnapshotValueBytes
+	Omitted bool `json:"omitted,omitempty"`
+}
+
+// variablesScript writes one line per variable of the workspace to
+// dir/variables.txt: name, class, size, bytes and, for small variables, the
+// encoded value, separated by tabs
+const variablesScript = `
+__octave_mcp_w__ = whos();
+__octave_mcp_fid__ = fopen([%[1]s "/variables.txt"], "w");
+for __octave_mcp_k__ = 1:numel(__octave_mcp_w__)
+  __octave_mcp_v__ = __octave_mcp_w__(__octave_mcp_k__);
+  if strncmp(__octave_mcp_v__.name, "__octave_mcp_", 13)
+    continue;
+  end
+  fprintf(__octave_mcp_fid__, "%%s\t%%s\t%%s\t%%d\t", __octave_mcp_v__.name, __octave_mcp_v__.class, mat2str(__octave_mcp_v__.size), __octave_mcp_v__.bytes);
+  if __octave_mcp_v__.bytes <= %[2]d
+    fputs(__octave_mcp_fid__, jsonencode(__octave_mcp_encode__(eval(__octave_mcp_v__.name))));
+  end
+  fputs(__octave_mcp_fid__, "\n");
+end
+fclose(__octave_mcp_fid__);
+clear __octave_mcp_w__ __octave_mcp_fid__ __octave_mcp_k__ __octave_mcp_v__
+`
+
+// Variables returns a snapshot of the variables of the session in opts,
+// sorted by name as whos lists them
+func (r *Runner) Variables(ctx context.Context, opts ExecOptions) ([]VariableInfo, error) {
+	if opts.SessionID == "" {
+		return nil, fmt.Errorf("variables are only kept in a session")
+	}
+	out, err := r.runWrapper(ctx, "variables.txt", func(dir string) string {
+		return encoderFunction + fmt.Sprintf(variablesScript, octaveString(dir), maxSnapshotValueBytes)
+	}, r.scriptTimeout(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list variables: %w", err)
+	}
+	return parseVariables(out)
+}
+
+// parseVariables decodes the lines written by variablesScript
+func parseVariables(out string) ([]VariableInfo, error) {
+	vars := []VariableInfo{}
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		fields := strings.SplitN(line, "\t", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		v := VariableInfo{Name: fields[0], Class: fields[1]}
+		for _, dim := range strings.Fields(strings.Trim(fields[2], "[]")) {
+			n, err := strconv.Atoi(dim)
+			if err != nil {
+				return nil, fmt.Errorf("invalid size of %s: %q", v.Name, fields[2])
+			}
+			v.Size = append(v.Size, n)
+		}
+		v.Bytes, _ = strconv.ParseInt(fields[3], 10, 64)
+		if fields[4] == "" {
+			v.Omitted = true
+		} else {
+			value, err := decodeVar([]byte(fields[4]))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode variable %s: %w", v.Name, err)
+			}
+			v.Value = value
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
@@ -0,0 +1,192 @@
+package domain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeVar(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "scalar",
+			raw:  `{"t":"num","sz":[1,1],"re":[42]}`,
+			want: `42`,
+		},
+		{
+			name: "matrix keeps shape",
+			raw:  `{"t":"num","sz":[2,3],"re":[1,4,2,5,3,6]}`,
+			want: `[[1,2,3],[4,5,6]]`,
+		},
+		{
+			name: "row vector",
+			raw:  `{"t":"num","sz":[1,3],"re":[1,2,3]}`,
+			want: `[[1,2,3]]`,
+		},
+		{
+			name: "column vector",
+			raw:  `{"t":"num","sz":[3,1],"re":[1,2,3]}`,
+			want: `[[1],[2],[3]]`,
+		},
+		{
+			name: "empty matrix",
+			raw:  `{"t":"num","sz":[0,0],"re":[]}`,
+			want: `[]`,
+		},
+		{
+			name: "three dimensional",
+			raw:  `{"t":"num","sz":[1,2,2],"re":[1,2,3,4]}`,
+			want: `[[[1,3],[2,4]]]`,
+		},
+		{
+			name: "non-finite values",
+			raw:  `{"t":"num","sz":[1,3],"re":["NaN","Infinity","-Infinity"]}`,
+			want: `[["NaN","Infinity","-Infinity"]]`,
+		},
+		{
+			name: "complex",
+			raw:  `{"t":"num","sz":[1,1],"re":[1],"im":[-2]}`,
+			want: `{"im":-2,"re":1}`,
+		},
+		{
+			name: "logical",
+			raw:  `{"t":"bool","sz":[1,2],"v":[true,false]}`,
+			want: `[[true,false]]`,
+		},
+		{
+			name: "string",
+			raw:  `{"t":"char","sz":[1,5],"v":["hello"]}`,
+			want: `"hello"`,
+		},
+		{
+			name: "empty string",
+			raw:  `{"t":"char","sz":[0,0],"v":[]}`,
+			want: `""`,
+		},
+		{
+			name: "char matrix",
+			raw:  `{"t":"char","sz":[2,2],"v":["ab","cd"]}`,
+			want: `["ab","cd"]`,
+		},
+		{
+			name: "struct",
+			raw:  `{"t":"struct","sz":[1,1],"f":["a","b"],"v":[{"a":{"t":"num","sz":[1,1],"re":[1]},"b":{"t":"char","sz":[1,1],"v":["x"]}}]}`,
+			want: `{"a":1,"b":"x"}`,
+		},
+		{
+			name: "cell",
+			raw:  `{"t":"cell","sz":[1,2],"v":[{"t":"num","sz":[1,1],"re":[1]},{"t":"char","sz":[1,2],"v":["hi"]}]}`,
+			want: `[[1,"hi"]]`,
+		},
+		{
+			name: "unsupported",
+			raw:  `{"t":"unsupported","sz":[1,1],"v":"function_handle"}`,
+			want: `{"unsupported":"function_handle"}`,
+		},
+		{
+			name: "missing variable",
+			raw:  `null`,
+			want: `null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := decodeVar([]byte(tt.raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %s, got: %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExtractReturnedVars(t *testing.T) {
+	stdout := "ans = 3\n\nMARK\nA\n{\"t\":\"num\",\"sz\":[1,1],\"re\":[3]}\nmissing\nnull\n"
+
+	output, vars, err := extractReturnedVars(stdout, "MARK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "ans = 3\n" {
+		t.Errorf("Expected script output to be preserved, got: %q", output)
+	}
+	want := map[string]any{"A": float64(3), "missing": nil}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("Expected %v, got: %v", want, vars)
+	}
+}
+
+func TestExtractReturnedVars_MissingMarker(t *testing.T) {
+	output, vars, err := extractReturnedVars("ans = 3\n", "MARK")
+	if !errors.Is(err, errVarsNotCollected) {
+		t.Fatalf("Expected return_vars to be reported as not collected, got: %v", err)
+	}
+	if output != "ans = 3\n" || vars != nil {
+		t.Errorf("Expected the output alone, got: %q %v", output, vars)
+	}
+}
+
+func TestVariablesScript_QuotedDir(t *testing.T) {
+	dir := `/tmp/a"b\c'd`
+	script := fmt.Sprintf(variablesScript, octaveString(dir), maxSnapshotValueBytes)
+	if strings.Contains(script, dir) {
+		t.Fatalf("Expected the directory to be encoded:\n%s", script)
+	}
+	want := `fopen([char(sscanf("` + hex.EncodeToString([]byte(dir)) + `", "%2x").') "/variables.txt"], "w");`
+	if !strings.Contains(script, want) {
+		t.Errorf("Expected script to contain %q:\n%s", want, script)
+	}
+}
+
+func TestValidateReturnVars(t *testing.T) {
+	if err := validateReturnVars([]string{"A", "b_2"}); err != nil {
+		t.Errorf("Expected valid names, got: %v", err)
+	}
+	for _, name := range []string{"", "1a", "a;system('ls')", "a b"} {
+		err := validateReturnVars([]string{name})
+		if err == nil || !strings.Contains(err.Error(), "invalid variable name") {
+			t.Errorf("Expected %q to be rejected, got: %v", name, err)
+		}
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	out := "m\tdouble\t[2 2]\t32\t{\"t\":\"num\",\"sz\":[2,2],\"re\":[1,3,2,4]}\n" +
+		"big\tdouble\t[1000 1000]\t8000000\t\n"
+	vars, err := parseVariables(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != 2 {
+		t.Fatalf("Expected 2 variables, got %+v", vars)
+	}
+	m := vars[0]
+	if m.Name != "m" || m.Class != "double" || len(m.Size) != 2 || m.Bytes != 32 || m.Omitted {
+		t.Errorf("Unexpected variable %+v", m)
+	}
+	if got, _ := json.Marshal(m.Value); string(got) != "[[1,2],[3,4]]" {
+		t.Errorf("Unexpected value %s", got)
+	}
+	if !vars[1].Omitted || vars[1].Value != nil {
+		t.Errorf("Expected the large value to be omitted, got %+v", vars[1])
+	}
+
+	if vars, err := parseVariables(""); err != nil || len(vars) != 0 {
+		t.Errorf("Expected no variables, got %+v, %v", vars, err)
+	}
+}
@@ -0,0 +1,412 @@
+package domain
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	workerShutdownGrace         = 2 * time.Second
+	defaultWorkerStartupSeconds = 30
+	// workerReadBufferSize bounds how much of a single line is held in
+	// memory, longer lines are forwarded in several chunks
+	workerReadBufferSize = 32 * 1024
+)
+
+var (
+	// ErrScriptFailed is returned when a script raised an Octave error
+	ErrScriptFailed = errors.New("octave script failed")
+	// ErrWorkerExited is returned when the interpreter process died mid-execution
+	ErrWorkerExited = errors.New("octave process exited unexpectedly")
+)
+
+// worker is a long-lived octave-cli process driven over stdin/stdout.
+//
+// Every script is sent inside a frame that evaluates it in a try/catch and then
+// prints a unique sentinel line on both stdout and stderr. Output is attributed
+// to an execution by reading each stream up to its sentinel, so the interpreter
+// (and its workspace) survives between executions.
+type worker struct {
+	logger *slog.Logger
+	cmd    *exec.Cmd
+	limits resourceLimits
+	stdin  io.WriteCloser
+	stdout chan chunk
+	stderr chan chunk
+	// done is closed once the process has exited and its pipes are drained
+	done chan struct{}
+	// quit is closed when the worker is shut down so readers stop forwarding
+	quit chan struct{}
+	// exchangeDir is the directory the interpreter shares with the server,
+	// "" meaning the default temp dir. It is removed once the process exits.
+	exchangeDir string
+	// home is the initial working directory of the interpreter and
+	// homeEntries what it held, which a pooled worker is checked against
+	// before being reused
+	home        string
+	homeEntries []string
+	// execs counts the executions a pooled worker served
+	execs int
+
+	closeOnce sync.Once
+}
+
+// startWorker launches an interpreter, inside sb unless it is nil, and waits
+// until it is ready to accept scripts
+func startWorker(ctx context.Context, logger *slog.Logger, sb *sandbox) (*worker, error) {
+	exchangeDir, err := sb.workerDir()
+	if err != nil {
+		return nil, err
+	}
+	// Until the process runs, the exchange dir has to be removed here
+	fail := func(err error) (*worker, error) {
+		removeExchangeDir(logger, exchangeDir)
+		return nil, err
+	}
+
+	cmd, err := sb.command(exchangeDir, "octave-cli", "--silent", "--no-window-system", "--no-history")
+	if err != nil {
+		return fail(err)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fail(fmt.Errorf("failed to create stdin pipe: %w", err))
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fail(fmt.Errorf("failed to create stdout pipe: %w", err))
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fail(fmt.Errorf("failed to create stderr pipe: %w", err))
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fail(fmt.Errorf("failed to start octave: %w", err))
+	}
+
+	// Limits are applied before the interpreter gets any input
+	limits := loadResourceLimits(logger)
+	if err := limits.apply(cmd.Process.Pid); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fail(err)
+	}
+
+	w := &worker{
+		logger:      logger,
+		cmd:         cmd,
+		limits:      limits,
+		stdin:       stdin,
+		stdout:      make(chan chunk, 64),
+		stderr:      make(chan chunk, 64),
+		done:        make(chan struct{}),
+		quit:        make(chan struct{}),
+		exchangeDir: exchangeDir,
+	}
+
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		readChunks(stdout, w.stdout, w.quit)
+	}()
+	go func() {
+		defer readers.Done()
+		readChunks(stderr, w.stderr, w.quit)
+	}()
+	go func() {
+		// Wait closes the pipes, so it must only run once both readers hit EOF
+		readers.Wait()
+		if err := cmd.Wait(); err != nil {
+			logger.Debug("octave worker exited", "pid", cmd.Process.Pid, "error", err)
+		}
+		removeExchangeDir(logger, exchangeDir)
+		close(w.done)
+	}()
+
+	// The first frame doubles as a readiness probe, disables the pager and
+	// records the working directory
+	out, err := w.exec(ctx, readyScript, captureOptions{})
+	if err != nil {
+		w.kill()
+		if stderr := strings.TrimSpace(out.stderr); stderr != "" {
+			return nil, fmt.Errorf("octave did not become ready: %w: %s", err, stderr)
+		}
+		return nil, fmt.Errorf("octave did not become ready: %w", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.stdout, "\n"), "\n")
+	w.home, w.homeEntries = lines[0], lines[1:]
+
+	logger.Debug("octave worker started", "pid", cmd.Process.Pid)
+	return w, nil
+}
+
+// readyScript prints the working directory of a new interpreter followed by
+// its entries, one per line
+const readyScript = `more off; page_screen_output(false);
+printf("%s\n", pwd());
+__octave_mcp_d__ = readdir(".");
+printf("%s\n", __octave_mcp_d__{:});
+clear __octave_mcp_d__;`
+
+// removeExchangeDir deletes the exchange dir of an interpreter, if it has one
+func removeExchangeDir(logger *slog.Logger, dir string) {
+	if dir == "" {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		logger.Warn("Failed to remove worker exchange dir", "error", err, "exchange_dir", dir)
+	}
+}
+
+// chunk is a piece of output read from the interpreter. Lines longer than the
+// read buffer arrive in several chunks, only the last one has eol set.
+type chunk struct {
+	text string
+	eol  bool
+}
+
+// readChunks forwards the lines read from r to chunks and closes it on EOF.
+// Once quit is closed the remaining output is discarded so the pipe can drain.
+func readChunks(r io.Reader, chunks chan<- chunk, quit <-chan struct{}) {
+	defer close(chunks)
+	br := bufio.NewReaderSize(r, workerReadBufferSize)
+	for {
+		data, err := br.ReadSlice('\n')
+		if len(data) > 0 {
+			c := chunk{text: string(data), eol: err != bufio.ErrBufferFull}
+			if c.eol {
+				c.text = strings.TrimRight(c.text, "\r\n")
+			}
+			select {
+			case chunks <- c:
+			case <-quit:
+			}
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}
+
+// octaveString returns an Octave expression evaluating to s. The string is
+// hex-encoded to avoid any quoting issues, so that paths and scripts can be
+// interpolated into generated code whatever characters they hold.
+func octaveString(s string) string {
+	return fmt.Sprintf(`char(sscanf("%s", "%%2x").')`, hex.EncodeToString([]byte(s)))
+}
+
+// frameScript wraps script so that its completion can be detected on both
+// output streams
+func frameScript(script, token string) string {
+	return fmt.Sprintf(`try
+  eval(%s);
+  fprintf(stdout, "\n%s 0\n");
+catch
+  fprintf(stderr, "error: %%s\n", lasterr());
+  fprintf(stdout, "\n%s 1\n");
+end
+fprintf(stderr, "\n%s\n");
+fflush(stdout);
+fflush(stderr);
+`, octaveString(script), token, token, token)
+}
+
+// exec runs script in the interpreter and returns what it wrote to stdout and
+// stderr, bounded by capture, and the CPU time it took. The worker is killed
+// if ctx expires or the script floods its output before finishing, because
+// there is no reliable way to interrupt a running evaluation.
+func (w *worker) exec(ctx context.Context, script string, capture captureOptions) (execOutput, error) {
+	before := w.cpuTime()
+	out, err := w.evaluate(ctx, script, capture)
+	out.cpu = max(w.cpuTime()-before, 0)
+	return out, err
+}
+
+// cpuTime returns the CPU time the interpreter and the children it reaped,
+// such as gnuplot, consumed since it started
+func (w *worker) cpuTime() time.Duration {
+	select {
+	case <-w.done:
+		// Gone from /proc once reaped, but Wait kept its usage, which covers
+		// its reaped children as well
+		return w.cmd.ProcessState.UserTime() + w.cmd.ProcessState.SystemTime()
+	default:
+	}
+	if used, err := processCPUTime(w.cmd.Process.Pid); err == nil {
+		return used
+	}
+	if w.stopped() {
+		if state := w.exitState(); state != nil {
+			return state.UserTime() + state.SystemTime()
+		}
+	}
+	return 0
+}
+
+// evaluate runs script for exec
+func (w *worker) evaluate(ctx context.Context, script string, capture captureOptions) (execOutput, error) {
+	token := "__octave_mcp_" + strings.ReplaceAll(uuid.NewString(), "-", "") + "__"
+
+	if err := w.limits.armCPU(w.cmd.Process.Pid); err != nil {
+		w.logger.Warn("Failed to set cpu limit for execution", "error", err)
+	}
+
+	if _, err := io.WriteString(w.stdin, frameScript(script, token)); err != nil {
+		w.kill()
+		return execOutput{}, fmt.Errorf("failed to send script to octave: %w", err)
+	}
+
+	failed := false
+	stdoutChunks, stderrChunks := w.stdout, w.stderr
+	stdout, stderr := newOutputBuffer(capture), newOutputBuffer(capture)
+	stream := newLineStream(capture)
+	var vars strings.Builder
+	inVars := false
+	// Sentinels and markers are only recognized at the start of a line
+	stdoutPartial, stderrPartial := false, false
+	result := func() execOutput {
+		out := execOutput{
+			// Drop the newline the frame prints ahead of each sentinel
+			stdout:      strings.TrimSuffix(stdout.String(), "\n"),
+			stderr:      strings.TrimSuffix(stderr.String(), "\n"),
+			stdoutBytes: stdout.totalBytes,
+			stderrBytes: stderr.totalBytes,
+			truncated:   stdout.dropped() > 0 || stderr.dropped() > 0,
+		}
+		// Do not count the newline of the frame either
+		if stdoutChunks == nil && out.stdoutBytes > 0 {
+			out.stdoutBytes--
+		}
+		if stderrChunks == nil && out.stderrBytes > 0 {
+			out.stderrBytes--
+		}
+		if inVars {
+			out.stdout += "\n" + capture.varsMarker + "\n" + vars.String()
+		}
+		return out
+	}
+	for stdoutChunks != nil || stderrChunks != nil {
+		select {
+		case c, ok := <-stdoutChunks:
+			if !ok {
+				w.kill()
+				out := result()
+				return out, w.limits.classify(ErrWorkerExited, out.stderr, w.exitState())
+			}
+			if !stdoutPartial && c.eol {
+				if status, found := strings.CutPrefix(c.text, token+" "); found {
+					failed = status != "0"
+					stdoutChunks = nil
+					continue
+				}
+				if capture.varsMarker != "" && c.text == capture.varsMarker {
+					inVars = true
+					continue
+				}
+			}
+			stdoutPartial = !c.eol
+			if inVars {
+				vars.WriteString(c.text)
+				if c.eol {
+					vars.WriteByte('\n')
+				}
+				if vars.Len() > maxVarsOutputBytes {
+					w.kill()
+					return result(), fmt.Errorf("%w: return_vars exceed %d bytes", ErrOutputLimit, maxVarsOutputBytes)
+				}
+				continue
+			}
+			stdout.write(c.text, c.eol)
+			stream.write(c.text, c.eol)
+			if stdout.exceeded() {
+				w.kill()
+				return result(), ErrOutputLimit
+			}
+		case c, ok := <-stderrChunks:
+			if !ok {
+				w.kill()
+				out := result()
+				return out, w.limits.classify(ErrWorkerExited, out.stderr, w.exitState())
+			}
+			if !stderrPartial && c.eol && c.text == token {
+				stderrChunks = nil
+				continue
+			}
+			stderrPartial = !c.eol
+			stderr.write(c.text, c.eol)
+			if stderr.exceeded() {
+				w.kill()
+				return result(), ErrOutputLimit
+			}
+		case <-ctx.Done():
+			w.kill()
+			return result(), ctx.Err()
+		}
+	}
+
+	out := result()
+	if failed {
+		return out, w.limits.classify(ErrScriptFailed, out.stderr, nil)
+	}
+	return out, nil
+}
+
+// exitState waits briefly for the process to exit and returns how it ended,
+// or nil if it is still running
+func (w *worker) exitState() *os.ProcessState {
+	select {
+	case <-w.done:
+		return w.cmd.ProcessState
+	case <-time.After(workerShutdownGrace):
+		return nil
+	}
+}
+
+// stopped reports whether the worker was shut down or its process exited
+func (w *worker) stopped() bool {
+	select {
+	case <-w.quit:
+		return true
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// kill terminates the interpreter immediately
+func (w *worker) kill() {
+	w.closeOnce.Do(func() {
+		close(w.quit)
+		w.stdin.Close()
+		w.cmd.Process.Kill()
+	})
+}
+
+// close asks the interpreter to exit and kills it if it does not comply in time
+func (w *worker) close() {
+	w.closeOnce.Do(func() {
+		close(w.quit)
+		w.stdin.Close()
+		select {
+		case <-w.done:
+		case <-time.After(workerShutdownGrace):
+			w.cmd.Process.Kill()
+		}
+	})
+}
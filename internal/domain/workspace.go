@@ -0,0 +1,304 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkspaceMaxFiles = 50
+	defaultWorkspaceMaxBytes = 50 * 1024 * 1024
+)
+
+var (
+	// ErrFileNotFound is returned when a workspace holds no file with the given name
+	ErrFileNotFound = errors.New("file not found")
+	// ErrWorkspaceQuota is returned when a workspace holds too many files or bytes
+	ErrWorkspaceQuota = errors.New("workspace quota exceeded")
+)
+
+// workspaceFileNameRe matches the names of workspace files. Workspaces are
+// flat, names cannot hold a path.
+var workspaceFileNameRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// codeExtensions are the extensions Octave runs as functions. The workspace is
+// the working directory of the session, so such files would be callable
+// without going through the validator.
+var codeExtensions = []string{".m", ".oct", ".mex", ".mexa64", ".mexglx", ".mexmaci64", ".mexw64"}
+
+// FileInfo describes a file in a session workspace
+type FileInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// WorkspaceUsage is the space a workspace uses against its quota
+type WorkspaceUsage struct {
+	Files    int   `json:"files"`
+	Bytes    int64 `json:"bytes"`
+	MaxFiles int   `json:"max_files"`
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// checkWorkspaceFileName reports why name cannot name a workspace file
+func checkWorkspaceFileName(name string) error {
+	if !workspaceFileNameRe.MatchString(name) {
+		return fmt.Errorf("invalid file name %q, use a plain file name of letters, digits, '_', '-' and '.'", name)
+	}
+	if slices.Contains(codeExtensions, strings.ToLower(filepath.Ext(name))) {
+		return fmt.Errorf("file %s cannot be stored in the workspace, code files are not allowed", name)
+	}
+	return nil
+}
+
+// workspaceQuota caps the files of a session workspace
+type workspaceQuota struct {
+	maxFiles int
+	maxBytes int64
+}
+
+// loadWorkspaceQuota reads the workspace quota from the environment
+func loadWorkspaceQuota(logger *slog.Logger) workspaceQuota {
+	// Configure file count cap (default: 50)
+	maxFiles := defaultWorkspaceMaxFiles
+	if limitStr := os.Getenv("OCTAVE_WORKSPACE_MAX_FILES"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
+			maxFiles = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_WORKSPACE_MAX_FILES, using default", "value", limitStr)
+		}
+	}
+
+	// Configure total size cap (default: 50 MiB)
+	maxBytes := int64(defaultWorkspaceMaxBytes)
+	if limitStr := os.Getenv("OCTAVE_WORKSPACE_MAX_BYTES"); limitStr != "" {
+		if limit, err := strconv.ParseInt(limitStr, 10, 64); err == nil && limit > 0 {
+			maxBytes = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_WORKSPACE_MAX_BYTES, using default", "value", limitStr)
+		}
+	}
+
+	return workspaceQuota{maxFiles: maxFiles, maxBytes: maxBytes}
+}
+
+// workspace is the scratch directory of a session. It is the working
+// directory of the session interpreter and the only place its file I/O may
+// touch. Server-side access goes through an os.Root so that links created by
+// a script cannot lead outside.
+type workspace struct {
+	dir   string
+	root  *os.Root
+	quota workspaceQuota
+	// mu serializes changes so that quota checks hold
+	mu sync.Mutex
+}
+
+// newWorkspace creates a workspace under parent, "" meaning the default temp dir
+func newWorkspace(parent string, quota workspaceQuota) (*workspace, error) {
+	// MkdirTemp creates the directory with 0700 permissions
+	dir, err := os.MkdirTemp(parent, "octave-session-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to open workspace: %w", err)
+	}
+	return &workspace{dir: dir, root: root, quota: quota}, nil
+}
+
+// remove deletes the workspace and its files
+func (w *workspace) remove() error {
+	w.root.Close()
+	return os.RemoveAll(w.dir)
+}
+
+// list returns the regular files of the workspace sorted by name
+func (w *workspace) list() ([]FileInfo, error) {
+	entries, err := fs.ReadDir(w.root.FS(), ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace: %w", err)
+	}
+	files := []FileInfo{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Deleted in the meantime
+			continue
+		}
+		files = append(files, FileInfo{Name: entry.Name(), Size: info.Size(), Modified: info.ModTime()})
+	}
+	return files, nil
+}
+
+// usage returns the space used by files against the quota
+func (w *workspace) usage(files []FileInfo) WorkspaceUsage {
+	usage := WorkspaceUsage{Files: len(files), MaxFiles: w.quota.maxFiles, MaxBytes: w.quota.maxBytes}
+	for _, f := range files {
+		usage.Bytes += f.Size
+	}
+	return usage
+}
+
+// checkQuota reports whether the files written so far fit the quota
+func (w *workspace) checkQuota() error {
+	files, err := w.list()
+	if err != nil {
+		return err
+	}
+	usage := w.usage(files)
+	if usage.Files > usage.MaxFiles || usage.Bytes > usage.MaxBytes {
+		return fmt.Errorf("%w: %d files, %d bytes (limits %d files, %d bytes), delete files with delete_file",
+			ErrWorkspaceQuota, usage.Files, usage.Bytes, usage.MaxFiles, usage.MaxBytes)
+	}
+	return nil
+}
+
+// stat returns the regular file called name
+func (w *workspace) stat(name string) (os.FileInfo, error) {
+	if err := checkWorkspaceFileName(name); err != nil {
+		return nil, err
+	}
+	info, err := w.root.Lstat(name)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && !info.Mode().IsRegular()) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return info, nil
+}
+
+// write stores data as name, replacing any file with that name, unless the
+// workspace would exceed its quota
+func (w *workspace) write(name string, data []byte) (FileInfo, error) {
+	if err := checkWorkspaceFileName(name); err != nil {
+		return FileInfo{}, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	files, err := w.list()
+	if err != nil {
+		return FileInfo{}, err
+	}
+	count, size := 1, int64(len(data))
+	for _, f := range files {
+		if f.Name == name {
+			continue
+		}
+		count++
+		size += f.Size
+	}
+	if count > w.quota.maxFiles {
+		return FileInfo{}, fmt.Errorf("%w: at most %d files", ErrWorkspaceQuota, w.quota.maxFiles)
+	}
+	if size > w.quota.maxBytes {
+		return FileInfo{}, fmt.Errorf("%w: at most %d bytes, %d would be used", ErrWorkspaceQuota, w.quota.maxBytes, size)
+	}
+
+	if info, err := w.root.Lstat(name); err == nil && !info.Mode().IsRegular() {
+		return FileInfo{}, fmt.Errorf("%s exists and is not a regular file", name)
+	}
+	if err := w.root.WriteFile(name, data, 0600); err != nil {
+		return FileInfo{}, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	info, err := w.root.Stat(name)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return FileInfo{Name: name, Size: info.Size(), Modified: info.ModTime()}, nil
+}
+
+// read returns the content of name
+func (w *workspace) read(name string) ([]byte, error) {
+	info, err := w.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > w.quota.maxBytes {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrWorkspaceQuota, name, w.quota.maxBytes)
+	}
+	data, err := w.root.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// delete removes name
+func (w *workspace) delete(name string) error {
+	if _, err := w.stat(name); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.root.Remove(name); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// UploadFile stores a file in the workspace of a session
+func (r *Runner) UploadFile(sessionID, name string, data []byte) (FileInfo, error) {
+	files, err := r.sessions.workspace(sessionID)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info, err := files.write(name, data)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	r.logger.Debug("File uploaded", "session_id", sessionID, "name", name, "size", info.Size)
+	return info, nil
+}
+
+// ListFiles returns the files in the workspace of a session and the space
+// they use
+func (r *Runner) ListFiles(sessionID string) ([]FileInfo, WorkspaceUsage, error) {
+	files, err := r.sessions.workspace(sessionID)
+	if err != nil {
+		return nil, WorkspaceUsage{}, err
+	}
+	list, err := files.list()
+	if err != nil {
+		return nil, WorkspaceUsage{}, err
+	}
+	return list, files.usage(list), nil
+}
+
+// ReadFile returns the content of a file in the workspace of a session
+func (r *Runner) ReadFile(sessionID, name string) ([]byte, error) {
+	files, err := r.sessions.workspace(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return files.read(name)
+}
+
+// DeleteFile removes a file from the workspace of a session
+func (r *Runner) DeleteFile(sessionID, name string) error {
+	files, err := r.sessions.workspace(sessionID)
+	if err != nil {
+		return err
+	}
+	return files.delete(name)
+}
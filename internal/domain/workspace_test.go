@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestWorkspace(t *testing.T, quota workspaceQuota) *workspace {
+	t.Helper()
+	w, err := newWorkspace(t.TempDir(), quota)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.remove() })
+	return w
+}
+
+func TestWorkspace(t *testing.T) {
+	w := newTestWorkspace(t, workspaceQuota{maxFiles: 2, maxBytes: 10})
+
+	info, err := os.Stat(w.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("Expected 0700 permissions, got %o", info.Mode().Perm())
+	}
+
+	if _, err := w.write("a.csv", []byte("1,2\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := w.read("a.csv")
+	if err != nil || string(data) != "1,2\n" {
+		t.Errorf("Unexpected content %q: %v", data, err)
+	}
+
+	// Replacing a file only counts its new size
+	if _, err := w.write("a.csv", []byte("1,2,3,4\n")); err != nil {
+		t.Errorf("Expected the file to be replaced, got: %v", err)
+	}
+	if _, err := w.write("b.csv", []byte("12345")); !errors.Is(err, ErrWorkspaceQuota) {
+		t.Errorf("Expected the byte quota to be exceeded, got: %v", err)
+	}
+	if _, err := w.write("b.csv", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.write("c.csv", nil); !errors.Is(err, ErrWorkspaceQuota) {
+		t.Errorf("Expected the file quota to be exceeded, got: %v", err)
+	}
+
+	files, err := w.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "a.csv" || files[1].Name != "b.csv" {
+		t.Errorf("Unexpected files %+v", files)
+	}
+	if usage := w.usage(files); usage.Files != 2 || usage.Bytes != 9 {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+
+	if err := w.delete("b.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.delete("b.csv"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected a missing file, got: %v", err)
+	}
+
+	// Files written by scripts are checked after the fact
+	if err := os.WriteFile(filepath.Join(w.dir, "big.bin"), make([]byte, 20), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.checkQuota(); !errors.Is(err, ErrWorkspaceQuota) {
+		t.Errorf("Expected the quota to be exceeded, got: %v", err)
+	}
+}
+
+func TestWorkspace_Names(t *testing.T) {
+	w := newTestWorkspace(t, workspaceQuota{maxFiles: 10, maxBytes: 1024})
+	for _, name := range []string{"../x", "/etc/passwd", "a/b", ".hidden", "", "f.m", "lib.MEX"} {
+		if _, err := w.write(name, []byte("x")); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+
+	// Links left by a script cannot be followed out of the workspace
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(w.dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.read("link.txt"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Expected the link to be ignored, got: %v", err)
+	}
+	if _, err := w.write("link.txt", []byte("x")); err == nil {
+		t.Error("Expected writing through the link to fail")
+	}
+	if data, _ := os.ReadFile(outside); string(data) != "secret" {
+		t.Errorf("File outside the workspace was changed: %q", data)
+	}
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// apiKeyHeader carries an API key for clients that cannot set Authorization
+const apiKeyHeader = "X-API-Key"
+
+// toolsExtra is the TokenInfo.Extra entry listing the tools a principal may
+// call, absent when every tool is allowed
+const toolsExtra = "tools"
+
+// apiKeyLifetime is the expiration reported for API keys without one. The
+// token info only lives for a request, keys are checked again on the next.
+const apiKeyLifetime = time.Hour
+
+// apiKey is an API key accepted by the HTTP transport. Only the SHA-256 of
+// the key is stored.
+type apiKey struct {
+	// Label names the key holder in logs, it becomes the principal
+	Label string `json:"label"`
+	// SHA256 is the hex encoded SHA-256 of the key
+	SHA256 string `json:"sha256"`
+	// Tools lists the tools the key may call, empty means every tool
+	Tools []string `json:"tools,omitempty"`
+	// Expires is when the key stops being accepted, nil means never
+	Expires *time.Time `json:"expires,omitempty"`
+
+	hash []byte
+}
+
+// apiKeys is the set of keys loaded from the file named by
+// OCTAVE_MCP_API_KEYS_FILE, for example:
+//
+//	{
+//	  "keys": [
+//	    {"label": "ci", "sha256": "9f86d081884c7d65...", "tools": ["run_octave"]},
+//	    {"label": "alice", "sha256": "60303ae22b998861...", "expires": "2027-01-01T00:00:00Z"}
+//	  ]
+//	}
+type apiKeys struct {
+	Keys []apiKey `json:"keys"`
+}
+
+// loadAPIKeys reads and validates an API key file
+func loadAPIKeys(path string) (*apiKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key file: %w", err)
+	}
+	return parseAPIKeys(data)
+}
+
+// parseAPIKeys parses a JSON API key file. Unknown fields are rejected so that
+// typos do not silently widen what a key may do.
+func parseAPIKeys(data []byte) (*apiKeys, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	k := &apiKeys{}
+	if err := dec.Decode(k); err != nil {
+		return nil, fmt.Errorf("invalid API key file: %w", err)
+	}
+	if len(k.Keys) == 0 {
+		return nil, fmt.Errorf("invalid API key file: no keys")
+	}
+	labels := make(map[string]bool, len(k.Keys))
+	for i := range k.Keys {
+		key := &k.Keys[i]
+		if key.Label == "" {
+			return nil, fmt.Errorf("invalid API key file: key %d has no label", i)
+		}
+		if labels[key.Label] {
+			return nil, fmt.Errorf("invalid API key file: duplicate label %q", key.Label)
+		}
+		labels[key.Label] = true
+		hash, err := hex.DecodeString(strings.TrimSpace(key.SHA256))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid API key file: sha256 of %q must be 64 hex digits", key.Label)
+		}
+		key.hash = hash
+	}
+	return k, nil
+}
+
+// verify checks a key presented as a bearer token. It matches the key against
+// every stored hash in constant time, so timing does not tell which keys exist.
+func (k *apiKeys) verify(ctx context.Context, token string, req *http.Request) (*auth.TokenInfo, error) {
+	sum := sha256.Sum256([]byte(token))
+	var found *apiKey
+	for i := range k.Keys {
+		if subtle.ConstantTimeCompare(sum[:], k.Keys[i].hash) == 1 {
+			found = &k.Keys[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: unknown API key", auth.ErrInvalidToken)
+	}
+
+	expiration := time.Now().Add(apiKeyLifetime)
+	if found.Expires != nil {
+		if !found.Expires.After(time.Now()) {
+			return nil, fmt.Errorf("%w: API key %s expired", auth.ErrInvalidToken, found.Label)
+		}
+		if found.Expires.Before(expiration) {
+			expiration = *found.Expires
+		}
+	}
+	info := &auth.TokenInfo{
+		UserID:     "apikey:" + found.Label,
+		Expiration: expiration,
+	}
+	if len(found.Tools) > 0 {
+		info.Extra = map[string]any{toolsExtra: found.Tools}
+	}
+	return info, nil
+}
+
+// authMiddleware requires requests to carry a token accepted by verifier,
+// either as a bearer token or in the X-API-Key header. The token info is
+// attached to the request context, where the MCP handler passes it on to
+// tool calls and binds sessions to the principal that created them.
+func authMiddleware(verifier auth.TokenVerifier, opts *auth.RequireBearerTokenOptions, next http.Handler) http.Handler {
+	protected := auth.RequireBearerToken(verifier, opts)(recordPrincipal(next))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get(apiKeyHeader); key != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
+// recordPrincipal hands the authenticated principal to loggingMiddleware
+func recordPrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rw, ok := w.(*responseWriter); ok {
+			rw.principal = principal(auth.TokenInfoFromContext(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// principal names the authenticated caller, "" when unauthenticated
+func principal(info *auth.TokenInfo) string {
+	if info == nil {
+		return ""
+	}
+	return info.UserID
+}
+
+// allowedTools returns the tools a caller may call, nil when unrestricted
+func allowedTools(info *auth.TokenInfo) []string {
+	if info == nil {
+		return nil
+	}
+	tools, _ := info.Extra[toolsExtra].([]string)
+	return tools
+}
+
+// resourceTool names the tool that grants access to a session resource:
+// download_file for files, run_octave for the variables snapshot, which runs
+// Octave in the session
+func resourceTool(uri string) string {
+	if _, name, ok := parseSessionURI(uri); ok && name == "" {
+		return "run_octave"
+	}
+	return "download_file"
+}
+
+// authorizeTools hides and refuses the tools a principal may not call, and
+// the resources those tools would give access to
+func authorizeTools(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		var info *auth.TokenInfo
+		if extra := req.GetExtra(); extra != nil {
+			info = extra.TokenInfo
+		}
+		allowed := allowedTools(info)
+		if allowed == nil {
+			return next(ctx, method, req)
+		}
+
+		switch method {
+		case "tools/call":
+			params, _ := req.GetParams().(*mcp.CallToolParamsRaw)
+			if params != nil && !slices.Contains(allowed, params.Name) {
+				return &mcp.CallToolResult{
+					IsError: true,
+					Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%s is not allowed to call %s", principal(info), params.Name)}},
+				}, nil
+			}
+		case "tools/list":
+			result, err := next(ctx, method, req)
+			if list, ok := result.(*mcp.ListToolsResult); ok && err == nil {
+				list.Tools = slices.DeleteFunc(list.Tools, func(t *mcp.Tool) bool {
+					return !slices.Contains(allowed, t.Name)
+				})
+			}
+			return result, err
+		case "resources/read", "resources/subscribe":
+			var uri string
+			switch params := req.GetParams().(type) {
+			case *mcp.ReadResourceParams:
+				uri = params.URI
+			case *mcp.SubscribeParams:
+				uri = params.URI
+			}
+			if tool := resourceTool(uri); !slices.Contains(allowed, tool) {
+				return nil, fmt.Errorf("%s is not allowed to access %s without %s", principal(info), uri, tool)
+			}
+		case "resources/list":
+			result, err := next(ctx, method, req)
+			if list, ok := result.(*mcp.ListResourcesResult); ok && err == nil {
+				list.Resources = slices.DeleteFunc(list.Resources, func(r *mcp.Resource) bool {
+					return !slices.Contains(allowed, resourceTool(r.URI))
+				})
+			}
+			return result, err
+		case "resources/templates/list":
+			result, err := next(ctx, method, req)
+			if list, ok := result.(*mcp.ListResourceTemplatesResult); ok && err == nil {
+				list.ResourceTemplates = slices.DeleteFunc(list.ResourceTemplates, func(t *mcp.ResourceTemplate) bool {
+					return !slices.Contains(allowed, resourceTool(t.URITemplate))
+				})
+			}
+			return result, err
+		}
+		return next(ctx, method, req)
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func sha256Hex(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseAPIKeys_Invalid(t *testing.T) {
+	hash := sha256Hex("secret")
+	tests := []struct {
+		name   string
+		keys   string
+		errMsg string
+	}{
+		{name: "malformed JSON", keys: `{"keys": [`, errMsg: "invalid API key file"},
+		{name: "unknown field", keys: `{"keys": [{"label": "a", "key": "secret"}]}`, errMsg: `unknown field "key"`},
+		{name: "no keys", keys: `{"keys": []}`, errMsg: "no keys"},
+		{name: "no label", keys: `{"keys": [{"sha256": "` + hash + `"}]}`, errMsg: "key 0 has no label"},
+		{name: "duplicate label", keys: `{"keys": [{"label": "a", "sha256": "` + hash + `"}, {"label": "a", "sha256": "` + hash + `"}]}`, errMsg: `duplicate label "a"`},
+		{name: "plain key", keys: `{"keys": [{"label": "a", "sha256": "secret"}]}`, errMsg: "must be 64 hex digits"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseAPIKeys([]byte(tt.keys))
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(`{"keys": [{"label": "ci", "sha256": "`+sha256Hex("secret")+`"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := loadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys.Keys) != 1 || keys.Keys[0].Label != "ci" {
+		t.Errorf("Unexpected keys: %+v", keys.Keys)
+	}
+
+	if _, err := loadAPIKeys(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing key file")
+	}
+}
+
+func TestAPIKeys_Verify(t *testing.T) {
+	expired := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	keys, err := parseAPIKeys([]byte(`{"keys": [
+		{"label": "ci", "sha256": "` + sha256Hex("ci-key") + `", "tools": ["run_octave"]},
+		{"label": "alice", "sha256": "` + strings.ToUpper(sha256Hex("alice-key")) + `"},
+		{"label": "old", "sha256": "` + sha256Hex("old-key") + `", "expires": "` + expired + `"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	info, err := keys.verify(ctx, "ci-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserID != "apikey:ci" {
+		t.Errorf("Expected principal apikey:ci, got %q", info.UserID)
+	}
+	if tools := allowedTools(info); len(tools) != 1 || tools[0] != "run_octave" {
+		t.Errorf("Expected tools [run_octave], got %v", tools)
+	}
+	if !info.Expiration.After(time.Now()) {
+		t.Errorf("Expected an expiration in the future, got %v", info.Expiration)
+	}
+
+	info, err = keys.verify(ctx, "alice-key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserID != "apikey:alice" || allowedTools(info) != nil {
+		t.Errorf("Unexpected token info for alice: %+v", info)
+	}
+
+	for _, token := range []string{"old-key", "wrong", "", sha256Hex("ci-key")} {
+		if _, err := keys.verify(ctx, token, nil); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken for %q, got %v", token, err)
+		}
+	}
+}
+
+// headerTransport adds headers to every request of an MCP client
+type headerTransport struct {
+	header http.Header
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.header {
+		req.Header[name] = values
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	keys, err := parseAPIKeys([]byte(`{"keys": [
+		{"label": "ci", "sha256": "` + sha256Hex("ci-key") + `", "tools": ["whoami"]},
+		{"label": "alice", "sha256": "` + sha256Hex("alice-key") + `"},
+		{"label": "reader", "sha256": "` + sha256Hex("reader-key") + `", "tools": ["download_file"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	server.AddReceivingMiddleware(authorizeTools)
+	mcp.AddTool(server, &mcp.Tool{Name: "whoami"}, func(ctx context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: principal(req.Extra.TokenInfo)}}}, nil, nil
+	})
+	mcp.AddTool(server, &mcp.Tool{Name: "other"}, func(ctx context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "other"}}}, nil, nil
+	})
+	readResource := func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{URI: req.Params.URI, Text: "x"}}}, nil
+	}
+	server.AddResource(&mcp.Resource{Name: "data.csv", URI: fileURI("s1", "data.csv")}, readResource)
+	server.AddResource(&mcp.Resource{Name: "variables", URI: variablesURI("s1")}, readResource)
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil)
+	ts := httptest.NewServer(authMiddleware(keys.verify, nil, handler))
+	defer ts.Close()
+
+	t.Run("Rejects missing and unknown keys", func(t *testing.T) {
+		for _, header := range []http.Header{{}, {"Authorization": {"Bearer wrong"}}, {"X-Api-Key": {"wrong"}}} {
+			req, _ := http.NewRequest(http.MethodPost, ts.URL, strings.NewReader(`{}`))
+			for name, values := range header {
+				req.Header[name] = values
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Expected 401 for %v, got %d", header, resp.StatusCode)
+			}
+		}
+	})
+
+	connect := func(t *testing.T, header http.Header) *mcp.ClientSession {
+		client := mcp.NewClient(&mcp.Implementation{Name: "client", Version: "1.0.0"}, nil)
+		session, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{
+			Endpoint:   ts.URL,
+			HTTPClient: &http.Client{Transport: headerTransport{header: header}},
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { session.Close() })
+		return session
+	}
+	callText := func(t *testing.T, session *mcp.ClientSession, name string) (string, bool) {
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Content[0].(*mcp.TextContent).Text, res.IsError
+	}
+
+	t.Run("Bearer token", func(t *testing.T) {
+		session := connect(t, http.Header{"Authorization": {"Bearer alice-key"}})
+		if text, _ := callText(t, session, "whoami"); text != "apikey:alice" {
+			t.Errorf("Expected principal apikey:alice, got %q", text)
+		}
+		if text, isError := callText(t, session, "other"); isError || text != "other" {
+			t.Errorf("Expected alice to call every tool, got %q", text)
+		}
+	})
+
+	t.Run("API key header and tool restrictions", func(t *testing.T) {
+		session := connect(t, http.Header{"X-Api-Key": {"ci-key"}})
+		if text, _ := callText(t, session, "whoami"); text != "apikey:ci" {
+			t.Errorf("Expected principal apikey:ci, got %q", text)
+		}
+		text, isError := callText(t, session, "other")
+		if !isError || !strings.Contains(text, "apikey:ci is not allowed to call other") {
+			t.Errorf("Expected other to be refused, got %q", text)
+		}
+		tools, err := session.ListTools(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tools.Tools) != 1 || tools.Tools[0].Name != "whoami" {
+			t.Errorf("Expected only whoami to be listed, got %d tools", len(tools.Tools))
+		}
+	})
+
+	t.Run("Resource restrictions", func(t *testing.T) {
+		uris := func(session *mcp.ClientSession) []string {
+			list, err := session.ListResources(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var uris []string
+			for _, r := range list.Resources {
+				uris = append(uris, r.URI)
+			}
+			return uris
+		}
+		read := func(session *mcp.ClientSession, uri string) error {
+			_, err := session.ReadResource(context.Background(), &mcp.ReadResourceParams{URI: uri})
+			return err
+		}
+
+		alice := connect(t, http.Header{"Authorization": {"Bearer alice-key"}})
+		if got := uris(alice); len(got) != 2 {
+			t.Errorf("Expected alice to see every resource, got %v", got)
+		}
+		if err := read(alice, variablesURI("s1")); err != nil {
+			t.Errorf("Expected alice to read the variables, got: %v", err)
+		}
+
+		reader := connect(t, http.Header{"Authorization": {"Bearer reader-key"}})
+		if got := uris(reader); !slices.Equal(got, []string{fileURI("s1", "data.csv")}) {
+			t.Errorf("Expected download_file to grant the files only, got %v", got)
+		}
+		if err := read(reader, fileURI("s1", "data.csv")); err != nil {
+			t.Errorf("Expected reader to read files, got: %v", err)
+		}
+		if err := read(reader, variablesURI("s1")); err == nil || !strings.Contains(err.Error(), "without run_octave") {
+			t.Errorf("Expected reading variables to be refused, got: %v", err)
+		}
+
+		ci := connect(t, http.Header{"X-Api-Key": {"ci-key"}})
+		if got := uris(ci); len(got) != 0 {
+			t.Errorf("Expected no resources, got %v", got)
+		}
+		if err := read(ci, fileURI("s1", "data.csv")); err == nil {
+			t.Error("Expected reading files to be refused")
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultAllowedOrigins lets local web clients in on any port
+const defaultAllowedOrigins = "http://localhost:*,http://127.0.0.1:*,http://[::1]:*"
+
+// CORS headers of the MCP endpoint
+const (
+	corsAllowMethods  = "GET, POST, DELETE, OPTIONS"
+	corsAllowHeaders  = "Accept, Authorization, Content-Type, Last-Event-ID, Mcp-Protocol-Version, Mcp-Session-Id, X-API-Key"
+	corsExposeHeaders = "Mcp-Session-Id, Mcp-Protocol-Version, WWW-Authenticate"
+	corsMaxAge        = "600"
+)
+
+// originPattern matches browser origins. Host may start with "*." to match
+// every subdomain, and port may be "*" to match any port or none.
+type originPattern struct {
+	scheme    string
+	host      string
+	subdomain bool
+	port      string
+}
+
+// parseOriginPattern parses an allowed origin such as https://app.example.com,
+// https://*.example.com or http://localhost:*
+func parseOriginPattern(pattern string) (originPattern, error) {
+	raw := strings.ToLower(strings.TrimSpace(pattern))
+	anyPort := strings.HasSuffix(raw, ":*")
+	raw = strings.TrimSuffix(raw, ":*")
+	// The wildcard label is not a valid host for url.Parse
+	scheme, rest, found := strings.Cut(raw, "://*.")
+	subdomain := found
+	if subdomain {
+		raw = scheme + "://" + rest
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" ||
+		u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" ||
+		strings.Contains(u.Host, "*") {
+		return originPattern{}, fmt.Errorf("invalid origin %q, use scheme://host[:port] with an optional *. subdomain or :* port wildcard", pattern)
+	}
+	p := originPattern{scheme: u.Scheme, host: u.Hostname(), subdomain: subdomain, port: u.Port()}
+	if anyPort {
+		if p.port != "" {
+			return originPattern{}, fmt.Errorf("invalid origin %q, more than one port", pattern)
+		}
+		p.port = "*"
+	}
+	return p, nil
+}
+
+// matches reports whether the parsed origin u matches the pattern
+func (p originPattern) matches(u *url.URL) bool {
+	if u.Scheme != p.scheme || (p.port != "*" && u.Port() != p.port) {
+		return false
+	}
+	host := u.Hostname()
+	if p.subdomain {
+		return strings.HasSuffix(host, "."+p.host) && len(host) > len(p.host)+1
+	}
+	return host == p.host
+}
+
+// originPolicy decides which browser origins may call the MCP endpoint
+type originPolicy struct {
+	patterns []originPattern
+}
+
+// loadOriginPolicy reads the allowed origins from OCTAVE_MCP_ALLOWED_ORIGINS,
+// a comma separated list
+func loadOriginPolicy(logger *slog.Logger) *originPolicy {
+	// Configure allowed origins (default: localhost on any port)
+	list := os.Getenv("OCTAVE_MCP_ALLOWED_ORIGINS")
+	if list == "" {
+		list = defaultAllowedOrigins
+	}
+	policy := &originPolicy{}
+	for _, entry := range strings.Split(list, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		pattern, err := parseOriginPattern(entry)
+		if err != nil {
+			logger.Warn("Invalid origin in OCTAVE_MCP_ALLOWED_ORIGINS, ignoring", "value", entry, "error", err)
+			continue
+		}
+		policy.patterns = append(policy.patterns, pattern)
+	}
+	return policy
+}
+
+// allows reports whether origin, an Origin header value, is allowed
+func (p *originPolicy) allows(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	// Origins carry no path, "null" and other opaque origins are refused
+	if err != nil || u.Host == "" || u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return false
+	}
+	for _, pattern := range p.patterns {
+		if pattern.matches(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// securityMiddleware refuses browser requests from origins that are not
+// allowed, answers CORS preflight requests and sets security headers.
+// Requests without an Origin header, from non-browser clients, pass.
+func securityMiddleware(origins *originPolicy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			w.Header().Add("Vary", "Origin")
+			if !origins.allows(origin) {
+				http.Error(w, "Invalid origin", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Security-Policy", "default-src 'self'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOriginPolicy_Allows(t *testing.T) {
+	t.Setenv("OCTAVE_MCP_ALLOWED_ORIGINS", "")
+	defaults := loadOriginPolicy(slog.Default())
+
+	t.Setenv("OCTAVE_MCP_ALLOWED_ORIGINS", "https://tools.corp.example, https://*.apps.example, http://dev.example:8080,not an origin")
+	custom := loadOriginPolicy(slog.Default())
+	if len(custom.patterns) != 3 {
+		t.Fatalf("Expected the invalid entry to be ignored, got %d patterns", len(custom.patterns))
+	}
+
+	tests := []struct {
+		name    string
+		policy  *originPolicy
+		origin  string
+		allowed bool
+	}{
+		{name: "localhost", policy: defaults, origin: "http://localhost", allowed: true},
+		{name: "localhost with port", policy: defaults, origin: "http://localhost:3000", allowed: true},
+		{name: "loopback address", policy: defaults, origin: "http://127.0.0.1:8080", allowed: true},
+		{name: "IPv6 loopback", policy: defaults, origin: "http://[::1]:8080", allowed: true},
+		{name: "evil prefix", policy: defaults, origin: "http://localhost.evil.com", allowed: false},
+		{name: "evil prefix with port", policy: defaults, origin: "http://localhost.evil.com:3000", allowed: false},
+		{name: "evil userinfo", policy: defaults, origin: "http://localhost@evil.com", allowed: false},
+		{name: "localhost over https", policy: defaults, origin: "https://localhost", allowed: false},
+		{name: "remote origin by default", policy: defaults, origin: "https://tools.corp.example", allowed: false},
+		{name: "null origin", policy: defaults, origin: "null", allowed: false},
+		{name: "exact match", policy: custom, origin: "https://tools.corp.example", allowed: true},
+		{name: "exact match is case insensitive", policy: custom, origin: "https://Tools.Corp.Example", allowed: true},
+		{name: "exact match scheme", policy: custom, origin: "http://tools.corp.example", allowed: false},
+		{name: "exact match port", policy: custom, origin: "https://tools.corp.example:8443", allowed: false},
+		{name: "exact match subdomain", policy: custom, origin: "https://x.tools.corp.example", allowed: false},
+		{name: "exact match evil suffix", policy: custom, origin: "https://tools.corp.example.evil.com", allowed: false},
+		{name: "exact match with path", policy: custom, origin: "https://tools.corp.example/x", allowed: false},
+		{name: "wildcard subdomain", policy: custom, origin: "https://a.apps.example", allowed: true},
+		{name: "wildcard nested subdomain", policy: custom, origin: "https://a.b.apps.example", allowed: true},
+		{name: "wildcard apex", policy: custom, origin: "https://apps.example", allowed: false},
+		{name: "wildcard evil sibling", policy: custom, origin: "https://evilapps.example", allowed: false},
+		{name: "wildcard evil suffix", policy: custom, origin: "https://a.apps.example.evil.com", allowed: false},
+		{name: "explicit port", policy: custom, origin: "http://dev.example:8080", allowed: true},
+		{name: "explicit port mismatch", policy: custom, origin: "http://dev.example:9090", allowed: false},
+		{name: "custom list replaces defaults", policy: custom, origin: "http://localhost:3000", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.allows(tt.origin); got != tt.allowed {
+				t.Errorf("Expected allows(%q) = %v, got %v", tt.origin, tt.allowed, got)
+			}
+		})
+	}
+}
+
+func TestParseOriginPattern_Invalid(t *testing.T) {
+	for _, pattern := range []string{"*", "tools.corp.example", "ftp://tools.corp.example", "https://a.*.example", "https://tools.corp.example/app", "https://*", "https://x.example:80:*"} {
+		if _, err := parseOriginPattern(pattern); err == nil {
+			t.Errorf("Expected %q to be refused", pattern)
+		}
+	}
+}
+
+func TestSecurityMiddleware(t *testing.T) {
+	t.Setenv("OCTAVE_MCP_ALLOWED_ORIGINS", "https://tools.corp.example")
+	var reached bool
+	handler := securityMiddleware(loadOriginPolicy(slog.Default()), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	serve := func(method, origin string, header http.Header) *httptest.ResponseRecorder {
+		reached = false
+		req := httptest.NewRequest(method, "/mcp", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Preflight from an allowed origin", func(t *testing.T) {
+		rec := serve(http.MethodOptions, "https://tools.corp.example", http.Header{
+			"Access-Control-Request-Method":  {"POST"},
+			"Access-Control-Request-Headers": {"content-type, mcp-session-id"},
+		})
+		if rec.Code != http.StatusNoContent || reached {
+			t.Fatalf("Expected 204 without reaching the handler, got %d", rec.Code)
+		}
+		h := rec.Header()
+		if h.Get("Access-Control-Allow-Origin") != "https://tools.corp.example" {
+			t.Errorf("Unexpected Access-Control-Allow-Origin %q", h.Get("Access-Control-Allow-Origin"))
+		}
+		if !strings.Contains(h.Get("Access-Control-Allow-Methods"), "DELETE") {
+			t.Errorf("Unexpected Access-Control-Allow-Methods %q", h.Get("Access-Control-Allow-Methods"))
+		}
+		for _, name := range []string{"Mcp-Session-Id", "Authorization", "Content-Type", "Mcp-Protocol-Version"} {
+			if !strings.Contains(h.Get("Access-Control-Allow-Headers"), name) {
+				t.Errorf("Expected %s in Access-Control-Allow-Headers, got %q", name, h.Get("Access-Control-Allow-Headers"))
+			}
+		}
+		if h.Get("Vary") != "Origin" {
+			t.Errorf("Expected Vary: Origin, got %q", h.Get("Vary"))
+		}
+	})
+
+	t.Run("Request from an allowed origin", func(t *testing.T) {
+		rec := serve(http.MethodPost, "https://tools.corp.example", nil)
+		if rec.Code != http.StatusAccepted || !reached {
+			t.Fatalf("Expected the handler to run, got %d", rec.Code)
+		}
+		if !strings.Contains(rec.Header().Get("Access-Control-Expose-Headers"), "Mcp-Session-Id") {
+			t.Errorf("Expected Mcp-Session-Id to be exposed, got %q", rec.Header().Get("Access-Control-Expose-Headers"))
+		}
+	})
+
+	t.Run("Refused origins", func(t *testing.T) {
+		for _, origin := range []string{"http://localhost.evil.com", "https://tools.corp.example.evil.com"} {
+			for _, method := range []string{http.MethodOptions, http.MethodPost} {
+				rec := serve(method, origin, http.Header{"Access-Control-Request-Method": {"POST"}})
+				if rec.Code != http.StatusForbidden || reached {
+					t.Errorf("Expected %s from %s to be refused, got %d", method, origin, rec.Code)
+				}
+				if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+					t.Errorf("Expected no Access-Control-Allow-Origin for %s", origin)
+				}
+			}
+		}
+	})
+
+	t.Run("Request without origin", func(t *testing.T) {
+		rec := serve(http.MethodPost, "", nil)
+		if rec.Code != http.StatusAccepted || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("Expected non-browser requests to pass without CORS headers, got %d", rec.Code)
+		}
+		if rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Error("Expected security headers")
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type uploadFileArgs struct {
+	SessionID string `json:"session_id"`
+	Name      string `json:"name" jsonschema:"the file name, e.g. data.csv. Workspaces are flat, the name cannot hold a path"`
+	Content   string `json:"content" jsonschema:"the file content"`
+	Encoding  string `json:"encoding,omitempty" jsonschema:"how content is encoded: text (default) or base64 for binary files such as .mat"`
+}
+
+type fileArgs struct {
+	SessionID string `json:"session_id"`
+	Name      string `json:"name"`
+}
+
+type listFilesArgs struct {
+	SessionID string `json:"session_id"`
+}
+
+// fileOutput describes a workspace file
+type fileOutput struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size" jsonschema:"the size in bytes"`
+	Modified string `json:"modified" jsonschema:"RFC 3339 time of the last change"`
+}
+
+// listFilesOutput is the structured content returned by list_files
+type listFilesOutput struct {
+	Files []fileOutput          `json:"files"`
+	Usage domain.WorkspaceUsage `json:"usage" jsonschema:"the files and bytes used against the workspace quota"`
+}
+
+// fileURI names a workspace file
+func fileURI(sessionID, name string) string {
+	return fmt.Sprintf("octave://session/%s/files/%s", sessionID, name)
+}
+
+// fileMIMEType guesses the MIME type of a workspace file from its extension
+func fileMIMEType(name string) string {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".csv":
+		return "text/csv"
+	case ".txt", ".dat":
+		return "text/plain"
+	case ".mat":
+		return "application/x-matlab-data"
+	default:
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+		return "application/octet-stream"
+	}
+}
+
+func toFileOutput(info domain.FileInfo) fileOutput {
+	return fileOutput{Name: info.Name, Size: info.Size, Modified: info.Modified.UTC().Format(time.RFC3339)}
+}
+
+// sessionFiles resolves the session whose workspace a file tool works on
+func (s *Server) sessionFiles(req *mcp.CallToolRequest, sessionID string) error {
+	if sessionID == "" {
+		return fmt.Errorf("session_id parameter is required, files live in the workspace of a session started with create_session")
+	}
+	_, err := s.execOptions(req, sessionID)
+	return err
+}
+
+func (s *Server) uploadFileHandler(ctx context.Context, req *mcp.CallToolRequest, args uploadFileArgs) (*mcp.CallToolResult, *fileOutput, error) {
+	if args.Name == "" {
+		return nil, nil, fmt.Errorf("name parameter is required")
+	}
+	if err := s.sessionFiles(req, args.SessionID); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	var data []byte
+	switch strings.ToLower(args.Encoding) {
+	case "", "text":
+		data = []byte(args.Content)
+	case "base64":
+		var err error
+		data, err = base64.StdEncoding.DecodeString(args.Content)
+		if err != nil {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("invalid base64 content: %v", err)}},
+			}, nil, nil
+		}
+	default:
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("unsupported encoding: %s (must be text or base64)", args.Encoding)}},
+		}, nil, nil
+	}
+
+	info, err := s.runner.UploadFile(args.SessionID, args.Name, data)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	s.syncResources(ctx, args.SessionID)
+	out := toFileOutput(info)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("uploaded %s (%d bytes)", info.Name, info.Size)}},
+	}, &out, nil
+}
+
+func (s *Server) listFilesHandler(ctx context.Context, req *mcp.CallToolRequest, args listFilesArgs) (*mcp.CallToolResult, *listFilesOutput, error) {
+	if err := s.sessionFiles(req, args.SessionID); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	files, usage, err := s.runner.ListFiles(args.SessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	out := &listFilesOutput{Files: make([]fileOutput, 0, len(files)), Usage: usage}
+	lines := make([]string, 0, len(files)+1)
+	for _, f := range files {
+		out.Files = append(out.Files, toFileOutput(f))
+		lines = append(lines, fmt.Sprintf("%s %d bytes", f.Name, f.Size))
+	}
+	lines = append(lines, fmt.Sprintf("%d of %d files, %d of %d bytes used", usage.Files, usage.MaxFiles, usage.Bytes, usage.MaxBytes))
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: strings.Join(lines, "\n")}},
+	}, out, nil
+}
+
+func (s *Server) downloadFileHandler(ctx context.Context, req *mcp.CallToolRequest, args fileArgs) (*mcp.CallToolResult, any, error) {
+	if args.Name == "" {
+		return nil, nil, fmt.Errorf("name parameter is required")
+	}
+	if err := s.sessionFiles(req, args.SessionID); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	data, err := s.runner.ReadFile(args.SessionID, args.Name)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.EmbeddedResource{Resource: fileContents(args.SessionID, args.Name, data)}},
+	}, nil, nil
+}
+
+// fileContents returns a workspace file as resource contents, as text when
+// it is valid UTF-8 and of a text type
+func fileContents(sessionID, name string, data []byte) *mcp.ResourceContents {
+	contents := &mcp.ResourceContents{URI: fileURI(sessionID, name), MIMEType: fileMIMEType(name)}
+	if strings.HasPrefix(contents.MIMEType, "text/") && utf8.Valid(data) {
+		contents.Text = string(data)
+	} else {
+		contents.Blob = data
+	}
+	return contents
+}
+
+func (s *Server) deleteFileHandler(ctx context.Context, req *mcp.CallToolRequest, args fileArgs) (*mcp.CallToolResult, any, error) {
+	if args.Name == "" {
+		return nil, nil, fmt.Errorf("name parameter is required")
+	}
+	if err := s.sessionFiles(req, args.SessionID); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	if err := s.runner.DeleteFile(args.SessionID, args.Name); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	s.syncResources(ctx, args.SessionID)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("deleted %s", args.Name)}},
+	}, nil, nil
+}
@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	// defaultRateBurst is how many requests a client may send at once
+	defaultRateBurst = 20
+	// defaultAuthFailureLimit is how many failed authentications an address
+	// may make per minute
+	defaultAuthFailureLimit = 10
+	// limiterSweepInterval is how often the buckets of idle clients are dropped
+	limiterSweepInterval = time.Minute
+	// anonymousCaller is charged for the executions of unauthenticated callers
+	// of the stdio transport
+	anonymousCaller = "anonymous"
+	// remoteAddrHeader hands the remote address of an HTTP request to the tool
+	// handlers, which only see its headers
+	remoteAddrHeader = "X-Octave-Mcp-Remote-Addr"
+)
+
+// meteredTools run Octave and count against the CPU quota
+var meteredTools = []string{
+	"run_octave", "generate_plot", "submit_octave_job", "check_octave_syntax",
+	"octave_help", "octave_lookfor", "list_octave_packages",
+}
+
+// rateLimiter keeps a token bucket per client. Buckets hold up to burst
+// tokens, refill at rate tokens per second, and every request takes one.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// loadRateLimiter reads the rate limit from the environment. It returns nil
+// when rate limiting is disabled.
+func loadRateLimiter(logger *slog.Logger) *rateLimiter {
+	// Configure request rate limit (default: unlimited)
+	perMinute := 0
+	if limitStr := os.Getenv("OCTAVE_MCP_RATE_LIMIT"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit >= 0 {
+			perMinute = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_MCP_RATE_LIMIT, using default", "value", limitStr)
+		}
+	}
+	if perMinute == 0 {
+		return nil
+	}
+
+	// Configure request burst (default: 20)
+	burst := defaultRateBurst
+	if burstStr := os.Getenv("OCTAVE_MCP_RATE_BURST"); burstStr != "" {
+		if b, err := strconv.Atoi(burstStr); err == nil && b > 0 {
+			burst = b
+		} else {
+			logger.Warn("Invalid OCTAVE_MCP_RATE_BURST, using default", "value", burstStr)
+		}
+	}
+
+	return newRateLimiter(float64(perMinute)/60, burst)
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// loadAuthFailureLimiter reads the limit of failed authentications per
+// address from the environment. It returns nil when the limit is disabled.
+func loadAuthFailureLimiter(logger *slog.Logger) *rateLimiter {
+	// Configure failed authentication limit (default: 10 per minute)
+	perMinute := defaultAuthFailureLimit
+	if limitStr := os.Getenv("OCTAVE_MCP_AUTH_FAILURE_LIMIT"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit >= 0 {
+			perMinute = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_MCP_AUTH_FAILURE_LIMIT, using default", "value", limitStr)
+		}
+	}
+	if perMinute == 0 {
+		return nil
+	}
+	return newRateLimiter(float64(perMinute)/60, perMinute)
+}
+
+// allow takes a token from the bucket of key. When the bucket is empty it
+// returns how long until the next token.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// wait returns how long until the bucket of key holds a token, without
+// taking it
+func (l *rateLimiter) wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// refill returns the bucket of key topped up to now, l.mu must be held
+func (l *rateLimiter) refill(key string) *tokenBucket {
+	now := l.now()
+	if now.Sub(l.lastSweep) > limiterSweepInterval {
+		// A bucket that refilled is the same as a missing one
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	return b
+}
+
+// retrySeconds rounds a wait up to whole seconds, as Retry-After expects
+func retrySeconds(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// clientKey identifies the client of a request for rate limiting: the
+// authenticated principal, or the remote IP address
+func clientKey(r *http.Request) string {
+	if p := principal(auth.TokenInfoFromContext(r.Context())); p != "" {
+		return p
+	}
+	return addressKey(r)
+}
+
+// addressKey identifies the client of a request by its remote IP address
+func addressKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// tooManyRequests answers 429 Too Many Requests with the time to wait
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := retrySeconds(wait)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, fmt.Sprintf("rate limit exceeded, retry after %d s", seconds), http.StatusTooManyRequests)
+}
+
+// rateLimitMiddleware answers 429 Too Many Requests to clients over the rate
+// limit. It runs after authentication to limit principals rather than
+// addresses where possible.
+func rateLimitMiddleware(limiter *rateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := clientKey(r)
+		if ok, wait := limiter.allow(key); !ok {
+			slog.Debug("Request rate limited", "client", key, "retry_after", retrySeconds(wait))
+			tooManyRequests(w, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authFailureMiddleware limits the failed authentications of each remote
+// address. It runs before authentication: an address out of tokens is refused
+// without checking its credentials, and every 401 answer takes a token.
+func authFailureMiddleware(limiter *rateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := addressKey(r)
+		if wait := limiter.wait(key); wait > 0 {
+			slog.Warn("Authentication attempts rate limited", "client", key, "retry_after", retrySeconds(wait))
+			tooManyRequests(w, wait)
+			return
+		}
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		if outer, ok := w.(*responseWriter); ok {
+			outer.principal = rw.principal
+		}
+		if rw.status == http.StatusUnauthorized {
+			limiter.allow(key)
+		}
+	})
+}
+
+// cpuQuota caps the CPU time the executions of each principal may use per
+// UTC day, as measured on the interpreter processes
+type cpuQuota struct {
+	limit time.Duration
+	now   func() time.Time
+
+	mu   sync.Mutex
+	day  string
+	used map[string]time.Duration
+}
+
+// loadCPUQuota reads the daily CPU quota from the environment. It returns nil
+// when there is no quota.
+func loadCPUQuota(logger *slog.Logger) *cpuQuota {
+	// Configure daily CPU quota per principal (default: unlimited)
+	seconds := 0
+	if limitStr := os.Getenv("OCTAVE_DAILY_CPU_QUOTA"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit >= 0 {
+			seconds = limit
+		} else {
+			logger.Warn("Invalid OCTAVE_DAILY_CPU_QUOTA, using default", "value", limitStr)
+		}
+	}
+	if seconds == 0 {
+		return nil
+	}
+	return newCPUQuota(time.Duration(seconds) * time.Second)
+}
+
+func newCPUQuota(limit time.Duration) *cpuQuota {
+	return &cpuQuota{limit: limit, now: time.Now, used: make(map[string]time.Duration)}
+}
+
+// today starts a new day of usage when the date changed, q.mu must be held
+func (q *cpuQuota) today() time.Time {
+	now := q.now().UTC()
+	if day := now.Format(time.DateOnly); day != q.day {
+		q.day = day
+		clear(q.used)
+	}
+	return now
+}
+
+// charge adds cpu to the usage of key
+func (q *cpuQuota) charge(key string, cpu time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.today()
+	q.used[key] += cpu
+	slog.Debug("CPU time charged", "principal", key, "cpu", cpu, "used", q.used[key])
+}
+
+// check returns how long key has to wait for the quota to reset, 0 while it
+// has quota left
+func (q *cpuQuota) check(key string) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.today()
+	if q.used[key] < q.limit {
+		return 0
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(now)
+}
+
+// remoteAddrMiddleware records the remote address of the request in
+// remoteAddrHeader, replacing any value sent by the client
+func remoteAddrMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		r.Header.Set(remoteAddrHeader, addressKey(r))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remaining returns the CPU time key has left today
+func (q *cpuQuota) remaining(key string) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.today()
+	return max(0, q.limit-q.used[key])
+}
+
+// quotaKey identifies the caller charged for a request: the authenticated
+// principal, the remote IP address over HTTP, or anonymousCaller
+func quotaKey(extra *mcp.RequestExtra) string {
+	if extra == nil {
+		return anonymousCaller
+	}
+	if p := principal(extra.TokenInfo); p != "" {
+		return p
+	}
+	if addr := extra.Header.Get(remoteAddrHeader); addr != "" {
+		return addr
+	}
+	return anonymousCaller
+}
+
+// metered reports whether a request runs Octave: a call to a metered tool or
+// a read of the variables resource of a session
+func metered(method string, req mcp.Request) bool {
+	switch params := req.GetParams().(type) {
+	case *mcp.CallToolParamsRaw:
+		return method == "tools/call" && slices.Contains(meteredTools, params.Name)
+	case *mcp.ReadResourceParams:
+		_, name, ok := parseSessionURI(params.URI)
+		return method == "resources/read" && ok && name == ""
+	}
+	return false
+}
+
+// enforce refuses metered requests once the caller used up its quota
+func (q *cpuQuota) enforce(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if !metered(method, req) {
+			return next(ctx, method, req)
+		}
+		key := quotaKey(req.GetExtra())
+		if wait := q.check(key); wait > 0 {
+			seconds := retrySeconds(wait)
+			msg := fmt.Sprintf("daily CPU quota of %s exhausted for %s, retry after %d s when the quota resets at midnight UTC",
+				q.limit, key, seconds)
+			if method != "tools/call" {
+				return nil, errors.New(msg)
+			}
+			return &mcp.CallToolResult{
+				Meta:    mcp.Meta{"retry_after": seconds},
+				IsError: true,
+				Content: []mcp.Content{&mcp.TextContent{Text: msg}},
+			}, nil
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// usageMeter returns the OnUsage callback that charges the executions of a
+// request to the caller, nil without a quota
+func (s *Server) usageMeter(extra *mcp.RequestExtra) func(time.Duration) {
+	if s.quota == nil {
+		return nil
+	}
+	key := quotaKey(extra)
+	return func(cpu time.Duration) {
+		s.quota.charge(key, cpu)
+	}
+}
+
+// cpuBudget returns the CPUBudget callback that caps the executions of a
+// request at the quota the caller has left, nil without a quota
+func (s *Server) cpuBudget(extra *mcp.RequestExtra) func() time.Duration {
+	if s.quota == nil {
+		return nil
+	}
+	key := quotaKey(extra)
+	return func() time.Duration {
+		return s.quota.remaining(key)
+	}
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// testClock is a settable time source
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time { return c.t }
+
+func TestLoadRateLimiter(t *testing.T) {
+	t.Setenv("OCTAVE_MCP_RATE_LIMIT", "")
+	if loadRateLimiter(slog.Default()) != nil {
+		t.Error("Expected rate limiting to be off by default")
+	}
+	t.Setenv("OCTAVE_MCP_RATE_LIMIT", "120")
+	t.Setenv("OCTAVE_MCP_RATE_BURST", "-1")
+	limiter := loadRateLimiter(slog.Default())
+	if limiter == nil || limiter.rate != 2 || limiter.burst != defaultRateBurst {
+		t.Errorf("Expected 2 requests per second with the default burst, got %+v", limiter)
+	}
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	clock := &testClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := newRateLimiter(1, 3)
+	limiter.now = clock.now
+
+	for i := range 3 {
+		if ok, _ := limiter.allow("alice"); !ok {
+			t.Fatalf("Expected request %d of the burst to pass", i+1)
+		}
+	}
+	ok, wait := limiter.allow("alice")
+	if ok || wait != time.Second {
+		t.Fatalf("Expected the bucket to be empty for 1s, got %v %v", ok, wait)
+	}
+	if ok, _ := limiter.allow("bob"); !ok {
+		t.Error("Expected other clients to have their own bucket")
+	}
+
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	if ok, wait := limiter.allow("alice"); ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected half a token after 500ms, got %v %v", ok, wait)
+	}
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	if ok, _ := limiter.allow("alice"); !ok {
+		t.Error("Expected a token after 1s")
+	}
+
+	clock.t = clock.t.Add(2 * limiterSweepInterval)
+	limiter.allow("carol")
+	if _, found := limiter.buckets["alice"]; found {
+		t.Error("Expected the refilled bucket to be swept")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := newRateLimiter(0.1, 1)
+	limited := rateLimitMiddleware(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	// The token is the principal
+	authenticated := auth.RequireBearerToken(func(ctx context.Context, token string, req *http.Request) (*auth.TokenInfo, error) {
+		return &auth.TokenInfo{UserID: token, Expiration: time.Now().Add(time.Hour)}, nil
+	}, nil)(limited)
+	serve := func(remote, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.RemoteAddr = remote
+		handler := limited
+		if user != "" {
+			req.Header.Set("Authorization", "Bearer "+user)
+			handler = authenticated
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("192.0.2.1:1234", ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected the first request to pass, got %d", rec.Code)
+	}
+	rec := serve("192.0.2.1:5678", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "10" {
+		t.Errorf("Expected 429 with Retry-After 10 for the same address, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("192.0.2.2:1234", ""); rec.Code != http.StatusAccepted {
+		t.Errorf("Expected another address to pass, got %d", rec.Code)
+	}
+	// Principals are limited across addresses
+	if rec := serve("192.0.2.1:1234", "apikey:ci"); rec.Code != http.StatusAccepted {
+		t.Errorf("Expected an authenticated client to have its own bucket, got %d", rec.Code)
+	}
+	if rec := serve("192.0.2.3:1234", "apikey:ci"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the principal to be limited from another address, got %d", rec.Code)
+	}
+}
+
+func TestCPUQuota(t *testing.T) {
+	t.Setenv("OCTAVE_DAILY_CPU_QUOTA", "")
+	if loadCPUQuota(slog.Default()) != nil {
+		t.Error("Expected no quota by default")
+	}
+
+	clock := &testClock{t: time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)}
+	quota := newCPUQuota(10 * time.Second)
+	quota.now = clock.now
+
+	quota.charge("apikey:ci", 6*time.Second)
+	if wait := quota.check("apikey:ci"); wait != 0 {
+		t.Errorf("Expected quota left, got wait %v", wait)
+	}
+	if left := quota.remaining("apikey:ci"); left != 4*time.Second {
+		t.Errorf("Expected 4s of quota left, got %v", left)
+	}
+	quota.charge("apikey:ci", 4*time.Second)
+	if wait := quota.check("apikey:ci"); wait != 2*time.Hour {
+		t.Errorf("Expected to wait until midnight UTC, got %v", wait)
+	}
+	quota.charge("apikey:ci", time.Second)
+	if left := quota.remaining("apikey:ci"); left != 0 {
+		t.Errorf("Expected no quota left, got %v", left)
+	}
+	if wait := quota.check(anonymousCaller); wait != 0 {
+		t.Errorf("Expected other callers to keep their quota, got wait %v", wait)
+	}
+
+	call := func(name string) *mcp.CallToolResult {
+		t.Helper()
+		next := func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			return &mcp.CallToolResult{}, nil
+		}
+		res, err := quota.enforce(next)(context.Background(), "tools/call", &mcp.CallToolRequest{
+			Params: &mcp.CallToolParamsRaw{Name: name},
+			Extra:  &mcp.RequestExtra{TokenInfo: &auth.TokenInfo{UserID: "apikey:ci"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.(*mcp.CallToolResult)
+	}
+
+	res := call("run_octave")
+	if !res.IsError || res.Meta["retry_after"] != 7200 {
+		t.Fatalf("Expected a tool error with retry_after 7200, got %+v", res)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "retry after 7200 s") {
+		t.Errorf("Expected the retry time in the message, got %q", text)
+	}
+	if res := call("list_files"); res.IsError {
+		t.Error("Expected tools that do not run Octave to pass")
+	}
+
+	read := func(uri string) error {
+		t.Helper()
+		next := func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			return &mcp.ReadResourceResult{}, nil
+		}
+		_, err := quota.enforce(next)(context.Background(), "resources/read", &mcp.ReadResourceRequest{
+			Params: &mcp.ReadResourceParams{URI: uri},
+			Extra:  &mcp.RequestExtra{TokenInfo: &auth.TokenInfo{UserID: "apikey:ci"}},
+		})
+		return err
+	}
+	if err := read(variablesURI("s1")); err == nil || !strings.Contains(err.Error(), "retry after 7200 s") {
+		t.Errorf("Expected reading variables to be refused, got: %v", err)
+	}
+	if err := read(sessionURIPrefix + "s1/files/data.csv"); err != nil {
+		t.Errorf("Expected reading files to pass, got: %v", err)
+	}
+
+	clock.t = clock.t.Add(2 * time.Hour)
+	if res := call("run_octave"); res.IsError {
+		t.Error("Expected the quota to reset at midnight UTC")
+	}
+}
+
+func TestQuotaKey(t *testing.T) {
+	var extra *mcp.RequestExtra
+	handler := remoteAddrMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extra = &mcp.RequestExtra{TokenInfo: auth.TokenInfoFromContext(r.Context()), Header: r.Header}
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set(remoteAddrHeader, "ip:198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if key := quotaKey(extra); key != "ip:192.0.2.1" {
+		t.Errorf("Expected unauthenticated HTTP callers to be charged by address, got %q", key)
+	}
+
+	extra.TokenInfo = &auth.TokenInfo{UserID: "apikey:ci"}
+	if key := quotaKey(extra); key != "apikey:ci" {
+		t.Errorf("Expected the principal to be charged, got %q", key)
+	}
+	if key := quotaKey(&mcp.RequestExtra{}); key != anonymousCaller {
+		t.Errorf("Expected stdio callers to be charged as %q, got %q", anonymousCaller, key)
+	}
+}
+
+func TestAuthFailureMiddleware(t *testing.T) {
+	t.Setenv("OCTAVE_MCP_AUTH_FAILURE_LIMIT", "")
+	if limiter := loadAuthFailureLimiter(slog.Default()); limiter == nil || limiter.burst != defaultAuthFailureLimit {
+		t.Errorf("Expected %d failures per minute by default, got %+v", defaultAuthFailureLimit, limiter)
+	}
+	t.Setenv("OCTAVE_MCP_AUTH_FAILURE_LIMIT", "0")
+	if loadAuthFailureLimiter(slog.Default()) != nil {
+		t.Error("Expected 0 to disable the limit")
+	}
+
+	limiter := newRateLimiter(0.1, 2)
+	handler := authFailureMiddleware(limiter, auth.RequireBearerToken(func(ctx context.Context, token string, req *http.Request) (*auth.TokenInfo, error) {
+		if token != "good" {
+			return nil, auth.ErrInvalidToken
+		}
+		return &auth.TokenInfo{UserID: "apikey:ci", Expiration: time.Now().Add(time.Hour)}, nil
+	}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})))
+	serve := func(remote, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for range 3 {
+		if code := serve("192.0.2.1:1234", "good"); code != http.StatusAccepted {
+			t.Fatalf("Expected successful authentications not to be limited, got %d", code)
+		}
+	}
+	for i := range 2 {
+		if code := serve("192.0.2.1:1234", "bad"); code != http.StatusUnauthorized {
+			t.Fatalf("Expected failure %d to be answered 401, got %d", i+1, code)
+		}
+	}
+	if code := serve("192.0.2.1:5678", "good"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the address to be refused before authentication, got %d", code)
+	}
+	if code := serve("192.0.2.2:1234", "bad"); code != http.StatusUnauthorized {
+		t.Errorf("Expected another address to keep its attempts, got %d", code)
+	}
+}
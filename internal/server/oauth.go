@@ -0,0 +1,526 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/oauthex"
+)
+
+const (
+	// oauthMetadataPath is the well-known path of the protected resource
+	// metadata (RFC 9728)
+	oauthMetadataPath = "/.well-known/oauth-protected-resource"
+
+	defaultJWKSCacheTTL = 5 * time.Minute
+	// jwksMinRefresh limits how often an unknown kid triggers a JWKS fetch
+	jwksMinRefresh   = 30 * time.Second
+	jwksFetchTimeout = 10 * time.Second
+	maxJWKSBytes     = 1 << 20
+	// jwtLeeway absorbs clock skew with the authorization server
+	jwtLeeway   = time.Minute
+	maxJWTBytes = 16 * 1024
+)
+
+// Scopes granted by the authorization server
+const (
+	scopeRun  = "octave:run"
+	scopePlot = "octave:plot"
+)
+
+// scopeTools maps each scope onto the tools it grants
+var scopeTools = map[string][]string{
+	scopeRun:  {"run_octave", "submit_octave_job", "get_job_status", "get_job_result", "cancel_job"},
+	scopePlot: {"generate_plot"},
+}
+
+// sharedTools are granted by any scope: they run no user code outside a
+// session or only read documentation
+var sharedTools = []string{
+	"check_octave_syntax", "octave_help", "octave_lookfor", "list_octave_packages",
+	"create_session", "close_session", "upload_file", "list_files", "download_file", "delete_file",
+}
+
+// toolsForScopes returns the tools granted by scopes, nil if none is known
+func toolsForScopes(scopes []string) []string {
+	var tools []string
+	for _, scope := range scopes {
+		tools = append(tools, scopeTools[scope]...)
+	}
+	if tools == nil {
+		return nil
+	}
+	return append(tools, sharedTools...)
+}
+
+// oauthConfig makes the HTTP transport an OAuth 2.0 protected resource that
+// accepts JWT access tokens issued by a single authorization server
+type oauthConfig struct {
+	// resource is the public URL of the MCP endpoint
+	resource string
+	issuer   string
+	audience string
+	jwks     *jwksCache
+}
+
+// loadOAuthConfig reads the OAuth settings from the environment. It returns
+// nil when OCTAVE_MCP_OAUTH_ISSUER is unset.
+func loadOAuthConfig(logger *slog.Logger) (*oauthConfig, error) {
+	issuer := os.Getenv("OCTAVE_MCP_OAUTH_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	resource := os.Getenv("OCTAVE_MCP_OAUTH_RESOURCE")
+	if u, err := url.Parse(resource); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("OCTAVE_MCP_OAUTH_RESOURCE must be the public URL of the MCP endpoint, got %q", resource)
+	}
+	jwksSource := os.Getenv("OCTAVE_MCP_OAUTH_JWKS")
+	if jwksSource == "" {
+		return nil, fmt.Errorf("OCTAVE_MCP_OAUTH_JWKS must name a JWKS file or URL")
+	}
+	audience := os.Getenv("OCTAVE_MCP_OAUTH_AUDIENCE")
+	if audience == "" {
+		audience = resource
+	}
+
+	// Configure JWKS cache lifetime (default: 300 seconds)
+	ttl := defaultJWKSCacheTTL
+	if ttlStr := os.Getenv("OCTAVE_MCP_OAUTH_JWKS_TTL"); ttlStr != "" {
+		if seconds, err := strconv.Atoi(ttlStr); err == nil && seconds > 0 {
+			ttl = time.Duration(seconds) * time.Second
+		} else {
+			logger.Warn("Invalid OCTAVE_MCP_OAUTH_JWKS_TTL, using default", "value", ttlStr)
+		}
+	}
+
+	return &oauthConfig{
+		resource: resource,
+		issuer:   issuer,
+		audience: audience,
+		jwks:     newJWKSCache(jwksSource, ttl, logger),
+	}, nil
+}
+
+// metadataPath is where the protected resource metadata of the endpoint is
+// served, the well-known path inserted before the endpoint path
+func (c *oauthConfig) metadataPath() string {
+	u, _ := url.Parse(c.resource)
+	return oauthMetadataPath + strings.TrimSuffix(u.Path, "/")
+}
+
+// metadataURL is the public URL of the protected resource metadata
+func (c *oauthConfig) metadataURL() string {
+	u, _ := url.Parse(c.resource)
+	u.Path, u.RawPath, u.RawQuery, u.Fragment = c.metadataPath(), "", "", ""
+	return u.String()
+}
+
+// metadataHandler serves the protected resource metadata document. Unlike
+// the handler of the SDK, it sets no CORS headers and leaves them to
+// securityMiddleware, so the metadata follows the origin policy of /mcp.
+func (c *oauthConfig) metadataHandler() http.Handler {
+	metadata := &oauthex.ProtectedResourceMetadata{
+		Resource:                          c.resource,
+		AuthorizationServers:              []string{c.issuer},
+		ScopesSupported:                   []string{scopeRun, scopePlot},
+		BearerMethodsSupported:            []string{"header"},
+		ResourceSigningAlgValuesSupported: []string{"RS256", "ES256"},
+		ResourceName:                      "octave-mcp",
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metadata)
+	})
+}
+
+// jwtHeader is the JOSE header of a JWT
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// audience is the aud claim, a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+// jwtClaims are the claims of an access token checked by the server
+type jwtClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	Expires   *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	// Scope is the space separated scope claim of RFC 9068, Scp the array
+	// some authorization servers use instead
+	Scope string   `json:"scope"`
+	Scp   []string `json:"scp"`
+}
+
+// verify checks a JWT access token: its RS256 or ES256 signature against the
+// JWKS, its issuer, audience and lifetime, and that it grants a known scope
+func (c *oauthConfig) verify(ctx context.Context, token string, req *http.Request) (*auth.TokenInfo, error) {
+	if len(token) > maxJWTBytes {
+		return nil, fmt.Errorf("%w: token too large", auth.ErrInvalidToken)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed JWT", auth.ErrInvalidToken)
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT header", auth.ErrInvalidToken)
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, fmt.Errorf("%w: unsupported JWT algorithm %q", auth.ErrInvalidToken, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT signature", auth.ErrInvalidToken)
+	}
+
+	keys, err := c.jwks.find(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !slices.ContainsFunc(keys, func(key crypto.PublicKey) bool {
+		return verifySignature(header.Alg, key, digest[:], signature)
+	}) {
+		return nil, fmt.Errorf("%w: invalid JWT signature", auth.ErrInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed JWT claims: %v", auth.ErrInvalidToken, err)
+	}
+	if claims.Issuer != c.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", auth.ErrInvalidToken, claims.Issuer)
+	}
+	if !slices.Contains(claims.Audience, c.audience) {
+		return nil, fmt.Errorf("%w: token is not meant for %s", auth.ErrInvalidToken, c.audience)
+	}
+	now := time.Now()
+	if claims.Expires == nil {
+		return nil, fmt.Errorf("%w: token has no expiration", auth.ErrInvalidToken)
+	}
+	expires := numericDate(*claims.Expires)
+	if now.After(expires.Add(jwtLeeway)) {
+		return nil, fmt.Errorf("%w: token expired", auth.ErrInvalidToken)
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(numericDate(*claims.NotBefore)) {
+		return nil, fmt.Errorf("%w: token not valid yet", auth.ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", auth.ErrInvalidToken)
+	}
+
+	scopes := append(strings.Fields(claims.Scope), claims.Scp...)
+	tools := toolsForScopes(scopes)
+	if tools == nil {
+		return nil, fmt.Errorf("%w: token grants neither %s nor %s", auth.ErrInvalidToken, scopeRun, scopePlot)
+	}
+	if expires.Before(now) {
+		// Within the leeway, which the caller does not apply
+		expires = now.Add(time.Second)
+	}
+	return &auth.TokenInfo{
+		Scopes:     scopes,
+		Expiration: expires,
+		UserID:     "oauth:" + claims.Subject,
+		Extra:      map[string]any{toolsExtra: tools},
+	}, nil
+}
+
+// decodeJWTPart decodes a base64url encoded JSON part of a JWT
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate converts a JWT NumericDate to a time
+func numericDate(seconds float64) time.Time {
+	return time.Unix(0, 0).Add(time.Duration(seconds * float64(time.Second)))
+}
+
+// verifySignature checks a JWS signature over digest with key
+func verifySignature(alg string, key crypto.PublicKey, digest, signature []byte) bool {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		// JWS encodes the signature as the fixed size r and s
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+// jwk is a signing key of the JWKS
+type jwk struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// jwksCache holds the keys of a JWKS loaded from a file or URL. Keys are
+// reloaded once they are older than the TTL, or when a token names a key
+// that is not known. Loads are attempted at most every minRefresh and run
+// without holding the lock, so a slow JWKS endpoint only delays the requests
+// that need the new keys.
+type jwksCache struct {
+	source     string
+	ttl        time.Duration
+	minRefresh time.Duration
+	client     *http.Client
+	logger     *slog.Logger
+
+	mu        sync.Mutex
+	keys      []jwk
+	fetched   time.Time
+	attempted time.Time
+	err       error
+	// loading is closed when the load in progress completes, nil when idle
+	loading chan struct{}
+}
+
+func newJWKSCache(source string, ttl time.Duration, logger *slog.Logger) *jwksCache {
+	return &jwksCache{
+		source:     source,
+		ttl:        ttl,
+		minRefresh: jwksMinRefresh,
+		client:     &http.Client{Timeout: jwksFetchTimeout},
+		logger:     logger,
+	}
+}
+
+// find returns the keys that may have signed a token with the given kid and
+// algorithm, every key of the algorithm when kid is empty
+func (c *jwksCache) find(ctx context.Context, kid, alg string) ([]crypto.PublicKey, error) {
+	c.mu.Lock()
+	cached := c.keys != nil
+	stale := time.Since(c.fetched) > c.ttl
+	c.mu.Unlock()
+	if !cached || stale {
+		// Stale keys keep being served while they reload
+		c.refresh(ctx, !cached)
+	}
+
+	keys, err := c.match(kid, alg)
+	if err == nil && len(keys) == 0 {
+		// The authorization server may have rotated its keys
+		c.refresh(ctx, true)
+		keys, err = c.match(kid, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no key for kid %q and algorithm %s", auth.ErrInvalidToken, kid, alg)
+	}
+	return keys, nil
+}
+
+// match returns the cached keys for kid and alg, or the load error while no
+// key was ever loaded
+func (c *jwksCache) match(kid, alg string) ([]crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys == nil {
+		if c.err == nil {
+			return nil, errors.New("failed to load JWKS: not loaded yet")
+		}
+		return nil, c.err
+	}
+	var keys []crypto.PublicKey
+	for _, k := range c.keys {
+		if (kid == "" || k.kid == kid) && k.alg == alg {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys, nil
+}
+
+// refresh starts reloading the keys, unless the last attempt is too recent,
+// and waits for the load in progress when wait is set. Concurrent callers
+// share a single load. On failure the previous keys stay in use.
+func (c *jwksCache) refresh(ctx context.Context, wait bool) {
+	c.mu.Lock()
+	done := c.loading
+	if done == nil {
+		if !c.attempted.IsZero() && time.Since(c.attempted) < c.minRefresh {
+			c.mu.Unlock()
+			return
+		}
+		c.attempted = time.Now()
+		done = make(chan struct{})
+		c.loading = done
+		go c.reload(ctx, done)
+	}
+	c.mu.Unlock()
+
+	if wait {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// reload loads the keys and closes done once they are stored
+func (c *jwksCache) reload(ctx context.Context, done chan struct{}) {
+	data, err := c.load(ctx)
+	var keys []jwk
+	if err == nil {
+		keys, err = parseJWKS(data)
+	}
+
+	c.mu.Lock()
+	if err == nil {
+		c.keys, c.fetched, c.err = keys, time.Now(), nil
+		c.logger.Debug("JWKS loaded", "source", c.source, "keys", len(keys))
+	} else {
+		c.err = fmt.Errorf("failed to load JWKS: %w", err)
+		c.logger.Warn("Could not load JWKS", "source", c.source, "error", err)
+	}
+	c.loading = nil
+	c.mu.Unlock()
+	close(done)
+}
+
+func (c *jwksCache) load(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(c.source, "https://") && !strings.HasPrefix(c.source, "http://") {
+		return os.ReadFile(c.source)
+	}
+
+	// Do not let a cancelled request abort a fetch other requests wait for
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+}
+
+// jwkJSON is a key of a JWKS document (RFC 7517)
+type jwkJSON struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the RSA and P-256 signing keys of a JWKS document,
+// skipping the keys of other types
+func parseJWKS(data []byte) ([]jwk, error) {
+	var doc struct {
+		Keys []jwkJSON `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := []jwk{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch {
+		case k.Kty == "RSA" && (k.Alg == "" || k.Alg == "RS256"):
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("invalid JWKS: malformed RSA key %q", k.Kid)
+			}
+			pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			if pub.N.BitLen() < 2048 {
+				return nil, fmt.Errorf("invalid JWKS: RSA key %q is shorter than 2048 bits", k.Kid)
+			}
+			keys = append(keys, jwk{kid: k.Kid, alg: "RS256", key: pub})
+		case k.Kty == "EC" && k.Crv == "P-256" && (k.Alg == "" || k.Alg == "ES256"):
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+				return nil, fmt.Errorf("invalid JWKS: malformed EC key %q", k.Kid)
+			}
+			pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+			if err != nil {
+				return nil, fmt.Errorf("invalid JWKS: EC key %q: %w", k.Kid, err)
+			}
+			keys = append(keys, jwk{kid: k.Kid, alg: "ES256", key: pub})
+		}
+	}
+	return keys, nil
+}
+
+// jwtOrAPIKey verifies tokens shaped like a JWT with jwt and others with
+// apiKey, so both kinds of credentials can be used side by side
+func jwtOrAPIKey(jwt, apiKey auth.TokenVerifier) auth.TokenVerifier {
+	return func(ctx context.Context, token string, req *http.Request) (*auth.TokenInfo, error) {
+		if strings.Count(token, ".") == 2 {
+			return jwt(ctx, token, req)
+		}
+		return apiKey(ctx, token, req)
+	}
+}
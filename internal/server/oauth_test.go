@@ -0,0 +1,512 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testResource = "https://octave.example.com/mcp"
+)
+
+// testSigner signs JWTs with a locally generated key
+type testSigner struct {
+	kid string
+	alg string
+	key crypto.Signer
+}
+
+func newRSASigner(t *testing.T, kid string) testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigner{kid: kid, alg: "RS256", key: key}
+}
+
+func newECSigner(t *testing.T, kid string) testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigner{kid: kid, alg: "ES256", key: key}
+}
+
+// jwk returns the public key of the signer as a JWKS entry
+func (s testSigner) jwk() map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{"kty": "RSA", "kid": s.kid, "use": "sig", "alg": "RS256",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PrivateKey:
+		point, err := key.PublicKey.Bytes()
+		if err != nil {
+			panic(err)
+		}
+		return map[string]string{"kty": "EC", "kid": s.kid, "crv": "P-256",
+			"x": b64(point[1:33]), "y": b64(point[33:])}
+	}
+	panic("unsupported key")
+}
+
+func (s testSigner) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "at+jwt"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch key := s.key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwksDocument(signers ...testSigner) []byte {
+	keys := []map[string]string{}
+	for _, s := range signers {
+		keys = append(keys, s.jwk())
+	}
+	data, _ := json.Marshal(map[string]any{"keys": keys})
+	return data
+}
+
+// jwksServer stands in for the JWKS endpoint of an authorization server
+type jwksServer struct {
+	*httptest.Server
+	document atomic.Value
+	fetches  atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, signers ...testSigner) *jwksServer {
+	s := &jwksServer{}
+	s.document.Store(jwksDocument(signers...))
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.document.Load().([]byte))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":   testIssuer,
+		"sub":   "alice",
+		"aud":   testResource,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"scope": "octave:run",
+	}
+}
+
+func testOAuthConfig(source string) *oauthConfig {
+	return &oauthConfig{
+		resource: testResource,
+		issuer:   testIssuer,
+		audience: testResource,
+		jwks:     newJWKSCache(source, time.Hour, slog.Default()),
+	}
+}
+
+func TestOAuth_Verify(t *testing.T) {
+	rsaSigner := newRSASigner(t, "rsa-1")
+	ecSigner := newECSigner(t, "ec-1")
+	jwks := newJWKSServer(t, rsaSigner, ecSigner)
+	config := testOAuthConfig(jwks.URL)
+	ctx := context.Background()
+
+	with := func(changes map[string]any) map[string]any {
+		claims := validClaims()
+		for name, value := range changes {
+			if value == nil {
+				delete(claims, name)
+			} else {
+				claims[name] = value
+			}
+		}
+		return claims
+	}
+
+	t.Run("Valid tokens", func(t *testing.T) {
+		for _, signer := range []testSigner{rsaSigner, ecSigner} {
+			info, err := config.verify(ctx, signer.sign(t, validClaims()), nil)
+			if err != nil {
+				t.Fatalf("%s: %v", signer.alg, err)
+			}
+			if info.UserID != "oauth:alice" {
+				t.Errorf("Expected principal oauth:alice, got %q", info.UserID)
+			}
+			tools := allowedTools(info)
+			if !slices.Contains(tools, "run_octave") || slices.Contains(tools, "generate_plot") {
+				t.Errorf("Expected octave:run to grant run_octave only, got %v", tools)
+			}
+		}
+	})
+
+	t.Run("Scopes map onto tools", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			claims  map[string]any
+			allowed []string
+			denied  []string
+		}{
+			{name: "plot", claims: with(map[string]any{"scope": "octave:plot"}), allowed: []string{"generate_plot", "octave_help"}, denied: []string{"run_octave", "submit_octave_job"}},
+			{name: "both", claims: with(map[string]any{"scope": "openid octave:run octave:plot"}), allowed: []string{"generate_plot", "run_octave"}},
+			{name: "scp array", claims: with(map[string]any{"scope": nil, "scp": []string{"octave:plot"}}), allowed: []string{"generate_plot"}, denied: []string{"run_octave"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				info, err := config.verify(ctx, rsaSigner.sign(t, tt.claims), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tools := allowedTools(info)
+				for _, tool := range tt.allowed {
+					if !slices.Contains(tools, tool) {
+						t.Errorf("Expected %s to be allowed, got %v", tool, tools)
+					}
+				}
+				for _, tool := range tt.denied {
+					if slices.Contains(tools, tool) {
+						t.Errorf("Expected %s to be denied, got %v", tool, tools)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("Invalid tokens", func(t *testing.T) {
+		other := newRSASigner(t, "rsa-1")
+		valid := rsaSigner.sign(t, validClaims())
+		parts := strings.Split(valid, ".")
+		none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+		hs256 := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"rsa-1"}`)) + "." + parts[1] + "." + parts[2]
+
+		tests := []struct {
+			name   string
+			token  string
+			errMsg string
+		}{
+			{name: "wrong audience", token: rsaSigner.sign(t, with(map[string]any{"aud": "https://other.example.com"})), errMsg: "not meant for"},
+			{name: "audience array", token: rsaSigner.sign(t, with(map[string]any{"aud": []string{"a", "b"}})), errMsg: "not meant for"},
+			{name: "wrong issuer", token: rsaSigner.sign(t, with(map[string]any{"iss": "https://evil.example.com"})), errMsg: "unexpected issuer"},
+			{name: "expired", token: rsaSigner.sign(t, with(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), errMsg: "expired"},
+			{name: "no expiration", token: rsaSigner.sign(t, with(map[string]any{"exp": nil})), errMsg: "no expiration"},
+			{name: "not yet valid", token: rsaSigner.sign(t, with(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})), errMsg: "not valid yet"},
+			{name: "no subject", token: rsaSigner.sign(t, with(map[string]any{"sub": nil})), errMsg: "no subject"},
+			{name: "no octave scope", token: rsaSigner.sign(t, with(map[string]any{"scope": "openid profile"})), errMsg: "grants neither"},
+			{name: "signed by another key", token: other.sign(t, validClaims()), errMsg: "invalid JWT signature"},
+			{name: "tampered claims", token: parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"root"}`)) + "." + parts[2], errMsg: "invalid JWT signature"},
+			{name: "alg none", token: none, errMsg: "unsupported JWT algorithm"},
+			{name: "alg HS256", token: hs256, errMsg: "unsupported JWT algorithm"},
+			{name: "unknown kid", token: newECSigner(t, "ec-9").sign(t, validClaims()), errMsg: `no key for kid "ec-9"`},
+			{name: "not a JWT", token: "abc", errMsg: "malformed JWT"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := config.verify(ctx, tt.token, nil)
+				if !errors.Is(err, auth.ErrInvalidToken) || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected invalid token error containing %q, got: %v", tt.errMsg, err)
+				}
+			})
+		}
+	})
+}
+
+func TestJWKSCache(t *testing.T) {
+	first := newRSASigner(t, "first")
+	second := newECSigner(t, "second")
+	jwks := newJWKSServer(t, first)
+	config := testOAuthConfig(jwks.URL)
+	ctx := context.Background()
+
+	t.Run("Caches keys", func(t *testing.T) {
+		for range 3 {
+			if _, err := config.verify(ctx, first.sign(t, validClaims()), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := jwks.fetches.Load(); n != 1 {
+			t.Errorf("Expected 1 JWKS fetch, got %d", n)
+		}
+	})
+
+	t.Run("Unknown kid waits for the minimum refresh interval", func(t *testing.T) {
+		jwks.document.Store(jwksDocument(first, second))
+		if _, err := config.verify(ctx, second.sign(t, validClaims()), nil); err == nil {
+			t.Error("Expected the rotated key to be unknown within the minimum refresh interval")
+		}
+		if n := jwks.fetches.Load(); n != 1 {
+			t.Errorf("Expected no new JWKS fetch, got %d fetches", n)
+		}
+	})
+
+	t.Run("Unknown kid triggers a refresh", func(t *testing.T) {
+		config.jwks.minRefresh = 0
+		if _, err := config.verify(ctx, second.sign(t, validClaims()), nil); err != nil {
+			t.Fatal(err)
+		}
+		if n := jwks.fetches.Load(); n != 2 {
+			t.Errorf("Expected 2 JWKS fetches, got %d", n)
+		}
+	})
+
+	t.Run("Keeps keys when the JWKS is unavailable", func(t *testing.T) {
+		jwks.document.Store([]byte(`not json`))
+		config.jwks.ttl = 0
+		if _, err := config.verify(ctx, first.sign(t, validClaims()), nil); err != nil {
+			t.Errorf("Expected cached keys to be used, got %v", err)
+		}
+	})
+
+	t.Run("File source", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		if err := os.WriteFile(path, jwksDocument(second), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fileConfig := testOAuthConfig(path)
+		if _, err := fileConfig.verify(ctx, second.sign(t, validClaims()), nil); err != nil {
+			t.Fatal(err)
+		}
+		missing := testOAuthConfig(filepath.Join(t.TempDir(), "missing.json"))
+		if _, err := missing.verify(ctx, second.sign(t, validClaims()), nil); err == nil || errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("Expected a JWKS load error, got %v", err)
+		}
+	})
+}
+
+func TestJWKSCache_SlowRefresh(t *testing.T) {
+	first := newRSASigner(t, "first")
+	second := newECSigner(t, "second")
+	var document atomic.Value
+	document.Store(jwksDocument(first))
+	release := make(chan struct{})
+	var blocked atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blocked.Load() {
+			<-release
+		}
+		w.Write(document.Load().([]byte))
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	config := testOAuthConfig(server.URL)
+	ctx := context.Background()
+	if _, err := config.verify(ctx, first.sign(t, validClaims()), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the refresh of the stale keys at the endpoint
+	blocked.Store(true)
+	document.Store(jwksDocument(first, second))
+	config.jwks.ttl = 0
+	config.jwks.minRefresh = 0
+	verified := make(chan error, 1)
+	go func() {
+		_, err := config.verify(ctx, first.sign(t, validClaims()), nil)
+		verified <- err
+	}()
+	select {
+	case err := <-verified:
+		if err != nil {
+			t.Errorf("Expected the cached key to be served during the refresh, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the cached key to be served without waiting for the refresh")
+	}
+
+	// A token signed by an unknown key waits for the refresh
+	rotated := make(chan error, 1)
+	go func() {
+		_, err := config.verify(ctx, second.sign(t, validClaims()), nil)
+		rotated <- err
+	}()
+	select {
+	case err := <-rotated:
+		t.Fatalf("Expected the unknown key to wait for the refresh, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	blocked.Store(false)
+	release <- struct{}{}
+	if err := <-rotated; err != nil {
+		t.Errorf("Expected the rotated key once loaded, got %v", err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseJWKS(jwksDocument(testSigner{kid: "small", alg: "RS256", key: small})); err == nil || !strings.Contains(err.Error(), "shorter than 2048 bits") {
+		t.Errorf("Expected short RSA keys to be refused, got %v", err)
+	}
+
+	keys, err := parseJWKS([]byte(`{"keys": [
+		{"kty": "oct", "k": "c2VjcmV0"},
+		{"kty": "EC", "crv": "P-384", "x": "AA", "y": "AA"},
+		{"kty": "RSA", "use": "enc", "n": "AA", "e": "AQAB"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("Expected unsupported keys to be skipped, got %d keys", len(keys))
+	}
+
+	if _, err := parseJWKS([]byte(`{"keys": [{"kty": "EC", "crv": "P-256", "x": "` +
+		strings.Repeat("A", 43) + `", "y": "` + strings.Repeat("A", 43) + `"}]}`)); err == nil {
+		t.Error("Expected a point off the curve to be refused")
+	}
+}
+
+func TestOAuth_Metadata(t *testing.T) {
+	config := testOAuthConfig("unused")
+	if got := config.metadataURL(); got != "https://octave.example.com/.well-known/oauth-protected-resource/mcp" {
+		t.Errorf("Unexpected metadata URL %s", got)
+	}
+
+	rec := httptest.NewRecorder()
+	config.metadataHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, config.metadataPath(), nil))
+	var metadata struct {
+		Resource             string   `json:"resource"`
+		AuthorizationServers []string `json:"authorization_servers"`
+		ScopesSupported      []string `json:"scopes_supported"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &metadata); err != nil {
+		t.Fatalf("%v: %s", err, rec.Body)
+	}
+	if metadata.Resource != testResource || !slices.Equal(metadata.AuthorizationServers, []string{testIssuer}) ||
+		!slices.Equal(metadata.ScopesSupported, []string{scopeRun, scopePlot}) {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+
+	t.Setenv("OCTAVE_MCP_ALLOWED_ORIGINS", "https://tools.corp.example")
+	handler := securityMiddleware(loadOriginPolicy(slog.Default()), config.metadataHandler())
+	serve := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, config.metadataPath(), nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = serve(http.MethodGet, "https://tools.corp.example")
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "https://tools.corp.example" {
+		t.Errorf("Expected the allowed origin to be echoed, got %d %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if rec := serve(http.MethodGet, "https://evil.example"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected other origins to be refused like on /mcp, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "https://tools.corp.example"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST to be refused, got %d", rec.Code)
+	}
+}
+
+func TestOAuth_Middleware(t *testing.T) {
+	signer := newECSigner(t, "ec-1")
+	jwks := newJWKSServer(t, signer)
+	config := testOAuthConfig(jwks.URL)
+	keys, err := parseAPIKeys([]byte(`{"keys": [{"label": "ci", "sha256": "` + sha256Hex("ci-key") + `"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	server.AddReceivingMiddleware(authorizeTools)
+	for _, name := range []string{"run_octave", "generate_plot"} {
+		mcp.AddTool(server, &mcp.Tool{Name: name}, func(ctx context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: principal(req.Extra.TokenInfo)}}}, nil, nil
+		})
+	}
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil)
+	opts := &auth.RequireBearerTokenOptions{ResourceMetadataURL: config.metadataURL()}
+	ts := httptest.NewServer(authMiddleware(jwtOrAPIKey(config.verify, keys.verify), opts, handler))
+	defer ts.Close()
+
+	t.Run("Challenge points at the metadata", func(t *testing.T) {
+		resp, err := http.Post(ts.URL, "application/json", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", resp.StatusCode)
+		}
+		if challenge := resp.Header.Get("WWW-Authenticate"); !strings.Contains(challenge, config.metadataURL()) {
+			t.Errorf("Expected the challenge to name the metadata URL, got %q", challenge)
+		}
+	})
+
+	call := func(t *testing.T, token, tool string) (string, bool) {
+		t.Helper()
+		client := mcp.NewClient(&mcp.Implementation{Name: "client", Version: "1.0.0"}, nil)
+		session, err := client.Connect(context.Background(), &mcp.StreamableClientTransport{
+			Endpoint:   ts.URL,
+			HTTPClient: &http.Client{Transport: headerTransport{header: http.Header{"Authorization": {"Bearer " + token}}}},
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer session.Close()
+		res, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: tool})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Content[0].(*mcp.TextContent).Text, res.IsError
+	}
+
+	claims := validClaims()
+	claims["scope"] = "octave:plot"
+	token := signer.sign(t, claims)
+	if text, isError := call(t, token, "generate_plot"); isError || text != "oauth:alice" {
+		t.Errorf("Expected generate_plot to run as oauth:alice, got %q", text)
+	}
+	if text, isError := call(t, token, "run_octave"); !isError || !strings.Contains(text, "not allowed to call run_octave") {
+		t.Errorf("Expected run_octave to be refused without octave:run, got %q", text)
+	}
+	if text, isError := call(t, "ci-key", "run_octave"); isError || text != "apikey:ci" {
+		t.Errorf("Expected API keys to keep working, got %q", text)
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/fmcato/octave-mcp/internal/domain"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Session workspaces are published as resources:
+//
+//	octave://session/<id>/files/<name>  a file of the workspace
+//	octave://session/<id>/variables     a JSON snapshot of the variables
+//
+// Resources are registered on the MCP server as files appear and disappear,
+// which notifies clients that the list changed. Every client only lists and
+// reads the resources of its own session.
+const (
+	sessionURIPrefix     = "octave://session/"
+	fileURITemplate      = "octave://session/{session_id}/files/{name}"
+	variablesURITemplate = "octave://session/{session_id}/variables"
+)
+
+// publishedFiles tracks the workspace files registered as resources, by
+// session and name, to tell which ones changed
+type publishedFiles struct {
+	mu    sync.Mutex
+	files map[string]map[string]domain.FileInfo
+}
+
+// variablesURI names the variables snapshot of a session
+func variablesURI(sessionID string) string {
+	return fmt.Sprintf("octave://session/%s/variables", sessionID)
+}
+
+// parseSessionURI splits a session resource URI into the session ID and the
+// file name, empty for the variables snapshot
+func parseSessionURI(uri string) (sessionID, name string, ok bool) {
+	rest, found := strings.CutPrefix(uri, sessionURIPrefix)
+	if !found {
+		return "", "", false
+	}
+	sessionID, rest, found = strings.Cut(rest, "/")
+	if !found || sessionID == "" {
+		return "", "", false
+	}
+	if rest == "variables" {
+		return sessionID, "", true
+	}
+	name, found = strings.CutPrefix(rest, "files/")
+	if !found || name == "" || strings.Contains(name, "/") {
+		return "", "", false
+	}
+	return sessionID, name, true
+}
+
+// registerResources adds the resource templates and the hooks that keep the
+// resources in sync with the sessions
+func (s *Server) registerResources() {
+	s.mcpServer.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "session_file",
+		URITemplate: fileURITemplate,
+		Description: "A file in the workspace of a session: uploaded with upload_file or written by a script, such as saved data or plots.",
+	}, s.readResource)
+	s.mcpServer.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "session_variables",
+		URITemplate: variablesURITemplate,
+		Description: "A JSON snapshot of the variables of a session with their class, size and, for small ones, value.",
+		MIMEType:    "application/json",
+	}, s.readResource)
+
+	s.mcpServer.AddReceivingMiddleware(s.filterResources)
+	s.runner.OnSessionClosed(s.unpublishSession)
+}
+
+// filterResources drops the resources of other sessions from resources/list
+func (s *Server) filterResources(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		result, err := next(ctx, method, req)
+		list, ok := result.(*mcp.ListResourcesResult)
+		if err != nil || !ok {
+			return result, err
+		}
+		ss, _ := req.GetSession().(*mcp.ServerSession)
+		prefix := sessionURIPrefix + sessionKeyOf(ss) + "/"
+		owned := make([]*mcp.Resource, 0, len(list.Resources))
+		for _, r := range list.Resources {
+			if strings.HasPrefix(r.URI, prefix) {
+				owned = append(owned, r)
+			}
+		}
+		list.Resources = owned
+		return list, nil
+	}
+}
+
+// ownedSession returns the session a resource URI belongs to, provided it is
+// the session of the caller
+func (s *Server) ownedSession(ss *mcp.ServerSession, uri string) (sessionID, name string, err error) {
+	sessionID, name, ok := parseSessionURI(uri)
+	if !ok || sessionID != sessionKeyOf(ss) || !s.runner.HasSession(sessionID) {
+		// Do not tell other sessions apart from missing ones
+		return "", "", mcp.ResourceNotFoundError(uri)
+	}
+	return sessionID, name, nil
+}
+
+func (s *Server) readResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	sessionID, name, err := s.ownedSession(req.Session, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		vars, err := s.runner.Variables(ctx, domain.ExecOptions{
+			SessionID: sessionID,
+			OnUsage:   s.usageMeter(req.Extra),
+			CPUBudget: s.cpuBudget(req.Extra),
+		})
+		if err != nil {
+			return nil, err
+		}
+		text, err := json.Marshal(map[string]any{"variables": vars})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode variables: %w", err)
+		}
+		return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{
+			{URI: uri, MIMEType: "application/json", Text: string(text)},
+		}}, nil
+	}
+
+	data, err := s.runner.ReadFile(sessionID, name)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{fileContents(sessionID, name, data)}}, nil
+}
+
+// subscribeHandler only lets clients subscribe to resources of their session
+func (s *Server) subscribeHandler(ctx context.Context, req *mcp.SubscribeRequest) error {
+	_, _, err := s.ownedSession(req.Session, req.Params.URI)
+	return err
+}
+
+func (s *Server) unsubscribeHandler(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+	return nil
+}
+
+// publishSession registers the resources of a new session
+func (s *Server) publishSession(ctx context.Context, sessionID string) {
+	s.mcpServer.AddResource(&mcp.Resource{
+		Name:        "variables",
+		URI:         variablesURI(sessionID),
+		Description: "Snapshot of the session variables",
+		MIMEType:    "application/json",
+	}, s.readResource)
+	s.syncResources(ctx, sessionID)
+}
+
+// syncResources registers the files of a session workspace that appeared,
+// drops the ones that disappeared, and notifies subscribers of the ones that
+// changed and of the variables. It returns the files that are new or changed.
+func (s *Server) syncResources(ctx context.Context, sessionID string) []domain.FileInfo {
+	files, _, err := s.runner.ListFiles(sessionID)
+	if err != nil {
+		slog.Debug("Could not list session files", "session_id", sessionID, "error", err)
+		return nil
+	}
+
+	s.published.mu.Lock()
+	if s.published.files == nil {
+		s.published.files = make(map[string]map[string]domain.FileInfo)
+	}
+	previous := s.published.files[sessionID]
+	current := make(map[string]domain.FileInfo, len(files))
+	var changed []domain.FileInfo
+	for _, f := range files {
+		current[f.Name] = f
+		if old, ok := previous[f.Name]; !ok || old.Size != f.Size || !old.Modified.Equal(f.Modified) {
+			changed = append(changed, f)
+		}
+	}
+	var removed []string
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			removed = append(removed, fileURI(sessionID, name))
+		}
+	}
+	s.published.files[sessionID] = current
+	s.published.mu.Unlock()
+
+	for _, f := range changed {
+		s.mcpServer.AddResource(&mcp.Resource{
+			Name:     f.Name,
+			URI:      fileURI(sessionID, f.Name),
+			MIMEType: fileMIMEType(f.Name),
+			Size:     f.Size,
+		}, s.readResource)
+		s.mcpServer.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: fileURI(sessionID, f.Name)})
+	}
+	if len(removed) > 0 {
+		s.mcpServer.RemoveResources(removed...)
+	}
+	s.mcpServer.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: variablesURI(sessionID)})
+	return changed
+}
+
+// unpublishSession drops the resources of a session that ended
+func (s *Server) unpublishSession(sessionID string) {
+	s.published.mu.Lock()
+	uris := []string{variablesURI(sessionID)}
+	for name := range s.published.files[sessionID] {
+		uris = append(uris, fileURI(sessionID, name))
+	}
+	delete(s.published.files, sessionID)
+	s.published.mu.Unlock()
+	s.mcpServer.RemoveResources(uris...)
+}
+
+// fileLinks returns links to the given workspace files, so clients can fetch
+// them lazily instead of receiving them inline
+func fileLinks(sessionID string, files []domain.FileInfo) []mcp.Content {
+	links := make([]mcp.Content, 0, len(files))
+	for _, f := range files {
+		size := f.Size
+		links = append(links, &mcp.ResourceLink{
+			URI:      fileURI(sessionID, f.Name),
+			Name:     f.Name,
+			MIMEType: fileMIMEType(f.Name),
+			Size:     &size,
+		})
+	}
+	return links
+}
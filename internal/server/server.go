@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,40 +12,76 @@ import (
 
 	"github.com/fmcato/octave-mcp/internal/domain"
 	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/auth"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 type RunOctaveParams struct {
-	Script string `json:"script" description:"A GNU Octave script that should produce a result."`
+	Script     string   `json:"script" description:"A GNU Octave script that should produce a result."`
+	SessionID  string   `json:"session_id,omitempty" description:"Optional session returned by create_session. Variables persist across calls in the same session."`
+	ReturnVars []string `json:"return_vars,omitempty" description:"Optional names of workspace variables to return as structured JSON once the script finishes."`
+	Packages   []string `json:"packages,omitempty" description:"Optional Octave packages to load before the script runs. Only packages allowed by the server policy can be loaded, see list_octave_packages."`
 }
 
 type GeneratePlotParams struct {
-	Script string `json:"script" description:"A GNU Octave script that calls plot() to produce a graph"`
-	Format string `json:"format" description:"Image output format. Supported: svg or png"` // "png" or "svg"
+	Script     string   `json:"script" description:"A GNU Octave script that calls plot() to produce a graph"`
+	Format     string   `json:"format" description:"Image output format. Supported: svg, png, jpg, pdf, eps, gif for an animation with one frame per drawnow, or vegalite and plotly for a JSON chart spec"`
+	SessionID  string   `json:"session_id,omitempty" description:"Optional session returned by create_session. The script can use variables defined earlier in the session."`
+	Width      int      `json:"width,omitempty" description:"Optional image width in pixels, 100 to 4000. Requires height."`
+	Height     int      `json:"height,omitempty" description:"Optional image height in pixels, 100 to 4000. Requires width."`
+	DPI        int      `json:"dpi,omitempty" description:"Optional resolution in dots per inch, 50 to 600"`
+	FontSize   int      `json:"font_size,omitempty" description:"Optional font size in points for every text of the figure, 6 to 48"`
+	Theme      string   `json:"theme,omitempty" description:"Optional color theme: light (default) or dark"`
+	FrameDelay int      `json:"frame_delay,omitempty" description:"Optional time each frame of a gif animation is shown in milliseconds, 20 to 5000 (default 100)"`
+	Packages   []string `json:"packages,omitempty" description:"Optional Octave packages to load before the script runs. Only packages allowed by the server policy can be loaded, see list_octave_packages."`
+}
+
+type CreateSessionParams struct{}
+
+type CloseSessionParams struct {
+	SessionID string `json:"session_id" description:"The session returned by create_session"`
 }
 
 type Server struct {
 	mcpServer *mcp.Server
 	runner    *domain.Runner
+	jobs      *domain.JobQueue
 	version   string
+	// published holds the workspace files registered as resources
+	published publishedFiles
+	// quota is the daily CPU quota per principal, nil when unlimited
+	quota *cpuQuota
 }
 
 func New() *Server {
 	runner := domain.NewRunner()
-	return &Server{
+	s := &Server{
 		runner:  runner,
+		jobs:    domain.NewJobQueue(runner, slog.Default()),
 		version: runner.GetVersion(),
-		mcpServer: mcp.NewServer(&mcp.Implementation{
-			Name:    "octave-mcp",
-			Version: "1.0.0",
-		}, nil),
+		quota:   loadCPUQuota(slog.Default()),
 	}
+	s.mcpServer = mcp.NewServer(&mcp.Implementation{
+		Name:    "octave-mcp",
+		Version: "1.0.0",
+	}, &mcp.ServerOptions{
+		SubscribeHandler:   s.subscribeHandler,
+		UnsubscribeHandler: s.unsubscribeHandler,
+	})
+	return s
 }
 
 func (s *Server) RegisterHandlers() {
+	s.mcpServer.AddReceivingMiddleware(authorizeTools)
+	if s.quota != nil {
+		slog.Info("Daily CPU quota enabled", "limit", s.quota.limit)
+		s.mcpServer.AddReceivingMiddleware(s.quota.enforce)
+	}
+	s.registerResources()
+
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "run_octave",
-		Description: fmt.Sprintf("Executes a GNU Octave script and returns the standad output. For scientific computing and numerical calculations. Version %s.", s.version),
+		Description: fmt.Sprintf("Executes a GNU Octave script and returns the standad output. For scientific computing and numerical calculations. Use return_vars to get workspace variables back as structured JSON instead of parsing printed output. Use packages to load Octave packages the server allows, see list_octave_packages. In a session, files the script writes to the workspace are returned as resource links. Version %s.", s.version),
 		Annotations: &mcp.ToolAnnotations{
 			ReadOnlyHint: true,
 		},
@@ -52,11 +89,119 @@ func (s *Server) RegisterHandlers() {
 
 	mcp.AddTool(s.mcpServer, &mcp.Tool{
 		Name:        "generate_plot",
-		Description: fmt.Sprintf("Generate a plot from a GNU Octave script. Returns image data in specified format (png/svg). Use the plot() command and any other one for labels, legend, etc. Do not try to set graphics toolkit or other format options. Version %s.", s.version),
+		Description: fmt.Sprintf("Generate a plot from a GNU Octave script. Returns one image per open figure, in figure order, in the specified format (png/svg, or jpg/pdf/eps as embedded resources), preceded by the axes titles of each figure when set. Format gif is animate mode: every drawnow call captures a frame of the current figure and the frames are returned as one animated GIF, frame_delay sets the time per frame in milliseconds. Formats vegalite and plotly return a JSON chart spec per figure instead of an image, converted from its lines, scatters, bars, histograms and surfaces with titles, labels, legends and log axes, and list what could not be converted as warnings. Set extract_data to also get the XData/YData/ZData, labels, legend entries and axis limits of each figure as structured JSON, large series are sampled. Optional width and height (100-4000 pixels, set both), dpi (50-600), font_size (6-48 points) and theme (light or dark) control the image. Use packages to load Octave packages the server allows. Use the plot() command and any other one for labels, legend, etc. Do not try to set graphics toolkit or other format options. Version %s.", s.version),
 	}, s.generatePlotHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "check_octave_syntax",
+		Description: fmt.Sprintf("Check whether a GNU Octave script parses, without running it. Returns the syntax errors with their line and column, and every call the security policy of the target tool (run_octave by default, or generate_plot) would reject, so both can be fixed in one round trip. Version %s.", s.version),
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	}, s.checkSyntaxHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "octave_help",
+		Description: fmt.Sprintf("Return the help text of a GNU Octave function as documented by the installed Octave %s. Use it to check signatures before calling a function. Says when the function does not exist in Octave, e.g. MATLAB-only functions, or comes from an installed package that is not loaded.", s.version),
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	}, s.helpHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "octave_lookfor",
+		Description: fmt.Sprintf("Search the help of every function available in the installed GNU Octave %s for a keyword and return the matching function names with the first sentence of their help.", s.version),
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	}, s.lookforHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_octave_packages",
+		Description: fmt.Sprintf("List the Octave packages installed for GNU Octave %s with their versions, and whether the server policy allows loading them. Pass allowed packages in the packages argument of run_octave, generate_plot or submit_octave_job, or call pkg load in the script.", s.version),
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	}, s.listPackagesHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "create_session",
+		Description: "Start a persistent GNU Octave session for this connection and return its session_id. Pass the session_id to run_octave or generate_plot to keep variables between calls. The session has a file workspace, its working directory, managed with upload_file, list_files, download_file and delete_file. Scripts in the session can read and write files there with load, save, fopen and the like, given a literal file name. Its files and a JSON snapshot of its variables are published as resources under octave://session/<session_id>/. Idle sessions are closed automatically.",
+	}, s.createSessionHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "close_session",
+		Description: "Close a persistent GNU Octave session and discard its workspace.",
+		Annotations: &mcp.ToolAnnotations{
+			IdempotentHint: true,
+		},
+	}, s.closeSessionHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "upload_file",
+		Description: "Store a file, e.g. a CSV or a .mat file, in the workspace of a session started with create_session. Scripts run in the session find it in their working directory and can read it with load, csvread, fopen and the like. Binary files are sent with encoding base64. Workspaces are flat, cannot hold .m files, and have a quota on file count and total size.",
+	}, s.uploadFileHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "list_files",
+		Description: "List the files in the workspace of a session with their size, and the space used against the workspace quota.",
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	}, s.listFilesHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "download_file",
+		Description: "Return a file from the workspace of a session, such as one a script wrote with save or csvwrite, as an embedded resource. Text files are returned as text, other files base64 encoded.",
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	}, s.downloadFileHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "delete_file",
+		Description: "Delete a file from the workspace of a session to free quota.",
+	}, s.deleteFileHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "submit_octave_job",
+		Description: fmt.Sprintf("Submit a long-running GNU Octave script as a background job and return its job_id right away. Use kind \"run\" (default) to get the printed output and return_vars, or \"plot\" with a generate_plot format and its size and style options to render a plot. Jobs run in a fresh workspace with a timeout of %s. Poll get_job_status, then fetch the outcome with get_job_result. Version %s.", s.jobs.Timeout(), s.version),
+	}, s.submitJobHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_job_status",
+		Description: "Return the status of a job submitted with submit_octave_job: queued, running, succeeded, failed or cancelled.",
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	}, s.jobStatusHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "get_job_result",
+		Description: "Return the outcome of a finished job: the script output and return_vars for run jobs, the image for plot jobs. Results are kept for a limited time after the job finishes.",
+		Annotations: &mcp.ToolAnnotations{
+			ReadOnlyHint: true,
+		},
+	}, s.jobResultHandler)
+
+	mcp.AddTool(s.mcpServer, &mcp.Tool{
+		Name:        "cancel_job",
+		Description: "Cancel a queued or running job. Cancelling a finished job has no effect.",
+		Annotations: &mcp.ToolAnnotations{
+			IdempotentHint: true,
+		},
+	}, s.cancelJobHandler)
 }
 
-func (s *Server) RunHTTP(addr string) error {
+// Close releases the resources held by the server
+func (s *Server) Close() {
+	s.jobs.Shutdown()
+	s.runner.Close()
+}
+
+// RunHTTP serves MCP over streamable HTTP on addr, over TLS when tlsFiles is
+// enabled
+func (s *Server) RunHTTP(addr string, tlsFiles TLSConfig) error {
 	// Allow non-localhost binding if explicitly enabled
 	if !strings.Contains(addr, "localhost") && !strings.Contains(addr, "127.0.0.1") {
 		if strings.ToLower(os.Getenv("OCTAVE_MCP_ALLOW_NON_LOCALHOST")) != "true" {
@@ -64,13 +209,92 @@ func (s *Server) RunHTTP(addr string) error {
 		}
 	}
 
-	handler := mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
+	var handler http.Handler = mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
 		return s.mcpServer
 	}, &mcp.StreamableHTTPOptions{})
+	handler = remoteAddrMiddleware(handler)
+
+	// Rate limit after authentication so clients are told apart by principal,
+	// failed authentications are limited per address below
+	if limiter := loadRateLimiter(slog.Default()); limiter != nil {
+		slog.Info("Rate limiting enabled", "per_minute", limiter.rate*60, "burst", limiter.burst)
+		handler = rateLimitMiddleware(limiter, handler)
+	}
 
-	slog.Info("Starting HTTP server", "addr", addr)
-	http.Handle("/mcp", loggingMiddleware(securityMiddleware(handler)))
-	return http.ListenAndServe(addr, nil)
+	// Configure API key authentication (default: none)
+	var keys *apiKeys
+	if keysFile := os.Getenv("OCTAVE_MCP_API_KEYS_FILE"); keysFile != "" {
+		var err error
+		if keys, err = loadAPIKeys(keysFile); err != nil {
+			return err
+		}
+		slog.Info("API key authentication enabled", "keys", len(keys.Keys))
+	}
+
+	// Configure OAuth resource server mode (default: off)
+	oauth, err := loadOAuthConfig(slog.Default())
+	if err != nil {
+		return err
+	}
+
+	var certs *certReloader
+	if tlsFiles.Enabled() {
+		if certs, err = newCertReloader(tlsFiles, slog.Default()); err != nil {
+			return err
+		}
+	}
+	mutualTLS := certs != nil && tlsFiles.ClientCAFile != ""
+
+	origins := loadOriginPolicy(slog.Default())
+	var tokenAuth http.Handler
+	switch {
+	case oauth != nil:
+		verifier := oauth.verify
+		if keys != nil {
+			verifier = jwtOrAPIKey(oauth.verify, keys.verify)
+		}
+		// Serve the metadata at the path of the endpoint and at the root, for
+		// clients that do not insert the endpoint path
+		metadataURL := oauth.metadataURL()
+		metadata := loggingMiddleware(securityMiddleware(origins, oauth.metadataHandler()))
+		http.Handle(oauth.metadataPath(), metadata)
+		if oauth.metadataPath() != oauthMetadataPath {
+			http.Handle(oauthMetadataPath, metadata)
+		}
+		slog.Info("OAuth authentication enabled", "issuer", oauth.issuer, "audience", oauth.audience, "metadata", metadataURL)
+		tokenAuth = authMiddleware(verifier, &auth.RequireBearerTokenOptions{ResourceMetadataURL: metadataURL}, handler)
+	case keys != nil:
+		tokenAuth = authMiddleware(keys.verify, nil, handler)
+	}
+	switch {
+	case mutualTLS:
+		// The certificate identifies callers that send no key or token
+		slog.Info("Client certificate authentication enabled", "ca", tlsFiles.ClientCAFile)
+		handler = clientCertMiddleware(tokenAuth, handler)
+	case tokenAuth != nil:
+		handler = tokenAuth
+	default:
+		slog.Warn("HTTP server runs without authentication, set OCTAVE_MCP_API_KEYS_FILE or OCTAVE_MCP_OAUTH_ISSUER to require it")
+	}
+
+	// Limit failed authentications before credentials are checked, where
+	// clients can only be told apart by address
+	if oauth != nil || keys != nil || mutualTLS {
+		if limiter := loadAuthFailureLimiter(slog.Default()); limiter != nil {
+			handler = authFailureMiddleware(limiter, handler)
+		}
+	}
+
+	http.Handle("/mcp", loggingMiddleware(securityMiddleware(origins, handler)))
+	if certs == nil {
+		slog.Info("Starting HTTP server", "addr", addr)
+		return http.ListenAndServe(addr, nil)
+	}
+
+	go certs.watch(context.Background())
+	server := &http.Server{Addr: addr, TLSConfig: certs.tlsConfig()}
+	slog.Info("Starting HTTPS server", "addr", addr, "mutual_tls", mutualTLS)
+	return server.ListenAndServeTLS("", "")
 }
 
 func (s *Server) RunStdio() error {
@@ -80,32 +304,252 @@ func (s *Server) RunStdio() error {
 }
 
 type runOctaveArgs struct {
-	Script string `json:"script"`
+	Script     string   `json:"script"`
+	SessionID  string   `json:"session_id,omitempty"`
+	ReturnVars []string `json:"return_vars,omitempty"`
+	Packages   []string `json:"packages,omitempty" jsonschema:"Octave packages to load before the script runs, each must be allowed by the server policy"`
+}
+
+// runOctaveOutput is the structured content returned by run_octave
+type runOctaveOutput struct {
+	Output string         `json:"output,omitempty" jsonschema:"the text printed by the script"`
+	Vars   map[string]any `json:"vars,omitempty" jsonschema:"the variables requested in return_vars. Matrices are nested arrays (rows first), NaN/Inf/-Inf are the strings NaN/Infinity/-Infinity, complex numbers are {re, im} objects, structs are objects and missing variables are null"`
 }
 
 type generatePlotArgs struct {
+	Script    string   `json:"script"`
+	Format    string   `json:"format"`
+	SessionID string   `json:"session_id,omitempty"`
+	Packages  []string `json:"packages,omitempty" jsonschema:"Octave packages to load before the script runs, each must be allowed by the server policy"`
+	plotOptionArgs
+}
+
+// plotOptionArgs are the export options shared by the plotting tools
+type plotOptionArgs struct {
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	DPI         int    `json:"dpi,omitempty"`
+	FontSize    int    `json:"font_size,omitempty"`
+	Theme       string `json:"theme,omitempty"`
+	FrameDelay  int    `json:"frame_delay,omitempty"`
+	ExtractData bool   `json:"extract_data,omitempty"`
+}
+
+// options converts the arguments to domain plot options
+func (a plotOptionArgs) options() domain.PlotOptions {
+	return domain.PlotOptions{
+		Width:      a.Width,
+		Height:     a.Height,
+		DPI:        a.DPI,
+		FontSize:   a.FontSize,
+		Theme:      strings.ToLower(a.Theme),
+		FrameDelay: a.FrameDelay,
+		Data:       a.ExtractData,
+	}
+}
+
+type checkSyntaxArgs struct {
 	Script string `json:"script"`
-	Format string `json:"format"`
+	Tool   string `json:"tool,omitempty" jsonschema:"the tool whose security policy applies: run_octave (default) or generate_plot"`
+}
+
+// checkSyntaxOutput is the structured content returned by check_octave_syntax
+type checkSyntaxOutput struct {
+	Valid        bool                 `json:"valid" jsonschema:"whether the script parses and complies with the security policy"`
+	SyntaxErrors []domain.SyntaxError `json:"syntax_errors" jsonschema:"the parse errors, the parser stops at the first one"`
+	Violations   []domain.Violation   `json:"violations" jsonschema:"the calls the security policy forbids"`
+}
+
+type helpArgs struct {
+	Name string `json:"name" jsonschema:"the function name, e.g. ode45"`
+}
+
+// helpOutput is the structured content returned by octave_help
+type helpOutput struct {
+	Name      string `json:"name"`
+	Version   string `json:"version" jsonschema:"the Octave version the help comes from"`
+	Available bool   `json:"available" jsonschema:"whether the function can be called without loading a package"`
+	Package   string `json:"package,omitempty" jsonschema:"the installed package providing the function when it is not loaded"`
+	Text      string `json:"text,omitempty" jsonschema:"the help text"`
 }
 
-func (s *Server) runOctaveHandler(ctx context.Context, req *mcp.CallToolRequest, args runOctaveArgs) (*mcp.CallToolResult, any, error) {
+type lookforArgs struct {
+	Keyword string `json:"keyword" jsonschema:"the word or phrase to search for"`
+}
+
+// lookforOutput is the structured content returned by octave_lookfor
+type lookforOutput struct {
+	Keyword string                `json:"keyword"`
+	Version string                `json:"version" jsonschema:"the Octave version searched"`
+	Matches []domain.LookforMatch `json:"matches"`
+	Omitted int                   `json:"omitted,omitempty" jsonschema:"how many more functions matched"`
+}
+
+type listPackagesArgs struct{}
+
+// listPackagesOutput is the structured content returned by list_octave_packages
+type listPackagesOutput struct {
+	Version  string               `json:"version" jsonschema:"the Octave version the packages are installed for"`
+	Packages []domain.PackageInfo `json:"packages" jsonschema:"the installed packages, allowed tells whether the policy lets scripts load them"`
+}
+
+type createSessionArgs struct{}
+
+type closeSessionArgs struct {
+	SessionID string `json:"session_id"`
+}
+
+type submitJobArgs struct {
+	Script     string   `json:"script"`
+	Kind       string   `json:"kind,omitempty"`
+	Format     string   `json:"format,omitempty"`
+	ReturnVars []string `json:"return_vars,omitempty"`
+	Packages   []string `json:"packages,omitempty" jsonschema:"Octave packages to load before the script runs, each must be allowed by the server policy"`
+	plotOptionArgs
+}
+
+type jobArgs struct {
+	JobID string `json:"job_id"`
+}
+
+// jobStatusOutput is the structured content returned by the job tools
+type jobStatusOutput struct {
+	JobID       string `json:"job_id" jsonschema:"the job identifier"`
+	Kind        string `json:"kind" jsonschema:"run or plot"`
+	Status      string `json:"status" jsonschema:"queued, running, succeeded, failed or cancelled"`
+	Error       string `json:"error,omitempty" jsonschema:"why the job failed"`
+	SubmittedAt string `json:"submitted_at" jsonschema:"RFC 3339 submission time"`
+	StartedAt   string `json:"started_at,omitempty" jsonschema:"RFC 3339 time the job started running"`
+	FinishedAt  string `json:"finished_at,omitempty" jsonschema:"RFC 3339 time the job finished"`
+	ExpiresAt   string `json:"expires_at,omitempty" jsonschema:"RFC 3339 time after which the result is discarded"`
+}
+
+// sessionKey returns the Octave session ID owned by the calling MCP session.
+// Persistent sessions are keyed on the transport session ID, stdio has a single
+// unnamed session.
+func sessionKey(req *mcp.CallToolRequest) string {
+	return sessionKeyOf(req.Session)
+}
+
+// sessionKeyOf returns the Octave session ID owned by an MCP session
+func sessionKeyOf(ss *mcp.ServerSession) string {
+	if ss != nil {
+		if id := ss.ID(); id != "" {
+			return id
+		}
+	}
+	return "stdio"
+}
+
+// jobOwner identifies the caller owning the jobs it submits: the
+// authenticated principal, so that jobs outlive the MCP session, or else the
+// MCP session
+func jobOwner(req *mcp.CallToolRequest) string {
+	if req.Extra != nil {
+		if p := principal(req.Extra.TokenInfo); p != "" {
+			return p
+		}
+	}
+	return "session:" + sessionKey(req)
+}
+
+// execOptions resolves the execution options for a tool call, making sure the
+// requested session belongs to the caller
+func (s *Server) execOptions(req *mcp.CallToolRequest, sessionID string) (domain.ExecOptions, error) {
+	if sessionID == "" {
+		return domain.ExecOptions{}, nil
+	}
+	if sessionID != sessionKey(req) || !s.runner.HasSession(sessionID) {
+		return domain.ExecOptions{}, fmt.Errorf("%w: %s", domain.ErrSessionNotFound, sessionID)
+	}
+	return domain.ExecOptions{SessionID: sessionID}, nil
+}
+
+func (s *Server) runOctaveHandler(ctx context.Context, req *mcp.CallToolRequest, args runOctaveArgs) (*mcp.CallToolResult, *runOctaveOutput, error) {
 	if args.Script == "" {
 		return nil, nil, fmt.Errorf("script parameter is required")
 	}
 
-	result, err := s.runner.ExecuteScript(ctx, args.Script)
+	opts, err := s.execOptions(req, args.SessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	opts.ReturnVars = args.ReturnVars
+	opts.Packages = args.Packages
+	reportProgress(ctx, req, &opts)
+	opts.OnUsage = s.usageMeter(req.Extra)
+	opts.CPUBudget = s.cpuBudget(req.Extra)
+
+	result, err := s.runner.Execute(ctx, args.Script, opts)
+	var changed []domain.FileInfo
+	if opts.SessionID != "" {
+		// The script may have written files, even if it failed
+		changed = s.syncResources(ctx, opts.SessionID)
+	}
 
 	if err != nil {
+		text := result.Output
+		if text == "" {
+			// Rejected before running, e.g. a policy violation
+			text = err.Error()
+		}
 		return &mcp.CallToolResult{
+			Meta:    outputMeta(result),
 			IsError: true,
-			Content: []mcp.Content{&mcp.TextContent{Text: result}},
+			Content: []mcp.Content{&mcp.TextContent{Text: text}},
 		}, nil, nil
 	}
 
 	return &mcp.CallToolResult{
+		Meta:    outputMeta(result),
 		IsError: false,
-		Content: []mcp.Content{&mcp.TextContent{Text: result}},
-	}, nil, nil
+		Content: append([]mcp.Content{&mcp.TextContent{Text: result.Output}}, fileLinks(opts.SessionID, changed)...),
+	}, &runOctaveOutput{Output: result.Output, Vars: result.Vars}, nil
+}
+
+// reportProgress sends progress notifications while the call waits for an
+// execution slot and then for every line the script prints, when the request
+// carries a progress token
+func reportProgress(ctx context.Context, req *mcp.CallToolRequest, opts *domain.ExecOptions) {
+	token := req.Params.GetProgressToken()
+	if token == nil || req.Session == nil {
+		return
+	}
+
+	// Both callbacks run on the calling goroutine, one at a time
+	var progress float64
+	notify := func(message string) {
+		progress++
+		err := req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: token,
+			Progress:      progress,
+			Message:       message,
+		})
+		if err != nil {
+			slog.Debug("Failed to send progress notification", "error", err)
+		}
+	}
+	opts.OnQueue = func(position int) {
+		if position == 0 {
+			notify("running")
+			return
+		}
+		notify(fmt.Sprintf("waiting for an execution slot, position %d in queue", position))
+	}
+	opts.OnOutput = notify
+}
+
+// outputMeta reports how much output the script produced, which can exceed
+// what is returned when the output was truncated
+func outputMeta(result *domain.ExecResult) mcp.Meta {
+	return mcp.Meta{
+		"output_bytes": result.OutputBytes,
+		"truncated":    result.Truncated,
+	}
 }
 
 func (s *Server) generatePlotHandler(ctx context.Context, req *mcp.CallToolRequest, args generatePlotArgs) (*mcp.CallToolResult, any, error) {
@@ -113,7 +557,25 @@ func (s *Server) generatePlotHandler(ctx context.Context, req *mcp.CallToolReque
 		return nil, nil, fmt.Errorf("script parameter is required")
 	}
 
-	imgData, err := s.runner.GeneratePlot(ctx, args.Script, args.Format)
+	opts, err := s.execOptions(req, args.SessionID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	opts.Plot = args.options()
+	opts.Packages = args.Packages
+	reportProgress(ctx, req, &opts)
+	opts.OnUsage = s.usageMeter(req.Extra)
+	opts.CPUBudget = s.cpuBudget(req.Extra)
+
+	result, err := s.runner.Plot(ctx, args.Script, args.Format, opts)
+	var changed []domain.FileInfo
+	if opts.SessionID != "" {
+		changed = s.syncResources(ctx, opts.SessionID)
+	}
 	if err != nil {
 		return &mcp.CallToolResult{
 			IsError: true,
@@ -121,25 +583,453 @@ func (s *Server) generatePlotHandler(ctx context.Context, req *mcp.CallToolReque
 		}, nil, nil
 	}
 
-	var mimeType string
-	switch args.Format {
+	res := plotToolResult(result)
+	res.Content = append(res.Content, fileLinks(opts.SessionID, changed)...)
+	return res, nil, nil
+}
+
+// plotDataOutput is the structured content returned with extract_data
+type plotDataOutput struct {
+	// Figures is aligned with the returned images, entries are null when the
+	// data of a figure was omitted
+	Figures []*domain.FigureData `json:"figures"`
+}
+
+// plotToolResult returns the figures and, when they were extracted, their
+// data as structured content along with its JSON text
+func plotToolResult(result *domain.PlotResult) *mcp.CallToolResult {
+	res := &mcp.CallToolResult{
+		IsError: false,
+		Content: plotContent(result),
+	}
+	for _, warning := range result.Warnings {
+		res.Content = append(res.Content, &mcp.TextContent{Text: "warning: " + warning})
+	}
+
+	data := &plotDataOutput{}
+	extracted := false
+	for _, fig := range result.Figures {
+		data.Figures = append(data.Figures, fig.Data)
+		extracted = extracted || fig.Data != nil
+	}
+	if !extracted {
+		return res
+	}
+	text, err := json.Marshal(data)
+	if err != nil {
+		slog.Warn("Failed to encode plot data", "error", err)
+		return res
+	}
+	res.Content = append(res.Content, &mcp.TextContent{Text: string(text)})
+	res.StructuredContent = data
+	return res
+}
+
+// plotContent returns one entry per figure in figure order, each preceded by
+// the titles of its axes when it has any. Raster formats browsers display
+// are returned as images, documents and chart specs as embedded resources.
+func plotContent(result *domain.PlotResult) []mcp.Content {
+	mimeType := plotMIMEType(result.Format)
+	var content []mcp.Content
+	for i, fig := range result.Figures {
+		if len(fig.Titles) > 0 {
+			content = append(content, &mcp.TextContent{Text: fmt.Sprintf("Figure %d: %s", i+1, strings.Join(fig.Titles, "; "))})
+		}
+		switch result.Format {
+		case "png", "svg", "gif":
+			content = append(content, &mcp.ImageContent{Data: fig.Image, MIMEType: mimeType})
+		case domain.PlotFormatVegaLite, domain.PlotFormatPlotly:
+			// A figure whose data was omitted has no spec, a warning says why
+			if fig.Image == nil {
+				continue
+			}
+			content = append(content, &mcp.EmbeddedResource{Resource: &mcp.ResourceContents{
+				URI:      fmt.Sprintf("octave://plot/figure-%d.%s.json", i+1, result.Format),
+				MIMEType: mimeType,
+				Text:     string(fig.Image),
+			}})
+		default:
+			content = append(content, &mcp.EmbeddedResource{Resource: &mcp.ResourceContents{
+				URI:      fmt.Sprintf("octave://plot/figure-%d.%s", i+1, result.Format),
+				MIMEType: mimeType,
+				Blob:     fig.Image,
+			}})
+		}
+	}
+	if result.Frames > 0 {
+		content = append(content, &mcp.TextContent{Text: fmt.Sprintf("Animation of %d frames", result.Frames)})
+	}
+	if result.Omitted > 0 {
+		what := "figures"
+		if result.Frames > 0 {
+			what = "frames"
+		}
+		content = append(content, &mcp.TextContent{Text: fmt.Sprintf("%d more %s were not exported, the limit was reached", result.Omitted, what)})
+	}
+	return content
+}
+
+// plotMIMEType returns the MIME type of a plot format
+func plotMIMEType(format string) string {
+	switch format {
 	case "svg":
-		mimeType = "image/svg+xml"
+		return "image/svg+xml"
 	case "png":
-		mimeType = "image/png"
+		return "image/png"
+	case "jpg":
+		return "image/jpeg"
+	case "gif":
+		return "image/gif"
+	case "pdf":
+		return "application/pdf"
+	case "eps":
+		return "application/postscript"
+	case domain.PlotFormatVegaLite:
+		return "application/vnd.vegalite.v5+json"
+	case domain.PlotFormatPlotly:
+		return "application/vnd.plotly.v1+json"
 	default:
-		mimeType = "application/octet-stream"
+		return "application/octet-stream"
+	}
+}
+
+func (s *Server) checkSyntaxHandler(ctx context.Context, req *mcp.CallToolRequest, args checkSyntaxArgs) (*mcp.CallToolResult, *checkSyntaxOutput, error) {
+	if args.Script == "" {
+		return nil, nil, fmt.Errorf("script parameter is required")
+	}
+
+	var opts domain.ExecOptions
+	reportProgress(ctx, req, &opts)
+	opts.OnUsage = s.usageMeter(req.Extra)
+	opts.CPUBudget = s.cpuBudget(req.Extra)
+	check, err := s.runner.CheckSyntax(ctx, args.Script, args.Tool, opts)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	out := &checkSyntaxOutput{
+		Valid:        check.Valid(),
+		SyntaxErrors: append([]domain.SyntaxError{}, check.SyntaxErrors...),
+		Violations:   append([]domain.Violation{}, check.Violations...),
+	}
+	lines := []string{"Script is valid"}
+	if !out.Valid {
+		lines = lines[:0]
+		for _, e := range check.SyntaxErrors {
+			lines = append(lines, "syntax error: "+e.Error())
+		}
+		for _, v := range check.Violations {
+			lines = append(lines, "policy violation: "+v.String())
+		}
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: strings.Join(lines, "\n")}},
+	}, out, nil
+}
+
+func (s *Server) helpHandler(ctx context.Context, req *mcp.CallToolRequest, args helpArgs) (*mcp.CallToolResult, *helpOutput, error) {
+	if args.Name == "" {
+		return nil, nil, fmt.Errorf("name parameter is required")
+	}
+
+	var opts domain.ExecOptions
+	reportProgress(ctx, req, &opts)
+	opts.OnUsage = s.usageMeter(req.Extra)
+	opts.CPUBudget = s.cpuBudget(req.Extra)
+	help, err := s.runner.Help(ctx, strings.TrimSpace(args.Name), opts)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	var text string
+	switch {
+	case help.Package != "":
+		text = fmt.Sprintf("%s is provided by the %s package, which is not loaded. Run pkg load %s before calling it.", help.Name, help.Package, help.Package)
+	case !help.Found:
+		text = fmt.Sprintf("%s is not available in GNU Octave %s. It may be a MATLAB-only function, use octave_lookfor to find an alternative.", help.Name, help.Version)
+	case help.Text == "":
+		text = fmt.Sprintf("%s is available in GNU Octave %s but has no help text.", help.Name, help.Version)
+	default:
+		text = help.Text
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+	}, &helpOutput{
+		Name:      help.Name,
+		Version:   help.Version,
+		Available: help.Found,
+		Package:   help.Package,
+		Text:      help.Text,
+	}, nil
+}
+
+func (s *Server) lookforHandler(ctx context.Context, req *mcp.CallToolRequest, args lookforArgs) (*mcp.CallToolResult, *lookforOutput, error) {
+	if args.Keyword == "" {
+		return nil, nil, fmt.Errorf("keyword parameter is required")
+	}
+
+	var opts domain.ExecOptions
+	reportProgress(ctx, req, &opts)
+	opts.OnUsage = s.usageMeter(req.Extra)
+	opts.CPUBudget = s.cpuBudget(req.Extra)
+	result, err := s.runner.Lookfor(ctx, args.Keyword, opts)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
 	}
 
+	lines := make([]string, 0, len(result.Matches)+1)
+	for _, m := range result.Matches {
+		lines = append(lines, fmt.Sprintf("%s: %s", m.Name, m.Summary))
+	}
+	switch {
+	case len(lines) == 0:
+		lines = append(lines, fmt.Sprintf("No function in GNU Octave %s mentions %q", result.Version, result.Keyword))
+	case result.Omitted > 0:
+		lines = append(lines, fmt.Sprintf("%d more functions matched, use a more specific keyword", result.Omitted))
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: strings.Join(lines, "\n")}},
+	}, &lookforOutput{
+		Keyword: result.Keyword,
+		Version: result.Version,
+		Matches: append([]domain.LookforMatch{}, result.Matches...),
+		Omitted: result.Omitted,
+	}, nil
+}
+
+func (s *Server) listPackagesHandler(ctx context.Context, req *mcp.CallToolRequest, args listPackagesArgs) (*mcp.CallToolResult, *listPackagesOutput, error) {
+	var opts domain.ExecOptions
+	reportProgress(ctx, req, &opts)
+	opts.OnUsage = s.usageMeter(req.Extra)
+	opts.CPUBudget = s.cpuBudget(req.Extra)
+	packages, err := s.runner.ListPackages(ctx, opts)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	lines := make([]string, 0, len(packages)+1)
+	for _, p := range packages {
+		line := fmt.Sprintf("%s %s", p.Name, p.Version)
+		if p.Allowed {
+			line += " (allowed)"
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, fmt.Sprintf("No package is installed for GNU Octave %s", s.version))
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: strings.Join(lines, "\n")}},
+	}, &listPackagesOutput{Version: s.version, Packages: packages}, nil
+}
+
+func (s *Server) createSessionHandler(ctx context.Context, req *mcp.CallToolRequest, args createSessionArgs) (*mcp.CallToolResult, any, error) {
+	id := sessionKey(req)
+
+	created, err := s.runner.CreateSession(ctx, id)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	if created {
+		s.publishSession(ctx, id)
+	}
+	if created && req.Session != nil {
+		// Tear the Octave session down together with the MCP session
+		go func(ss *mcp.ServerSession) {
+			ss.Wait()
+			if err := s.runner.CloseSession(id); err == nil {
+				slog.Debug("Closed session of disconnected client", "session_id", id)
+			}
+		}(req.Session)
+	}
+
+	text := fmt.Sprintf("session_id: %s", id)
+	if !created {
+		text += " (already active)"
+	}
 	return &mcp.CallToolResult{
 		IsError: false,
-		Content: []mcp.Content{&mcp.ImageContent{Data: imgData, MIMEType: mimeType}},
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
 	}, nil, nil
 }
 
+func (s *Server) closeSessionHandler(ctx context.Context, req *mcp.CallToolRequest, args closeSessionArgs) (*mcp.CallToolResult, any, error) {
+	if args.SessionID == "" {
+		return nil, nil, fmt.Errorf("session_id parameter is required")
+	}
+
+	if _, err := s.execOptions(req, args.SessionID); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	if err := s.runner.CloseSession(args.SessionID); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		IsError: false,
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("session %s closed", args.SessionID)}},
+	}, nil, nil
+}
+
+func (s *Server) submitJobHandler(ctx context.Context, req *mcp.CallToolRequest, args submitJobArgs) (*mcp.CallToolResult, *jobStatusOutput, error) {
+	if args.Script == "" {
+		return nil, nil, fmt.Errorf("script parameter is required")
+	}
+
+	job, err := s.jobs.Submit(domain.JobRequest{
+		Owner:      jobOwner(req),
+		Kind:       domain.JobKind(args.Kind),
+		Script:     args.Script,
+		Format:     args.Format,
+		Plot:       args.options(),
+		ReturnVars: args.ReturnVars,
+		Packages:   args.Packages,
+		OnUsage:    s.usageMeter(req.Extra),
+		CPUBudget:  s.cpuBudget(req.Extra),
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		IsError: false,
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("job_id: %s (%s)", job.ID, job.Status)}},
+	}, jobStatus(job), nil
+}
+
+func (s *Server) jobStatusHandler(ctx context.Context, req *mcp.CallToolRequest, args jobArgs) (*mcp.CallToolResult, *jobStatusOutput, error) {
+	if args.JobID == "" {
+		return nil, nil, fmt.Errorf("job_id parameter is required")
+	}
+
+	job, err := s.jobs.Get(args.JobID, jobOwner(req))
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		IsError: false,
+		Content: []mcp.Content{&mcp.TextContent{Text: jobStatusText(job)}},
+	}, jobStatus(job), nil
+}
+
+func (s *Server) jobResultHandler(ctx context.Context, req *mcp.CallToolRequest, args jobArgs) (*mcp.CallToolResult, any, error) {
+	if args.JobID == "" {
+		return nil, nil, fmt.Errorf("job_id parameter is required")
+	}
+
+	job, err := s.jobs.Result(args.JobID, jobOwner(req))
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	if job.Status != domain.JobSucceeded {
+		text := jobStatusText(job)
+		if job.Result != nil && job.Result.Output != "" {
+			text += "\n" + job.Result.Output
+		}
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: text}},
+		}, nil, nil
+	}
+
+	if job.Kind == domain.JobKindPlot {
+		return plotToolResult(job.Plot), nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		Meta:              outputMeta(job.Result),
+		IsError:           false,
+		Content:           []mcp.Content{&mcp.TextContent{Text: job.Result.Output}},
+		StructuredContent: &runOctaveOutput{Output: job.Result.Output, Vars: job.Result.Vars},
+	}, nil, nil
+}
+
+func (s *Server) cancelJobHandler(ctx context.Context, req *mcp.CallToolRequest, args jobArgs) (*mcp.CallToolResult, *jobStatusOutput, error) {
+	if args.JobID == "" {
+		return nil, nil, fmt.Errorf("job_id parameter is required")
+	}
+
+	job, err := s.jobs.Cancel(args.JobID, jobOwner(req))
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		}, nil, nil
+	}
+
+	return &mcp.CallToolResult{
+		IsError: false,
+		Content: []mcp.Content{&mcp.TextContent{Text: jobStatusText(job)}},
+	}, jobStatus(job), nil
+}
+
+// jobStatus converts a job snapshot into its structured representation
+func jobStatus(job domain.Job) *jobStatusOutput {
+	out := &jobStatusOutput{
+		JobID:       job.ID,
+		Kind:        string(job.Kind),
+		Status:      string(job.Status),
+		Error:       job.Error,
+		SubmittedAt: job.SubmittedAt.Format(time.RFC3339),
+	}
+	if !job.StartedAt.IsZero() {
+		out.StartedAt = job.StartedAt.Format(time.RFC3339)
+	}
+	if !job.FinishedAt.IsZero() {
+		out.FinishedAt = job.FinishedAt.Format(time.RFC3339)
+		out.ExpiresAt = job.ExpiresAt.Format(time.RFC3339)
+	}
+	return out
+}
+
+// jobStatusText summarizes a job for the text content of the job tools
+func jobStatusText(job domain.Job) string {
+	text := fmt.Sprintf("job %s: %s", job.ID, job.Status)
+	if job.Error != "" {
+		text += ": " + job.Error
+	}
+	return text
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	status int
+	// principal is the authenticated caller, set by authMiddleware
+	principal string
 }
 
 func (rw *responseWriter) WriteHeader(statusCode int) {
@@ -173,6 +1063,9 @@ func loggingMiddleware(next http.Handler) http.Handler {
 			"duration", duration,
 			"request_id", requestID,
 		}
+		if rw.principal != "" {
+			logAttrs = append(logAttrs, "principal", rw.principal)
+		}
 
 		switch {
 		case status >= 500:
@@ -184,19 +1077,3 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		}
 	})
 }
-
-func securityMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		if origin != "" && !strings.HasPrefix(origin, "http://localhost") {
-			http.Error(w, "Invalid origin", http.StatusForbidden)
-			return
-		}
-
-		w.Header().Set("Content-Security-Policy", "default-src 'self'")
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
-
-		next.ServeHTTP(w, r)
-	})
-}
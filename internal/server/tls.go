@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// certReloadInterval is how often the certificate files are checked for changes
+const certReloadInterval = 10 * time.Second
+
+// TLSConfig names the PEM files the HTTP server uses for TLS
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a CA bundle client certificates must chain to. Setting
+	// it enables mutual TLS.
+	ClientCAFile string
+}
+
+// Enabled reports whether TLS is configured
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.ClientCAFile != ""
+}
+
+// check reports a configuration that cannot work
+func (c TLSConfig) check() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return fmt.Errorf("TLS needs both -tls-cert and -tls-key")
+	}
+	return nil
+}
+
+// certReloader serves the certificate and client CA bundle of a TLSConfig,
+// loading them again when the files change so rotations need no restart
+type certReloader struct {
+	files  TLSConfig
+	logger *slog.Logger
+
+	mu sync.RWMutex
+	// config is handed out for every handshake
+	config *tls.Config
+	// stamp identifies the versions of the files config was built from
+	stamp string
+}
+
+func newCertReloader(files TLSConfig, logger *slog.Logger) (*certReloader, error) {
+	if err := files.check(); err != nil {
+		return nil, err
+	}
+	c := &certReloader{files: files, logger: logger}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// fileStamp identifies the current version of the files by size and
+// modification time
+func (c *certReloader) fileStamp() (string, error) {
+	var stamp strings.Builder
+	for _, path := range []string{c.files.CertFile, c.files.KeyFile, c.files.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stamp, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp.String(), nil
+}
+
+// reload builds a new TLS configuration from the files if they changed. On
+// failure the previous configuration stays in use.
+func (c *certReloader) reload() error {
+	stamp, err := c.fileStamp()
+	if err != nil {
+		return fmt.Errorf("failed to read TLS files: %w", err)
+	}
+	c.mu.RLock()
+	unchanged := stamp == c.stamp
+	c.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.files.CertFile, c.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if c.files.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.files.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("client CA bundle %s holds no PEM certificate", c.files.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	c.mu.Lock()
+	first := c.config == nil
+	c.config, c.stamp = config, stamp
+	c.mu.Unlock()
+	if !first {
+		c.logger.Info("TLS certificate reloaded", "cert", c.files.CertFile)
+	}
+	return nil
+}
+
+// watch reloads the files every certReloadInterval until ctx is done
+func (c *certReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(certReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.reload(); err != nil {
+				c.logger.Warn("Could not reload TLS certificate, keeping the previous one", "error", err)
+			}
+		}
+	}
+}
+
+// tlsConfig returns the server TLS configuration, which picks up reloads on
+// the next handshake
+func (c *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return c.config, nil
+		},
+	}
+}
+
+// clientCertificate returns the verified client certificate of a request
+func clientCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// certFingerprint is the hex encoded SHA-256 of a certificate
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyClientCert accepts the fingerprint of the verified client certificate
+// of the request, set as its token by clientCertMiddleware
+func verifyClientCert(ctx context.Context, token string, req *http.Request) (*auth.TokenInfo, error) {
+	cert := clientCertificate(req)
+	if cert == nil || certFingerprint(cert) != token {
+		return nil, fmt.Errorf("%w: no verified client certificate", auth.ErrInvalidToken)
+	}
+	return &auth.TokenInfo{
+		UserID:     "cert:" + cert.Subject.String(),
+		Expiration: cert.NotAfter,
+	}, nil
+}
+
+// clientCertMiddleware makes the subject of the verified client certificate
+// the principal of the request. Requests that carry an API key or a bearer
+// token are passed to tokenAuth instead, so that the key or token takes
+// precedence over the certificate. Without token authentication, tokenAuth is
+// nil and any Authorization header is ignored.
+func clientCertMiddleware(tokenAuth, next http.Handler) http.Handler {
+	protected := auth.RequireBearerToken(verifyClientCert, nil)(recordPrincipal(next))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert := clientCertificate(r)
+		if cert == nil {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		if tokenAuth != nil && (r.Header.Get("Authorization") != "" || r.Header.Get(apiKeyHeader) != "") {
+			tokenAuth.ServeHTTP(w, r)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+certFingerprint(cert))
+		protected.ServeHTTP(w, r)
+	})
+}
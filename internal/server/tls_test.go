@@ -0,0 +1,289 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var testSerial int64
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	ca := &testCA{}
+	ca.cert, ca.key, ca.pem = issueCert(t, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	return ca
+}
+
+// issue returns a PEM certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (certPEM, keyPEM []byte) {
+	t.Helper()
+	_, key, certPEM := issueCert(t, ca, template)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func issueCert(t *testing.T, ca *testCA, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	template.SerialNumber = big.NewInt(testSerial)
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func serverTemplate(name string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfig_Check(t *testing.T) {
+	if (TLSConfig{}).Enabled() {
+		t.Error("Expected an empty TLSConfig to be disabled")
+	}
+	for _, files := range []TLSConfig{{CertFile: "c.pem"}, {KeyFile: "k.pem"}, {ClientCAFile: "ca.pem"}} {
+		if !files.Enabled() {
+			t.Errorf("Expected %+v to be enabled", files)
+		}
+		if _, err := newCertReloader(files, slog.Default()); err == nil || !strings.Contains(err.Error(), "both -tls-cert and -tls-key") {
+			t.Errorf("Expected %+v to be refused, got %v", files, err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	files := TLSConfig{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	serverCA := newTestCA(t, "server CA")
+	clientCA := newTestCA(t, "client CA")
+	certPEM, keyPEM := serverCA.issue(t, serverTemplate("first"))
+	writeFile(t, files.CertFile, certPEM)
+	writeFile(t, files.KeyFile, keyPEM)
+	writeFile(t, files.ClientCAFile, clientCA.pem)
+
+	certs, err := newCertReloader(files, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(loggingMiddleware(clientCertMiddleware(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, principal(auth.TokenInfoFromContext(r.Context())))
+	}))))
+	ts.TLS = certs.tlsConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverCA.pem)
+	get := func(t *testing.T, clientCerts ...tls.Certificate) (*http.Response, string, error) {
+		t.Helper()
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: clientCerts},
+			DisableKeepAlives: true,
+		}}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body), nil
+	}
+	clientCert := func(t *testing.T, ca *testCA, name string) tls.Certificate {
+		t.Helper()
+		certPEM, keyPEM := ca.issue(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: name, Organization: []string{"Octave"}},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	t.Run("Client certificate subject is the principal", func(t *testing.T) {
+		resp, body, err := get(t, clientCert(t, clientCA, "alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || body != "cert:CN=alice,O=Octave" {
+			t.Errorf("Expected principal cert:CN=alice,O=Octave, got %d %q", resp.StatusCode, body)
+		}
+		if got := resp.TLS.PeerCertificates[0].Subject.CommonName; got != "first" {
+			t.Errorf("Expected server certificate first, got %s", got)
+		}
+	})
+
+	t.Run("Rejects missing and untrusted client certificates", func(t *testing.T) {
+		if _, _, err := get(t); err == nil {
+			t.Error("Expected the handshake to fail without a client certificate")
+		}
+		if _, _, err := get(t, clientCert(t, newTestCA(t, "other CA"), "mallory")); err == nil {
+			t.Error("Expected the handshake to fail with an untrusted client certificate")
+		}
+	})
+
+	t.Run("Reloads rotated certificates", func(t *testing.T) {
+		certPEM, keyPEM := serverCA.issue(t, serverTemplate("second"))
+		writeFile(t, files.CertFile, certPEM)
+		writeFile(t, files.KeyFile, keyPEM)
+		// Make the change visible on file systems with a coarse timestamp
+		later := time.Now().Add(time.Minute)
+		for _, path := range []string{files.CertFile, files.KeyFile} {
+			if err := os.Chtimes(path, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := certs.reload(); err != nil {
+			t.Fatal(err)
+		}
+		resp, _, err := get(t, clientCert(t, clientCA, "alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.TLS.PeerCertificates[0].Subject.CommonName; got != "second" {
+			t.Errorf("Expected server certificate second after reload, got %s", got)
+		}
+	})
+
+	t.Run("Keeps the certificate when the new one is broken", func(t *testing.T) {
+		writeFile(t, files.KeyFile, []byte("not a key"))
+		if err := certs.reload(); err == nil {
+			t.Error("Expected a reload error")
+		}
+		resp, _, err := get(t, clientCert(t, clientCA, "alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.TLS.PeerCertificates[0].Subject.CommonName; got != "second" {
+			t.Errorf("Expected server certificate second to stay in use, got %s", got)
+		}
+	})
+
+	t.Run("Watch stops with its context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			certs.watch(ctx)
+			close(done)
+		}()
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Expected watch to return once its context is done")
+		}
+	})
+}
+
+func TestClientCertMiddleware_WithAPIKeys(t *testing.T) {
+	keys, err := parseAPIKeys([]byte(`{"keys": [{"label": "ci", "sha256": "` + sha256Hex("ci-key") + `"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, _ := issueCert(t, newTestCA(t, "client CA"), &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "alice", Organization: []string{"Octave"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, principal(auth.TokenInfoFromContext(r.Context())))
+	})
+	handler := clientCertMiddleware(authMiddleware(keys.verify, nil, echo), echo)
+
+	serve := func(header http.Header, withCert bool) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header = header
+		if withCert {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tt := range []struct {
+		name     string
+		header   http.Header
+		withCert bool
+		status   int
+		want     string
+	}{
+		{name: "certificate alone", header: http.Header{}, withCert: true, status: http.StatusOK, want: "cert:CN=alice,O=Octave"},
+		{name: "API key takes precedence", header: http.Header{"X-Api-Key": {"ci-key"}}, withCert: true, status: http.StatusOK, want: "apikey:ci"},
+		{name: "bearer key takes precedence", header: http.Header{"Authorization": {"Bearer ci-key"}}, withCert: true, status: http.StatusOK, want: "apikey:ci"},
+		{name: "invalid key is refused", header: http.Header{"Authorization": {"Bearer wrong"}}, withCert: true, status: http.StatusUnauthorized},
+		{name: "key without certificate", header: http.Header{"X-Api-Key": {"ci-key"}}, status: http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.header, tt.withCert)
+			if rec.Code != tt.status || (tt.want != "" && rec.Body.String() != tt.want) {
+				t.Errorf("Expected %d %q, got %d %q", tt.status, tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}